@@ -0,0 +1,119 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RoleReader   = "reader"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var (
+	ErrUnauthorized = errors.New("a valid token is required.")
+
+	// each role can do whatever lower roles can
+	roleLevels = map[string]int{
+		RoleReader:   1,
+		RoleOperator: 2,
+		RoleAdmin:    3,
+	}
+	authenticators []Authenticator
+)
+
+// identityKey keeps identity of request in gin context.
+const identityKey = "themis.identity"
+
+// Identity is who makes a request.
+type Identity struct {
+	Name string
+	Role string
+}
+
+// Authenticator tells who holds a bearer token.
+type Authenticator interface {
+	// Authenticate returns identity of token, nil if token is unknown.
+	Authenticate(token string) (*Identity, error)
+}
+
+// RegisterAuthenticators turns on authentication, tokens are tried with
+// authenticators in order.
+func RegisterAuthenticators(a []Authenticator) {
+	authenticators = a
+}
+
+// Authenticate rejects requests without a valid token once authenticators
+// are registered, it runs before requests are forwarded to the leader.
+func Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(authenticators) == 0 {
+			c.Next()
+			return
+		}
+
+		token := bearerToken(c)
+		var lastErr error
+		if len(token) > 0 {
+			for _, a := range authenticators {
+				identity, err := a.Authenticate(token)
+				if err != nil {
+					lastErr = err
+				} else if identity != nil {
+					c.Set(identityKey, identity)
+					c.Next()
+					return
+				}
+			}
+		}
+		if lastErr != nil {
+			AbortWithError(http.StatusServiceUnavailable, fmt.Errorf("can not validate token: %s", lastErr))
+		}
+		c.Header("WWW-Authenticate", `Bearer realm="themis"`)
+		AbortWithError(http.StatusUnauthorized, ErrUnauthorized)
+	}
+}
+
+// bearerToken returns token in Authorization or X-Auth-Token header.
+func bearerToken(c *gin.Context) string {
+	if auth := c.GetHeader("Authorization"); len(auth) > 0 {
+		parts := strings.SplitN(auth, " ", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+			return strings.TrimSpace(parts[1])
+		}
+		return ""
+	}
+	return c.GetHeader("X-Auth-Token")
+}
+
+// RequireRole rejects requests made by roles lower than role.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasRole(c, role) {
+			AbortWithError(http.StatusForbidden, fmt.Errorf("role %s is required.", role))
+		}
+	}
+}
+
+// HasRole tells if request is made by role or a higher one, everyone has
+// every role if authentication is off.
+func HasRole(c *gin.Context, role string) bool {
+	if len(authenticators) == 0 {
+		return true
+	}
+	value, ok := c.Get(identityKey)
+	if !ok {
+		return false
+	}
+	return RoleLevel(value.(*Identity).Role) >= RoleLevel(role)
+}
+
+// RoleLevel tells how much role can do, 0 for unknown roles.
+func RoleLevel(role string) int {
+	return roleLevels[role]
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrClusterUnavailable = errors.New("cluster information is not available.")
+	ErrNoLeader           = errors.New("there is no leader now.")
+	ErrNotLeader          = errors.New("this monitor is not the leader.")
+	ErrLeaderMoving       = errors.New("leadership is moving, try again later.")
+
+	cluster Cluster
+)
+
+// Cluster reports and hands over leadership among monitors.
+type Cluster interface {
+	// Name returns name of this monitor.
+	Name() string
+	IsLeader() bool
+	// LeaderAddress returns URL of REST API of the leader, empty if there is no leader.
+	LeaderAddress() (string, error)
+	Members() ([]*ClusterMember, error)
+	// StepDown gives up leadership, it fails with ErrNotLeader if this
+	// monitor is not the leader.
+	StepDown() error
+}
+
+type ClusterMember struct {
+	Name         string    `json:"name"`
+	Leader       bool      `json:"leader"`
+	Term         int64     `json:"term"`
+	TermStart    time.Time `json:"term_start"`
+	LastProclaim time.Time `json:"last_proclaim"`
+	Address      string    `json:"address"`
+}
+
+// forwardedHeader marks requests forwarded by a follower.
+const forwardedHeader = "X-Themis-Forwarded"
+
+func RegisterCluster(c Cluster) {
+	cluster = c
+}
+
+// monitorName returns name of this monitor, empty if it is unknown.
+func monitorName() string {
+	if cluster == nil {
+		return ""
+	}
+	return cluster.Name()
+}
+
+func init() {
+	Router().GET("/cluster/leader", RequireRole(RoleReader), GetClusterLeader)
+	Router().GET("/cluster/members", RequireRole(RoleReader), ListClusterMembers)
+	Router().POST("/cluster/leader/step-down", RequireRole(RoleOperator), StepDownClusterLeader)
+}
+
+func getClusterMembers() []*ClusterMember {
+	if cluster == nil {
+		AbortWithError(http.StatusNotImplemented, ErrClusterUnavailable)
+	}
+
+	members, err := cluster.Members()
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+	return members
+}
+
+func GetClusterLeader(c *gin.Context) {
+	for _, member := range getClusterMembers() {
+		if member.Leader {
+			c.JSON(http.StatusOK, member)
+			return
+		}
+	}
+	AbortWithError(http.StatusNotFound, ErrNoLeader)
+}
+
+func ListClusterMembers(c *gin.Context) {
+	c.JSON(http.StatusOK, getClusterMembers())
+}
+
+func StepDownClusterLeader(c *gin.Context) {
+	if cluster == nil {
+		AbortWithError(http.StatusNotImplemented, ErrClusterUnavailable)
+	}
+
+	if err := cluster.StepDown(); err == ErrNotLeader {
+		AbortWithError(http.StatusConflict, err)
+	} else if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "leader is stepping down."})
+}
+
+// ForwardWrites serves reads locally and forwards mutating requests to the
+// leader, so that the leader is the only writer.
+func ForwardWrites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if cluster == nil || cluster.IsLeader() {
+			c.Next()
+			return
+		}
+
+		// never forward twice, leadership is changing hands
+		if len(c.GetHeader(forwardedHeader)) > 0 {
+			AbortWithError(http.StatusServiceUnavailable, ErrLeaderMoving)
+		}
+		address, err := cluster.LeaderAddress()
+		if err != nil {
+			AbortWithError(http.StatusInternalServerError, err)
+		} else if len(address) == 0 {
+			AbortWithError(http.StatusServiceUnavailable, ErrNoLeader)
+		}
+		target, err := url.Parse(address)
+		if err != nil {
+			AbortWithError(http.StatusInternalServerError, err)
+		}
+
+		c.Request.Header.Set(forwardedHeader, "true")
+		httputil.NewSingleHostReverseProxy(target).ServeHTTP(c.Writer, c.Request)
+		c.Abort()
+	}
+}
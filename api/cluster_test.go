@@ -0,0 +1,180 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"themis/database"
+)
+
+// fakeCluster is a cluster whose leader is set by tests.
+type fakeCluster struct {
+	leader    bool
+	address   string
+	members   []*ClusterMember
+	stepDowns int
+}
+
+func (c *fakeCluster) Name() string                       { return "monitor1" }
+func (c *fakeCluster) IsLeader() bool                     { return c.leader }
+func (c *fakeCluster) LeaderAddress() (string, error)     { return c.address, nil }
+func (c *fakeCluster) Members() ([]*ClusterMember, error) { return c.members, nil }
+
+func (c *fakeCluster) StepDown() error {
+	if !c.leader {
+		return ErrNotLeader
+	}
+	c.stepDowns++
+	return nil
+}
+
+// useCluster registers c until test ends.
+func useCluster(t *testing.T, c *fakeCluster) {
+	RegisterCluster(c)
+	t.Cleanup(func() { RegisterCluster(nil) })
+}
+
+// stubLeader records requests forwarded to the leader.
+type stubLeader struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+func newStubLeader(t *testing.T) *stubLeader {
+	l := &stubLeader{}
+	l.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		l.mutex.Lock()
+		l.requests = append(l.requests, r)
+		l.bodies = append(l.bodies, string(body))
+		l.mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"name":"from-leader"}`))
+	}))
+	t.Cleanup(l.Close)
+	return l
+}
+
+func (l *stubLeader) forwarded() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.requests)
+}
+
+// serveFollower sends request to router served over HTTP, like requests
+// proxied by followers are, and returns status and body of response.
+func serveFollower(t *testing.T, method, path, body string, headers ...string) (int, string) {
+	t.Helper()
+	follower := httptest.NewServer(Router())
+	defer follower.Close()
+	req, err := http.NewRequest(method, follower.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestForwardWrites(t *testing.T) {
+	s := useMemoryStore(t)
+	leader := newStubLeader(t)
+	c := &fakeCluster{address: leader.URL}
+	useCluster(t, c)
+
+	// followers forward writes to the leader exactly once
+	status, body := serveFollower(t, http.MethodPost, "/hosts?dry_run=false", `{"name":"node1"}`)
+	if status != http.StatusCreated || body != `{"name":"from-leader"}` || leader.forwarded() != 1 {
+		t.Fatalf("write is not forwarded: %d %s, %d requests", status, body, leader.forwarded())
+	}
+	forwarded := leader.requests[0]
+	if forwarded.Method != http.MethodPost || forwarded.URL.Path != "/hosts" ||
+		forwarded.URL.RawQuery != "dry_run=false" || forwarded.Header.Get(forwardedHeader) != "true" {
+		t.Errorf("unexpected forwarded request %s %s %v", forwarded.Method, forwarded.URL, forwarded.Header)
+	}
+	if !strings.Contains(leader.bodies[0], `"node1"`) {
+		t.Errorf("body is not forwarded: %s", leader.bodies[0])
+	}
+	if hosts, _ := s.HostGetAll(); len(hosts) != 0 {
+		t.Errorf("follower writes locally %v", hosts)
+	}
+
+	// reads are served locally
+	s.HostInsert(&database.Host{Name: "node2", Status: HostInitialStatus})
+	var hosts []*database.Host
+	decode(t, serve(t, http.MethodGet, "/hosts", nil), http.StatusOK, &hosts)
+	if len(hosts) != 1 || hosts[0].Name != "node2" || leader.forwarded() != 1 {
+		t.Errorf("read is forwarded: %v, %d requests", hosts, leader.forwarded())
+	}
+
+	// forwarded requests are never forwarded again, leader is moving
+	if status, _ := serveFollower(t, http.MethodDelete, "/hosts/node2", "", forwardedHeader, "true"); status != http.StatusServiceUnavailable {
+		t.Errorf("forwarded request gets %d", status)
+	}
+	if leader.forwarded() != 1 {
+		t.Errorf("forwarded request is forwarded again")
+	}
+	c.address = ""
+	if status, _ := serveFollower(t, http.MethodDelete, "/hosts/node2", ""); status != http.StatusServiceUnavailable {
+		t.Errorf("request without leader gets %d", status)
+	}
+	if host, _ := s.HostGetByName("node2"); host == nil {
+		t.Errorf("follower deletes host")
+	}
+
+	// the leader serves writes itself
+	c.leader = true
+	decode(t, serve(t, http.MethodDelete, "/hosts/node2", nil, forwardedHeader, "true"), http.StatusNoContent, nil)
+	if host, _ := s.HostGetByName("node2"); host != nil || leader.forwarded() != 1 {
+		t.Errorf("leader does not delete host")
+	}
+}
+
+func TestClusterStatus(t *testing.T) {
+	useMemoryStore(t)
+	decode(t, serve(t, http.MethodGet, "/cluster/members", nil), http.StatusNotImplemented, nil)
+	decode(t, serve(t, http.MethodPost, "/cluster/leader/step-down", nil), http.StatusNotImplemented, nil)
+
+	c := &fakeCluster{members: []*ClusterMember{
+		{Name: "monitor1", Address: "http://monitor1"},
+		{Name: "monitor2", Address: "http://monitor2"},
+	}}
+	useCluster(t, c)
+	decode(t, serve(t, http.MethodGet, "/cluster/leader", nil), http.StatusNotFound, nil)
+
+	c.members[1].Leader, c.members[1].Term = true, 3
+	var members []*ClusterMember
+	decode(t, serve(t, http.MethodGet, "/cluster/members", nil), http.StatusOK, &members)
+	if len(members) != 2 || members[0].Leader || !members[1].Leader {
+		t.Errorf("unexpected members %v", members)
+	}
+	var leader ClusterMember
+	decode(t, serve(t, http.MethodGet, "/cluster/leader", nil), http.StatusOK, &leader)
+	if leader.Name != "monitor2" || leader.Term != 3 || leader.Address != "http://monitor2" {
+		t.Errorf("unexpected leader %+v", leader)
+	}
+
+	// followers forward step-down to the leader, which steps down itself
+	decode(t, serve(t, http.MethodPost, "/cluster/leader/step-down", nil), http.StatusServiceUnavailable, nil)
+	c.leader = true
+	decode(t, serve(t, http.MethodPost, "/cluster/leader/step-down", nil), http.StatusAccepted, nil)
+	if c.stepDowns != 1 {
+		t.Errorf("leader steps down %d times", c.stepDowns)
+	}
+}
@@ -10,6 +10,7 @@ var (
 	ErrNotFound         = errors.New("Resource not found.")
 	ErrInvalidParameter = errors.New("Invalid parameters.")
 	ErrDuplicatedTag    = errors.New("tag must be unique for one host.")
+	ErrFencerType       = errors.New("fencer type must be ipmi or redfish.")
 )
 
 type HTTPError struct {
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,14 +13,26 @@ const (
 	HostInitialStatus = "initializing"
 )
 
+// sort keys of hosts and their columns
+var hostSortColumns = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"group":      "host_group",
+	"status":     "status",
+	"disabled":   "disabled",
+	"updated_at": "updated_at",
+}
+
 func init() {
-	Router().POST("/hosts", CreateHost)
-	Router().GET("/hosts", GetAllHosts)
-	Router().GET("/hosts/:id", GetOneHost)
-	Router().PUT("/hosts/:id", UpdateHost)
-	Router().DELETE("/hosts/:id", DeleteHost)
-	Router().POST("/hosts/:id/enable", EnableHost)
-	Router().POST("/hosts/:id/disable", DisableHost)
+	Router().POST("/hosts", RequireRole(RoleAdmin), CreateHost)
+	Router().GET("/hosts", RequireRole(RoleReader), GetAllHosts)
+	Router().GET("/hosts/:id", RequireRole(RoleReader), GetOneHost)
+	Router().GET("/hosts/by-name/:name", RequireRole(RoleReader), GetOneHost)
+	Router().PUT("/hosts/:id", RequireRole(RoleAdmin), UpdateHost)
+	Router().DELETE("/hosts/:id", RequireRole(RoleAdmin), DeleteHost)
+	Router().POST("/hosts/:id/enable", RequireRole(RoleOperator), EnableHost)
+	Router().POST("/hosts/:id/disable", RequireRole(RoleOperator), DisableHost)
+	Router().GET("/hosts/:id/history", RequireRole(RoleReader), GetHostHistory)
 }
 
 func CreateHost(c *gin.Context) {
@@ -28,7 +41,7 @@ func CreateHost(c *gin.Context) {
 	ParseBody(c, &host)
 	host.Status = HostInitialStatus
 	host.UpdatedAt = time.Now()
-	if err := database.HostInsert(&host); err != nil {
+	if err := store.HostInsert(&host); err != nil {
 		AbortWithError(http.StatusNotAcceptable, err)
 	} else {
 		c.JSON(http.StatusCreated, host)
@@ -36,47 +49,54 @@ func CreateHost(c *gin.Context) {
 }
 
 func GetOneHost(c *gin.Context) {
-	id := GetId(c, "id")
+	host := GetHost(c)
 
-	if host, err := database.HostGetById(id); err != nil {
-		AbortWithError(http.StatusInternalServerError, err)
-	} else if host == nil {
-		AbortWithError(http.StatusNotFound, ErrNotFound)
-	} else {
-		c.JSON(http.StatusOK, host)
-	}
+	SetETag(c, host.Version)
+	c.JSON(http.StatusOK, host)
 }
 
+// GetAllHosts lists hosts filtered by status, disabled, name_prefix, group
+// and failed_tag, see GetPage for paging.
 func GetAllHosts(c *gin.Context) {
-	hosts, err := database.HostGetAll()
-	if err != nil {
-		AbortWithError(http.StatusInternalServerError, err)
+	q := &database.HostQuery{
+		Disabled:   GetBool(c, "disabled"),
+		NamePrefix: c.Query("name_prefix"),
+		Group:      c.Query("group"),
+		FailedTag:  c.Query("failed_tag"),
+		Page:       GetPage(c, hostSortColumns),
+	}
+	if status := c.Query("status"); len(status) > 0 {
+		q.Status = strings.Split(status, ",")
 	}
-	c.JSON(http.StatusOK, hosts)
+
+	hosts, err := store.HostFind(q)
+	AbortOnFindError(err)
+	count := SetNextPage(c, q.Page, len(hosts), func(i int) int { return hosts[i].Id })
+	c.JSON(http.StatusOK, hosts[:count])
 }
 
+// UpdateHost changes name and group of host, its status, flags and version
+// are owned by monitors and never taken from clients.
 func UpdateHost(c *gin.Context) {
-	id := GetId(c, "id")
-
-	host, err := database.HostGetById(id)
-	if err != nil {
-		AbortWithError(http.StatusInternalServerError, err)
-	} else if host == nil {
-		AbortWithError(http.StatusNotFound, err)
-	}
-
-	ParseBody(c, host)
-	if err := database.HostUpdate(id, host); err != nil {
-		AbortWithError(http.StatusInternalServerError, err)
-	} else {
-		c.JSON(http.StatusAccepted, host)
-	}
+	host := GetHost(c)
+	update := *host
+
+	CheckIfMatch(c, host.Version)
+	ParseBody(c, &update)
+	host.Name, host.Group = update.Name, update.Group
+	AbortOnWriteError(store.HostUpdate(host.Id, host))
+	SetETag(c, host.Version)
+	c.JSON(http.StatusAccepted, host)
 }
 
 func DeleteHost(c *gin.Context) {
-	id := GetId(c, "id")
+	host := GetHost(c)
 
-	if err := database.HostDelete(id); err != nil {
+	if err := store.HostDelete(host.Id, IfMatchVersion(c)); err == database.ErrHostNotFound {
+		AbortWithError(http.StatusNotFound, err)
+	} else if err == database.ErrHostBusy || err == database.ErrConflict {
+		AbortWithError(http.StatusConflict, err)
+	} else if err != nil {
 		AbortWithError(http.StatusInternalServerError, err)
 	} else {
 		c.Data(204, "application/json", make([]byte, 0))
@@ -84,42 +104,67 @@ func DeleteHost(c *gin.Context) {
 }
 
 func EnableHost(c *gin.Context) {
-	id := GetId(c, "id")
+	host := GetHost(c)
+	CheckIfMatch(c, host.Version)
 
-	host, err := database.HostGetById(id)
+	AbortOnWriteError(enableHost(host, "enabled by operator"))
+	SetETag(c, host.Version)
+	c.JSON(http.StatusAccepted, host)
+}
+
+// enableHost enables host and starts it over with no failures.
+func enableHost(host *database.Host, reason string) error {
+	states, history, err := enableChanges(host, reason)
 	if err != nil {
-		AbortWithError(http.StatusInternalServerError, err)
-	} else if host == nil {
-		AbortWithError(http.StatusNotFound, err)
+		return err
 	}
+	return store.HostEnable(host, states, history)
+}
 
-	states, err := database.StateGetAll(host.Id)
+// enableChanges enables host in memory, it returns states reset and history
+// of the transition to save with host.
+func enableChanges(host *database.Host, reason string) ([]*database.HostState, *database.HostStatusHistory, error) {
+	states, err := store.StateGetAll(host.Id)
 	if err != nil {
-		AbortWithError(http.StatusInternalServerError, err)
+		return nil, nil, err
+	}
+	history := &database.HostStatusHistory{
+		HostId:     host.Id,
+		OldStatus:  host.Status,
+		NewStatus:  HostInitialStatus,
+		Reason:     reason,
+		States:     map[string]int{},
+		LeaderName: monitorName(),
+		CreatedAt:  time.Now(),
 	}
 	for _, s := range states {
+		history.States[s.Tag] = s.FailedTimes
 		s.FailedTimes = 0
-		database.StateUpdateFields(s, "failed_times")
 	}
 
 	host.Disabled = false
 	host.Status = HostInitialStatus
-	host.UpdatedAt = time.Now()
-	database.HostUpdateFields(host, "status", "disabled", "updated_at")
-	c.JSON(http.StatusAccepted, host)
+	host.UpdatedAt = history.CreatedAt
+	return states, history, nil
 }
 
 func DisableHost(c *gin.Context) {
-	id := GetId(c, "id")
+	host := GetHost(c)
 
-	host, err := database.HostGetById(id)
-	if err != nil {
-		AbortWithError(http.StatusInternalServerError, err)
-	} else if host == nil {
-		AbortWithError(http.StatusNotFound, err)
-	}
+	CheckIfMatch(c, host.Version)
 
 	host.Disabled = true
-	database.HostUpdateFields(host, "disabled")
+	AbortOnWriteError(store.HostUpdateFields(host, "disabled"))
+	SetETag(c, host.Version)
 	c.JSON(http.StatusAccepted, host)
 }
+
+func GetHostHistory(c *gin.Context) {
+	host := GetHost(c)
+
+	histories, err := store.HostHistoryGetAll(host.Id)
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+	c.JSON(http.StatusOK, histories)
+}
@@ -2,58 +2,95 @@ package api
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"themis/database"
 )
 
+// default ports of supported fencer types
+var fencerPorts = map[string]int{
+	"ipmi":    623,
+	"redfish": 443,
+}
+
+// sort keys of fencers and their columns
+var fencerSortColumns = map[string]string{
+	"id":      "id",
+	"host_id": "host_id",
+	"type":    "type",
+	"host":    "host",
+}
+
 func init() {
-	Router().GET("/fencers", ListFencers)
-	Router().GET("/fencers/:fid", GetFencer)
-	Router().POST("/fencers", CreateFencer)
-	Router().PUT("/fencers/:fid", UpdateFencer)
-	Router().DELETE("/fencers/:fid", DeleteFencer)
+	Router().GET("/fencers", RequireRole(RoleReader), ListFencers)
+	Router().GET("/fencers/:fid", RequireRole(RoleReader), GetFencer)
+	Router().POST("/fencers", RequireRole(RoleAdmin), CreateFencer)
+	Router().PUT("/fencers/:fid", RequireRole(RoleAdmin), UpdateFencer)
+	Router().DELETE("/fencers/:fid", RequireRole(RoleAdmin), DeleteFencer)
 }
 
+// ListFencers lists fencers filtered by host_id and type, see GetPage for
+// paging.
 func ListFencers(c *gin.Context) {
-	fencers, err := database.FencerGetAll()
-	if err != nil {
-		AbortWithError(http.StatusInternalServerError, err)
+	q := &database.FencerQuery{
+		Type: c.Query("type"),
+		Page: GetPage(c, fencerSortColumns),
+	}
+	if hostId := c.Query("host_id"); len(hostId) > 0 {
+		id, err := strconv.Atoi(hostId)
+		if err != nil {
+			AbortWithError(http.StatusBadRequest, ErrInvalidParameter)
+		}
+		q.HostId = id
 	}
 
-	c.JSON(http.StatusOK, fencers)
+	fencers, err := store.FencerFind(q)
+	AbortOnFindError(err)
+	count := SetNextPage(c, q.Page, len(fencers), func(i int) int { return fencers[i].Id })
+	for _, fencer := range fencers {
+		hidePassword(c, fencer)
+	}
+	c.JSON(http.StatusOK, fencers[:count])
 }
 
 func GetFencer(c *gin.Context) {
 	fencerId := GetId(c, "fid")
 
-	fencer, err := database.FencerGetById(fencerId)
+	fencer, err := store.FencerGetById(fencerId)
 	if err != nil {
 		AbortWithError(http.StatusInternalServerError, err)
 	} else if fencer == nil {
-		AbortWithError(http.StatusNotFound, err)
+		AbortWithError(http.StatusNotFound, ErrNotFound)
 	}
 
+	SetETag(c, fencer.Version)
+	hidePassword(c, fencer)
 	c.JSON(http.StatusOK, fencer)
 }
 
+// hidePassword blanks password of fencer unless request is made by admin.
+func hidePassword(c *gin.Context, fencer *database.HostFencer) {
+	if !HasRole(c, RoleAdmin) {
+		fencer.Password = ""
+	}
+}
+
 func CreateFencer(c *gin.Context) {
 	var fencer database.HostFencer
 	ParseBody(c, &fencer)
 
-	host, err := database.HostGetById(fencer.HostId)
+	host, err := store.HostGetById(fencer.HostId)
 	if err != nil {
 		AbortWithError(http.StatusInternalServerError, err)
 	} else if host == nil {
 		AbortWithError(http.StatusBadRequest, ErrNotFound)
 	}
-	if 0 == fencer.Port {
-		fencer.Port = 623
+	if err := checkFencer(&fencer); err != nil {
+		AbortWithError(http.StatusBadRequest, err)
 	}
 
-	// FIXME: validate before insert into database.
-
-	if err := database.FencerInsert(&fencer); err != nil {
+	if err := store.FencerInsert(&fencer); err != nil {
 		AbortWithError(http.StatusNotAcceptable, err)
 	} else {
 		c.JSON(http.StatusCreated, fencer)
@@ -63,27 +100,50 @@ func CreateFencer(c *gin.Context) {
 func UpdateFencer(c *gin.Context) {
 	fencerId := GetId(c, "fid")
 
-	fencer, err := database.FencerGetById(fencerId)
+	fencer, err := store.FencerGetById(fencerId)
 	if err != nil {
 		AbortWithError(http.StatusInternalServerError, err)
 	} else if fencer == nil {
-		AbortWithError(http.StatusNotFound, err)
+		AbortWithError(http.StatusNotFound, ErrNotFound)
 	}
 
+	version := fencer.Version
+	CheckIfMatch(c, version)
 	ParseBody(c, fencer)
-	err = database.FencerUpdate(fencerId, fencer)
-	if err != nil {
-		AbortWithError(http.StatusInternalServerError, err)
-	} else {
-		c.JSON(http.StatusAccepted, fencer)
+	fencer.Id, fencer.Version = fencerId, version
+	if err := checkFencer(fencer); err != nil {
+		AbortWithError(http.StatusBadRequest, err)
+	}
+	err = store.FencerUpdate(fencerId, fencer)
+	if err == database.ErrHostNotFound {
+		AbortWithError(http.StatusBadRequest, err)
 	}
+	AbortOnWriteError(err)
+	SetETag(c, fencer.Version)
+	c.JSON(http.StatusAccepted, fencer)
 }
 
 func DeleteFencer(c *gin.Context) {
-	err := database.FencerDelete(GetId(c, "fid"))
+	err := store.FencerDelete(GetId(c, "fid"), IfMatchVersion(c))
 	if err != nil {
-		AbortWithError(http.StatusInternalServerError, err)
+		AbortOnWriteError(err)
 	} else {
 		c.Data(204, "application/json", make([]byte, 0))
 	}
 }
+
+// checkFencer fills in default type and port of fencer, ipmi unless told
+// otherwise.
+func checkFencer(fencer *database.HostFencer) error {
+	if len(fencer.Type) == 0 {
+		fencer.Type = "ipmi"
+	}
+	port, ok := fencerPorts[fencer.Type]
+	if !ok {
+		return ErrFencerType
+	}
+	if fencer.Port == 0 {
+		fencer.Port = port
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"themis/database"
+)
+
+func TestCreateFencer(t *testing.T) {
+	useMemoryStore(t)
+	host := createHost(t, "node1", "")
+
+	for fencerType, port := range map[string]int{"": 623, "ipmi": 623, "redfish": 443} {
+		fencer := &database.HostFencer{HostId: host.Id, Type: fencerType, Host: "bmc1", Username: "u", Password: "p"}
+		decode(t, serve(t, http.MethodPost, "/fencers", fencer), http.StatusCreated, fencer)
+		if fencer.Port != port || len(fencer.Type) == 0 {
+			t.Errorf("fencer of type %q is %s on port %d", fencerType, fencer.Type, fencer.Port)
+		}
+	}
+	fencer := &database.HostFencer{HostId: host.Id, Type: "redfish", Host: "bmc1", Port: 8443, Username: "u", Password: "p"}
+	decode(t, serve(t, http.MethodPost, "/fencers", fencer), http.StatusCreated, fencer)
+	if fencer.Port != 8443 {
+		t.Errorf("port is changed to %d", fencer.Port)
+	}
+
+	decode(t, serve(t, http.MethodPost, "/fencers", &database.HostFencer{HostId: host.Id, Type: "ssh", Username: "u", Password: "p"}),
+		http.StatusBadRequest, nil)
+	decode(t, serve(t, http.MethodPost, "/fencers", &database.HostFencer{HostId: host.Id + 1, Username: "u", Password: "p"}),
+		http.StatusBadRequest, nil)
+
+	var fencers []*database.HostFencer
+	decode(t, serve(t, http.MethodGet, fmt.Sprintf("/fencers?host_id=%d&type=redfish", host.Id), nil),
+		http.StatusOK, &fencers)
+	if len(fencers) != 2 {
+		t.Errorf("unexpected fencers %v", fencers)
+	}
+	decode(t, serve(t, http.MethodGet, "/fencers?host_id=x", nil), http.StatusBadRequest, nil)
+
+	// fencers of deleted hosts are gone
+	decode(t, serve(t, http.MethodDelete, "/hosts/node1", nil), http.StatusNoContent, nil)
+	decode(t, serve(t, http.MethodGet, "/fencers", nil), http.StatusOK, &fencers)
+	if len(fencers) != 0 {
+		t.Errorf("fencers are left %v", fencers)
+	}
+}
+
+func TestUpdateFencer(t *testing.T) {
+	useMemoryStore(t)
+	host := createHost(t, "node1", "")
+	fencer := &database.HostFencer{HostId: host.Id, Host: "bmc1", Username: "u", Password: "p"}
+	decode(t, serve(t, http.MethodPost, "/fencers", fencer), http.StatusCreated, fencer)
+	path := fmt.Sprintf("/fencers/%d", fencer.Id)
+
+	w := serve(t, http.MethodGet, path, nil)
+	decode(t, w, http.StatusOK, nil)
+	etag := w.Header().Get("ETag")
+
+	fencer.Host = "bmc2"
+	decode(t, serve(t, http.MethodPut, path, fencer, "If-Match", etag), http.StatusAccepted, fencer)
+	if fencer.Host != "bmc2" {
+		t.Errorf("fencer is not updated: %+v", fencer)
+	}
+	decode(t, serve(t, http.MethodPut, path, fencer, "If-Match", etag), http.StatusConflict, nil)
+	decode(t, serve(t, http.MethodDelete, path, nil, "If-Match", etag), http.StatusConflict, nil)
+
+	// version is never taken from clients
+	fencer.Version = 100
+	decode(t, serve(t, http.MethodPut, path, fencer), http.StatusAccepted, fencer)
+	if fencer.Version != 3 {
+		t.Errorf("fencer version is %d", fencer.Version)
+	}
+
+	fencer.HostId = host.Id + 1
+	decode(t, serve(t, http.MethodPut, path, fencer), http.StatusBadRequest, nil)
+
+	decode(t, serve(t, http.MethodDelete, path, nil), http.StatusNoContent, nil)
+	decode(t, serve(t, http.MethodGet, path, nil), http.StatusNotFound, nil)
+}
+
+func TestFencerPasswordHidden(t *testing.T) {
+	useMemoryStore(t)
+	useTokens(t)
+	admin := []string{"Authorization", "Bearer admin"}
+
+	host := &database.Host{Name: "node1"}
+	decode(t, serve(t, http.MethodPost, "/hosts", host, admin...), http.StatusCreated, host)
+	fencer := &database.HostFencer{HostId: host.Id, Host: "bmc1", Username: "u", Password: "secret"}
+	decode(t, serve(t, http.MethodPost, "/fencers", fencer, admin...), http.StatusCreated, fencer)
+	path := fmt.Sprintf("/fencers/%d", fencer.Id)
+
+	for token, password := range map[string]string{"reader": "", "operator": "", "admin": "secret"} {
+		var got database.HostFencer
+		decode(t, serve(t, http.MethodGet, path, nil, "Authorization", "Bearer "+token), http.StatusOK, &got)
+		if got.Password != password {
+			t.Errorf("%s gets password %q", token, got.Password)
+		}
+		var fencers []*database.HostFencer
+		decode(t, serve(t, http.MethodGet, "/fencers", nil, "Authorization", "Bearer "+token), http.StatusOK, &fencers)
+		if len(fencers) != 1 || fencers[0].Password != password {
+			t.Errorf("%s lists password %q", token, fencers[0].Password)
+		}
+	}
+}
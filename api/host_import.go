@@ -0,0 +1,201 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"themis/database"
+)
+
+// HostImportRow is a host to onboard with its fencer, fencer is left out if
+// none of its fields is given.
+type HostImportRow struct {
+	// line in file the row comes from, only used to report errors
+	Line           int    `json:"line"`
+	Name           string `json:"name"`
+	Group          string `json:"group"`
+	FencerType     string `json:"fencer_type"`
+	FencerHost     string `json:"fencer_host"`
+	FencerPort     int    `json:"fencer_port"`
+	FencerUsername string `json:"fencer_username"`
+	FencerPassword string `json:"fencer_password"`
+}
+
+type HostImportRowResult struct {
+	Line     int    `json:"line"`
+	Name     string `json:"name"`
+	HostId   int    `json:"host_id,omitempty"`
+	FencerId int    `json:"fencer_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HostImportResult tells what happened to every row, nothing is created if
+// any row is invalid or can't be saved.
+type HostImportResult struct {
+	DryRun   bool                  `json:"dry_run"`
+	Imported bool                  `json:"imported"`
+	Rows     []HostImportRowResult `json:"rows"`
+}
+
+func init() {
+	Router().POST("/hosts/import", RequireRole(RoleAdmin), ImportHosts)
+}
+
+// ImportHosts creates hosts and their fencers in bulk. All rows are
+// validated first, then all hosts are created with their fencers in one
+// transaction.
+func ImportHosts(c *gin.Context) {
+	var rows []HostImportRow
+	ParseBody(c, &rows)
+	dryRun := c.Query("dry_run") == "true"
+
+	existHosts, err := hostNameSet()
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+
+	result := &HostImportResult{DryRun: dryRun, Rows: make([]HostImportRowResult, 0, len(rows))}
+	lines := map[string]int{}
+	valid := true
+	for i := range rows {
+		row := &rows[i]
+		errs := validateImportRow(row, existHosts, lines)
+		if len(errs) > 0 {
+			valid = false
+		}
+		result.Rows = append(result.Rows, HostImportRowResult{
+			Line:  row.Line,
+			Name:  row.Name,
+			Error: strings.Join(errs, "; "),
+		})
+	}
+	if !valid || dryRun {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	batch := &database.InventoryChanges{Hosts: make([]*database.HostImport, 0, len(rows))}
+	for i := range rows {
+		batch.Hosts = append(batch.Hosts, newHostImport(&rows[i]))
+	}
+	if err := store.InventorySave(batch); err != nil {
+		rejectRows(result, err)
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	result.Imported = true
+	for i, change := range batch.Hosts {
+		result.Rows[i].HostId = change.Host.Id
+		if len(change.NewFencers) > 0 {
+			result.Rows[i].FencerId = change.NewFencers[0].Id
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func hostNameSet() (map[string]bool, error) {
+	hosts, err := store.HostGetAll()
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, host := range hosts {
+		names[host.Name] = true
+	}
+	return names, nil
+}
+
+// rejectRows tells why nothing is imported, rows whose hosts have been
+// created by others since they were validated are blamed if any.
+func rejectRows(result *HostImportResult, err error) {
+	existHosts, _ := hostNameSet()
+	blamed := false
+	for i := range result.Rows {
+		if existHosts[result.Rows[i].Name] {
+			result.Rows[i].Error = "host already exists"
+			blamed = true
+		}
+	}
+	if blamed {
+		return
+	}
+	for i := range result.Rows {
+		result.Rows[i].Error = fmt.Sprintf("nothing is imported: %s", err)
+	}
+}
+
+// validateImportRow returns all problems of row, lines tells where host
+// names are seen in rows before.
+func validateImportRow(row *HostImportRow, existHosts map[string]bool, lines map[string]int) []string {
+	errs := make([]string, 0)
+	row.Name = strings.TrimSpace(row.Name)
+	if len(row.Name) == 0 {
+		errs = append(errs, "name is required")
+	} else if existHosts[row.Name] {
+		errs = append(errs, "host already exists")
+	} else if line, ok := lines[row.Name]; ok {
+		errs = append(errs, fmt.Sprintf("host is duplicated with line %d", line))
+	} else {
+		lines[row.Name] = row.Line
+	}
+
+	if !row.hasFencer() {
+		return errs
+	}
+	fencer := row.fencer(0)
+	if err := checkFencer(fencer); err != nil {
+		errs = append(errs, err.Error())
+	}
+	row.FencerType, row.FencerPort = fencer.Type, fencer.Port
+	if row.FencerPort < 0 || row.FencerPort > 65535 {
+		errs = append(errs, "fencer port is out of range")
+	}
+	if len(row.FencerHost) == 0 {
+		errs = append(errs, "fencer host is required")
+	}
+	if len(row.FencerUsername) == 0 {
+		errs = append(errs, "fencer username is required")
+	}
+	if len(row.FencerPassword) == 0 {
+		errs = append(errs, "fencer password is required")
+	}
+	return errs
+}
+
+func (row *HostImportRow) hasFencer() bool {
+	return len(row.FencerType) > 0 || len(row.FencerHost) > 0 || row.FencerPort > 0 ||
+		len(row.FencerUsername) > 0 || len(row.FencerPassword) > 0
+}
+
+func (row *HostImportRow) fencer(hostId int) *database.HostFencer {
+	return &database.HostFencer{
+		HostId:   hostId,
+		Type:     row.FencerType,
+		Host:     row.FencerHost,
+		Port:     row.FencerPort,
+		Username: row.FencerUsername,
+		Password: row.FencerPassword,
+	}
+}
+
+// newHostImport returns changes creating host of row together with its
+// fencer.
+func newHostImport(row *HostImportRow) *database.HostImport {
+	change := &database.HostImport{
+		Host: &database.Host{
+			Name:      row.Name,
+			Group:     row.Group,
+			Status:    HostInitialStatus,
+			UpdatedAt: time.Now(),
+		},
+		New: true,
+	}
+	if row.hasFencer() {
+		change.NewFencers = append(change.NewFencers, row.fencer(0))
+	}
+	return change
+}
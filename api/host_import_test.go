@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"themis/database"
+)
+
+func TestImportHosts(t *testing.T) {
+	s := useMemoryStore(t)
+	createHost(t, "node0", "")
+
+	rows := []HostImportRow{
+		{Line: 1, Name: "node1", Group: "g1", FencerHost: "bmc1", FencerUsername: "u", FencerPassword: "p"},
+		{Line: 2, Name: "node2", FencerType: "redfish", FencerHost: "bmc2", FencerUsername: "u", FencerPassword: "p"},
+		{Line: 3, Name: " node3 "},
+	}
+	var result HostImportResult
+	decode(t, serve(t, http.MethodPost, "/hosts/import?dry_run=true", rows), http.StatusOK, &result)
+	if !result.DryRun || result.Imported || len(result.Rows) != 3 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	for _, row := range result.Rows {
+		if len(row.Error) > 0 || row.HostId > 0 {
+			t.Errorf("unexpected row %+v", row)
+		}
+	}
+	if hosts, _ := s.HostGetAll(); len(hosts) != 1 {
+		t.Fatalf("hosts are created in dry run: %v", hosts)
+	}
+
+	// nothing is created if any row is invalid
+	bad := append(rows, HostImportRow{Line: 4, Name: "node0"}, HostImportRow{Line: 5, Name: "node1"},
+		HostImportRow{Line: 6, Name: "node6", FencerType: "ssh"})
+	decode(t, serve(t, http.MethodPost, "/hosts/import", bad), http.StatusOK, &result)
+	if result.Imported {
+		t.Errorf("invalid rows are imported")
+	}
+	for i, expected := range []string{"", "", "", "host already exists", "host is duplicated with line 1",
+		"fencer type must be ipmi or redfish.; fencer host is required; fencer username is required; fencer password is required"} {
+		if result.Rows[i].Error != expected {
+			t.Errorf("line %d: unexpected error %q", result.Rows[i].Line, result.Rows[i].Error)
+		}
+	}
+	if hosts, _ := s.HostGetAll(); len(hosts) != 1 {
+		t.Fatalf("hosts are created from invalid rows: %v", hosts)
+	}
+
+	decode(t, serve(t, http.MethodPost, "/hosts/import", rows), http.StatusOK, &result)
+	if !result.Imported {
+		t.Fatalf("hosts are not imported: %+v", result)
+	}
+	for i, port := range []int{623, 443, 0} {
+		row := result.Rows[i]
+		if len(row.Error) > 0 || row.HostId == 0 || (port > 0) != (row.FencerId > 0) {
+			t.Errorf("unexpected row %+v", row)
+			continue
+		}
+		host, _ := s.HostGetById(row.HostId)
+		if host == nil || host.Name != rows[i].Name && host.Name != "node3" || host.Status != HostInitialStatus {
+			t.Errorf("unexpected host %+v", host)
+		}
+		fencers, _ := s.FencerGetByHost(row.HostId)
+		if port == 0 && len(fencers) != 0 || port > 0 && (len(fencers) != 1 || fencers[0].Port != port) {
+			t.Errorf("unexpected fencers %v of host %s", fencers, row.Name)
+		}
+	}
+}
+
+// racingStore creates host racer right before inventory is saved, as if it
+// were created by others after rows are validated.
+type racingStore struct {
+	database.Store
+	racer string
+}
+
+func (s *racingStore) InventorySave(c *database.InventoryChanges) error {
+	if err := s.Store.HostInsert(&database.Host{Name: s.racer}); err != nil {
+		return err
+	}
+	return s.Store.InventorySave(c)
+}
+
+func TestImportHostsAllOrNothing(t *testing.T) {
+	s := useMemoryStore(t)
+	RegisterStore(&racingStore{Store: s, racer: "node2"})
+
+	rows := []HostImportRow{
+		{Line: 1, Name: "node1", FencerHost: "bmc1", FencerUsername: "u", FencerPassword: "p"},
+		{Line: 2, Name: "node2"},
+		{Line: 3, Name: "node3"},
+	}
+	var result HostImportResult
+	decode(t, serve(t, http.MethodPost, "/hosts/import", rows), http.StatusOK, &result)
+	if result.Imported {
+		t.Errorf("hosts are imported although node2 is created by others")
+	}
+	for i, expected := range []string{"", "host already exists", ""} {
+		if result.Rows[i].Error != expected || result.Rows[i].HostId > 0 {
+			t.Errorf("unexpected row %+v", result.Rows[i])
+		}
+	}
+	if hosts, _ := s.HostGetAll(); len(hosts) != 1 || hosts[0].Name != "node2" {
+		t.Errorf("unexpected hosts %v", hosts)
+	}
+	if fencers, _ := s.FencerGetAll(); len(fencers) != 0 {
+		t.Errorf("fencers are created %v", fencers)
+	}
+}
@@ -8,10 +8,10 @@ import (
 )
 
 func init() {
-	Router().POST("/hosts/:id/states", CreateState)
-	Router().GET("/hosts/:id/states", GetHostStates)
-	Router().PUT("/hosts/:id/states/:sid", UpdateState)
-	Router().DELETE("/hosts/:id/states/:sid", DeleteState)
+	Router().POST("/hosts/:id/states", RequireRole(RoleOperator), CreateState)
+	Router().GET("/hosts/:id/states", RequireRole(RoleReader), GetHostStates)
+	Router().PUT("/hosts/:id/states/:sid", RequireRole(RoleOperator), UpdateState)
+	Router().DELETE("/hosts/:id/states/:sid", RequireRole(RoleOperator), DeleteState)
 }
 
 func CreateState(c *gin.Context) {
@@ -21,7 +21,7 @@ func CreateState(c *gin.Context) {
 	host := GetHost(c)
 	state.HostId = host.Id
 
-	states, err := database.StateGetAll(host.Id)
+	states, err := store.StateGetAll(host.Id)
 	if err != nil {
 		AbortWithError(http.StatusInternalServerError, err)
 	}
@@ -31,7 +31,7 @@ func CreateState(c *gin.Context) {
 		}
 	}
 
-	if err := database.StateInsert(&state); err != nil {
+	if err := store.StateInsert(&state); err != nil {
 		AbortWithError(http.StatusNotAcceptable, err)
 	} else {
 		c.JSON(http.StatusCreated, state)
@@ -41,7 +41,7 @@ func CreateState(c *gin.Context) {
 func GetHostStates(c *gin.Context) {
 	host := GetHost(c)
 
-	states, err := database.StateGetAll(host.Id)
+	states, err := store.StateGetAll(host.Id)
 	if err != nil {
 		AbortWithError(http.StatusInternalServerError, err)
 	}
@@ -59,29 +59,37 @@ func GetHostStates(c *gin.Context) {
 	}
 }
 
-func UpdateState(c *gin.Context) {
-	stateId := GetId(c, "sid")
+// getHostState returns state of host in path.
+func getHostState(c *gin.Context) *database.HostState {
+	host := GetHost(c)
 
-	state, err := database.StateGetById(stateId)
+	state, err := store.StateGetById(GetId(c, "sid"))
 	if err != nil {
 		AbortWithError(http.StatusInternalServerError, err)
-	} else if state == nil {
-		AbortWithError(http.StatusNotFound, err)
+	} else if state == nil || state.HostId != host.Id {
+		AbortWithError(http.StatusNotFound, ErrNotFound)
 	}
+	return state
+}
 
+func UpdateState(c *gin.Context) {
+	state := getHostState(c)
+	stateId, hostId, version := state.Id, state.HostId, state.Version
+
+	CheckIfMatch(c, state.Version)
 	ParseBody(c, state)
-	err = database.StateUpdate(stateId, state)
-	if err != nil {
-		AbortWithError(http.StatusInternalServerError, err)
-	} else {
-		c.JSON(http.StatusAccepted, state)
-	}
+	state.Id, state.HostId, state.Version = stateId, hostId, version
+	AbortOnWriteError(store.StateUpdate(stateId, state))
+	SetETag(c, state.Version)
+	c.JSON(http.StatusAccepted, state)
 }
 
 func DeleteState(c *gin.Context) {
-	err := database.StateDelete(GetId(c, "sid"))
+	state := getHostState(c)
+
+	err := store.StateDelete(state.Id, IfMatchVersion(c))
 	if err != nil {
-		AbortWithError(http.StatusInternalServerError, err)
+		AbortOnWriteError(err)
 	} else {
 		c.Data(204, "application/json", make([]byte, 0))
 	}
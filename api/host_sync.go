@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HostSyncCreate = "create"
+	HostSyncUpdate = "update"
+	HostSyncOrphan = "orphan"
+)
+
+var (
+	ErrSyncUnavailable = errors.New("host sync is not available.")
+
+	hostSyncer HostSyncer
+)
+
+// HostSyncer synchronizes hosts with an external inventory such as nova.
+type HostSyncer interface {
+	SyncHosts(dryRun bool) (*HostSyncResult, error)
+}
+
+type HostSyncChange struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Detail string `json:"detail"`
+}
+
+type HostSyncResult struct {
+	DryRun  bool             `json:"dry_run"`
+	Changes []HostSyncChange `json:"changes"`
+}
+
+func RegisterHostSyncer(syncer HostSyncer) {
+	hostSyncer = syncer
+}
+
+func init() {
+	Router().POST("/hosts/sync", RequireRole(RoleOperator), SyncHosts)
+}
+
+func SyncHosts(c *gin.Context) {
+	if hostSyncer == nil {
+		AbortWithError(http.StatusNotImplemented, ErrSyncUnavailable)
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	result, err := hostSyncer.SyncHosts(dryRun)
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+	c.JSON(http.StatusOK, result)
+}
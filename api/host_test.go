@@ -0,0 +1,186 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"themis/database"
+)
+
+func createHost(t *testing.T, name, group string) *database.Host {
+	t.Helper()
+	host := &database.Host{Name: name, Group: group}
+	decode(t, serve(t, http.MethodPost, "/hosts", host), http.StatusCreated, host)
+	return host
+}
+
+func TestHostCRUD(t *testing.T) {
+	useMemoryStore(t)
+
+	host := createHost(t, "node1", "g1")
+	if host.Id == 0 || host.Status != HostInitialStatus {
+		t.Fatalf("unexpected host %+v", host)
+	}
+
+	var got database.Host
+	w := serve(t, http.MethodGet, "/hosts/node1", nil)
+	decode(t, w, http.StatusOK, &got)
+	etag := w.Header().Get("ETag")
+	if got.Id != host.Id || len(etag) == 0 {
+		t.Fatalf("unexpected host %+v, etag %q", got, etag)
+	}
+	decode(t, serve(t, http.MethodGet, "/hosts/by-name/node1", nil), http.StatusOK, &got)
+	decode(t, serve(t, http.MethodGet, "/hosts/by-name/node2", nil), http.StatusNotFound, nil)
+	decode(t, serve(t, http.MethodGet, "/hosts/100", nil), http.StatusNotFound, nil)
+
+	// updates are rejected once host is changed by others
+	got.Group = "g2"
+	w = serve(t, http.MethodPut, "/hosts/node1", &got, "If-Match", etag)
+	decode(t, w, http.StatusAccepted, &got)
+	if got.Group != "g2" || w.Header().Get("ETag") == etag {
+		t.Errorf("unexpected host %+v, etag %q", got, w.Header().Get("ETag"))
+	}
+	got.Group = "g3"
+	decode(t, serve(t, http.MethodPut, "/hosts/node1", &got, "If-Match", etag), http.StatusConflict, nil)
+	decode(t, serve(t, http.MethodPost, "/hosts/node1/disable", nil, "If-Match", etag), http.StatusConflict, nil)
+	decode(t, serve(t, http.MethodDelete, "/hosts/node1", nil, "If-Match", etag), http.StatusConflict, nil)
+	decode(t, serve(t, http.MethodPut, "/hosts/node1", &got, "If-Match", "bad"), http.StatusBadRequest, nil)
+
+	decode(t, serve(t, http.MethodPost, "/hosts/node1/disable", nil), http.StatusAccepted, &got)
+	if !got.Disabled {
+		t.Errorf("host is not disabled")
+	}
+	decode(t, serve(t, http.MethodPost, "/hosts/node1/enable", nil), http.StatusAccepted, &got)
+	if got.Disabled || got.Status != HostInitialStatus {
+		t.Errorf("host is %s, disabled %v", got.Status, got.Disabled)
+	}
+	var histories []*database.HostStatusHistory
+	decode(t, serve(t, http.MethodGet, "/hosts/node1/history", nil), http.StatusOK, &histories)
+	if len(histories) != 1 || histories[0].Reason != "enabled by operator" {
+		t.Errorf("unexpected histories %v", histories)
+	}
+
+	decode(t, serve(t, http.MethodDelete, "/hosts/node1", nil), http.StatusNoContent, nil)
+	decode(t, serve(t, http.MethodGet, "/hosts/node1", nil), http.StatusNotFound, nil)
+}
+
+func TestUpdateHostOwnedFields(t *testing.T) {
+	s := useMemoryStore(t)
+	host := createHost(t, "node1", "g1")
+
+	// status, flags and versions are never taken from clients
+	body := map[string]interface{}{"name": "node2", "group": "g2", "status": "active", "disabled": true,
+		"orphaned": true, "nova_disabled": true, "version": 100}
+	var got database.Host
+	decode(t, serve(t, http.MethodPut, "/hosts/node1", body), http.StatusAccepted, &got)
+	saved, _ := s.HostGetById(host.Id)
+	if saved.Name != "node2" || saved.Group != "g2" || saved.Status != HostInitialStatus || saved.Disabled ||
+		saved.Orphaned || saved.NovaDisabled || saved.Version != 2 || got.Version != 2 {
+		t.Errorf("unexpected host %+v", saved)
+	}
+
+	var state database.HostState
+	path := fmt.Sprintf("/hosts/%d/states", host.Id)
+	decode(t, serve(t, http.MethodPost, path, &database.HostState{Tag: "network"}), http.StatusCreated, &state)
+	body = map[string]interface{}{"tag": "network", "failed_times": 0, "host_id": host.Id + 1, "version": 100}
+	decode(t, serve(t, http.MethodPut, fmt.Sprintf("%s/%d", path, state.Id), body), http.StatusAccepted, &state)
+	if saved, _ := s.StateGetById(state.Id); saved.HostId != host.Id || saved.Version != 2 {
+		t.Errorf("unexpected state %+v", saved)
+	}
+}
+
+func hostNames(hosts []*database.Host) string {
+	names := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		names = append(names, host.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestListHosts(t *testing.T) {
+	useMemoryStore(t)
+	for _, name := range []string{"node1", "node2", "node3", "other1"} {
+		createHost(t, name, "g1")
+	}
+	createHost(t, "node4", "g2")
+	decode(t, serve(t, http.MethodPost, "/hosts/node2/disable", nil), http.StatusAccepted, nil)
+
+	for query, expected := range map[string]string{
+		"":                              "node1,node2,node3,other1,node4",
+		"?name_prefix=node&group=g1":    "node1,node2,node3",
+		"?disabled=true":                "node2",
+		"?disabled=false&group=g1":      "node1,node3,other1",
+		"?sort=name:desc":               "other1,node4,node3,node2,node1",
+		"?status=active":                "",
+		"?status=initializing&group=g2": "node4",
+	} {
+		var hosts []*database.Host
+		decode(t, serve(t, http.MethodGet, "/hosts"+query, nil), http.StatusOK, &hosts)
+		if names := hostNames(hosts); names != expected {
+			t.Errorf("hosts%s are %s, not %s", query, names, expected)
+		}
+	}
+
+	// pages are linked until the last one
+	path, names := "/hosts?limit=2&sort=name", []string{}
+	for len(path) > 0 {
+		var hosts []*database.Host
+		w := serve(t, http.MethodGet, path, nil)
+		decode(t, w, http.StatusOK, &hosts)
+		names = append(names, hostNames(hosts))
+		path = strings.TrimSuffix(strings.TrimPrefix(w.Header().Get("Link"), "<"), `>; rel="next"`)
+		if len(names) > 5 {
+			t.Fatalf("too many pages %v", names)
+		}
+	}
+	if strings.Join(names, "|") != "node1,node2|node3,node4|other1" {
+		t.Errorf("unexpected pages %v", names)
+	}
+
+	for _, query := range []string{"?sort=password", "?sort=name:up", "?limit=0", "?marker=x"} {
+		decode(t, serve(t, http.MethodGet, "/hosts"+query, nil), http.StatusBadRequest, nil)
+	}
+}
+
+func TestHostHistory(t *testing.T) {
+	s := useMemoryStore(t)
+	host := createHost(t, "node1", "g1")
+	other := createHost(t, "node2", "g1")
+	createHost(t, "node3", "g1")
+	for _, status := range []string{"active", "checking"} {
+		old := host.Status
+		host.Status = status
+		history := &database.HostStatusHistory{HostId: host.Id, OldStatus: old, NewStatus: status,
+			States: map[string]int{"network": 1}, LeaderName: "monitor1", CreatedAt: time.Now()}
+		if err := s.HostUpdateStatus(host, history); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.HostUpdateStatus(other, &database.HostStatusHistory{HostId: other.Id, NewStatus: "active"})
+
+	// histories of host are listed by id or name, latest first
+	useTokens(t)
+	for _, path := range []string{"/hosts/node1/history", fmt.Sprintf("/hosts/%d/history", host.Id)} {
+		var histories []*database.HostStatusHistory
+		decode(t, serve(t, http.MethodGet, path, nil, "Authorization", "Bearer reader"), http.StatusOK, &histories)
+		if len(histories) != 2 || histories[0].OldStatus != "active" || histories[0].NewStatus != "checking" ||
+			histories[1].NewStatus != "active" || histories[0].LeaderName != "monitor1" ||
+			histories[0].States["network"] != 1 {
+			t.Errorf("unexpected histories of %s: %+v", path, histories)
+		}
+	}
+	decode(t, serve(t, http.MethodGet, "/hosts/node1/history", nil), http.StatusUnauthorized, nil)
+	decode(t, serve(t, http.MethodGet, "/hosts/node4/history", nil, "Authorization", "Bearer reader"),
+		http.StatusNotFound, nil)
+
+	// hosts without transitions have an empty history
+	var histories []*database.HostStatusHistory
+	w := serve(t, http.MethodGet, "/hosts/node3/history", nil, "Authorization", "Bearer reader")
+	decode(t, w, http.StatusOK, &histories)
+	if len(histories) != 0 || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("unexpected histories %s", w.Body.String())
+	}
+}
@@ -0,0 +1,538 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"themis/database"
+)
+
+// InventoryVersion is the version of inventory format, bumped on every
+// incompatible change.
+const InventoryVersion = 1
+
+const (
+	InventoryCreate = "create"
+	InventoryUpdate = "update"
+	InventoryDelete = "delete"
+)
+
+var (
+	ErrInventoryVersion  = errors.New("unsupported inventory version.")
+	ErrDuplicatedHost    = errors.New("host name must be unique in inventory.")
+	ErrDuplicatedGroup   = errors.New("group name must be unique in inventory.")
+	ErrPolicyStep        = errors.New("recovery step type must be disable-service, evacuate, kubernetes, webhook or script.")
+	ErrStepNotConfigured = errors.New("webhook and script recovery steps must be configured in monitors first.")
+	ErrPasswordRequired  = errors.New("password is required by new fencer.")
+	ErrRedactRequired    = errors.New("role admin is required to export passwords, export with redact.")
+
+	groups []InventoryGroup
+
+	// types of recovery steps and what they require
+	policyStepTypes = map[string]string{
+		"disable-service": "",
+		"evacuate":        "",
+		"kubernetes":      "",
+		"webhook":         "url",
+		"script":          "command",
+	}
+)
+
+// Inventory is everything needed to rebuild hosts of a themis deployment.
+type Inventory struct {
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exported_at"`
+	Redacted   bool             `json:"redacted"`
+	Hosts      []InventoryHost  `json:"hosts"`
+	Groups     []InventoryGroup `json:"groups"`
+}
+
+type InventoryHost struct {
+	Name     string            `json:"name"`
+	Group    string            `json:"group"`
+	Disabled bool              `json:"disabled"`
+	States   []string          `json:"states"`
+	Fencers  []InventoryFencer `json:"fencers"`
+}
+
+// InventoryFencer is identified by type and host within its host, empty
+// password keeps the current one.
+type InventoryFencer struct {
+	Type     string `json:"type"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// InventoryGroup is a host group with its recovery policy.
+type InventoryGroup struct {
+	Name   string                `json:"name"`
+	Policy []InventoryPolicyStep `json:"policy"`
+}
+
+type InventoryPolicyStep struct {
+	Type    string `json:"type"`
+	Name    string `json:"name,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Command string `json:"command,omitempty"`
+	Timeout int    `json:"timeout,omitempty"`
+}
+
+type InventoryChange struct {
+	// host, state, fencer or group
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Detail string `json:"detail"`
+	Error  string `json:"error,omitempty"`
+}
+
+// InventoryResult tells what an import changes, nothing is changed if any
+// change is invalid.
+type InventoryResult struct {
+	DryRun   bool              `json:"dry_run"`
+	Imported bool              `json:"imported"`
+	Changes  []InventoryChange `json:"changes"`
+}
+
+// RegisterGroups tells recovery policies of host groups configured in
+// monitors.
+func RegisterGroups(g []InventoryGroup) {
+	groups = g
+}
+
+func init() {
+	Router().GET("/inventory", RequireRole(RoleReader), ExportInventory)
+	Router().POST("/inventory", RequireRole(RoleAdmin), ImportInventory)
+}
+
+func ExportInventory(c *gin.Context) {
+	redact := c.Query("redact") == "true"
+	if !redact && !HasRole(c, RoleAdmin) {
+		AbortWithError(http.StatusForbidden, ErrRedactRequired)
+	}
+
+	hosts, err := store.HostGetAll()
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+	allStates, err := store.StateGetAllHosts()
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+	fencers, err := store.FencerGetAll()
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+	stored, err := store.RecoveryGroupGetAll()
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+	hostFencers := map[int][]InventoryFencer{}
+	for _, f := range fencers {
+		fencer := InventoryFencer{
+			Type:     f.Type,
+			Host:     f.Host,
+			Port:     f.Port,
+			Username: f.Username,
+			Password: f.Password,
+		}
+		if redact {
+			fencer.Password = ""
+		}
+		hostFencers[f.HostId] = append(hostFencers[f.HostId], fencer)
+	}
+
+	inventory := &Inventory{
+		Version:    InventoryVersion,
+		ExportedAt: time.Now(),
+		Redacted:   redact,
+		Hosts:      make([]InventoryHost, 0, len(hosts)),
+		Groups:     currentGroups(stored),
+	}
+	for _, h := range hosts {
+		host := InventoryHost{
+			Name:     h.Name,
+			Group:    h.Group,
+			Disabled: h.Disabled,
+			States:   make([]string, 0),
+			Fencers:  hostFencers[h.Id],
+		}
+		for _, s := range allStates[h.Id] {
+			host.States = append(host.States, s.Tag)
+		}
+		if host.Fencers == nil {
+			host.Fencers = make([]InventoryFencer, 0)
+		}
+		inventory.Hosts = append(inventory.Hosts, host)
+	}
+	c.JSON(http.StatusOK, inventory)
+}
+
+// ImportInventory upserts hosts by name, together with their states and
+// fencers, and saves recovery policies of groups which differ from the ones
+// in effect. With prune, whatever absent from inventory is deleted. All
+// changes are saved in one transaction, running it twice makes no change
+// the second time.
+func ImportInventory(c *gin.Context) {
+	var inventory Inventory
+	ParseBody(c, &inventory)
+	if inventory.Version < 1 || inventory.Version > InventoryVersion {
+		AbortWithError(http.StatusBadRequest, ErrInventoryVersion)
+	}
+	names := map[string]bool{}
+	for _, h := range inventory.Hosts {
+		if len(h.Name) == 0 {
+			AbortWithError(http.StatusBadRequest, ErrInvalidParameter)
+		} else if names[h.Name] {
+			AbortWithError(http.StatusBadRequest, ErrDuplicatedHost)
+		}
+		names[h.Name] = true
+		for j := range h.Fencers {
+			f := &h.Fencers[j]
+			fencer := database.HostFencer{Type: f.Type, Port: f.Port}
+			if err := checkFencer(&fencer); err != nil {
+				AbortWithError(http.StatusBadRequest, err)
+			}
+			f.Type, f.Port = fencer.Type, fencer.Port
+		}
+	}
+	groupNames := map[string]bool{}
+	for _, g := range inventory.Groups {
+		if len(g.Name) == 0 {
+			AbortWithError(http.StatusBadRequest, ErrInvalidParameter)
+		} else if groupNames[g.Name] {
+			AbortWithError(http.StatusBadRequest, ErrDuplicatedGroup)
+		}
+		groupNames[g.Name] = true
+		for _, step := range g.Policy {
+			if err := checkPolicyStep(&step); err != nil {
+				AbortWithError(http.StatusBadRequest, err)
+			}
+		}
+	}
+
+	im := &importer{
+		dryRun:  c.Query("dry_run") == "true",
+		prune:   c.Query("prune") == "true",
+		changes: make([]InventoryChange, 0),
+	}
+	hosts, err := store.HostGetAll()
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+	existHosts := map[string]*database.Host{}
+	for _, host := range hosts {
+		existHosts[host.Name] = host
+	}
+
+	for i := range inventory.Hosts {
+		if err := im.importHost(&inventory.Hosts[i], existHosts[inventory.Hosts[i].Name]); err != nil {
+			AbortWithError(http.StatusInternalServerError, err)
+		}
+	}
+	if im.prune {
+		for _, host := range hosts {
+			if !names[host.Name] {
+				im.record("host", host.Name, InventoryDelete, "absent from inventory")
+				im.batch.DeleteHosts = append(im.batch.DeleteHosts, host.Id)
+			}
+		}
+	}
+	stored, err := store.RecoveryGroupGetAll()
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+	im.importGroups(inventory.Groups, stored)
+
+	result := &InventoryResult{DryRun: im.dryRun, Changes: im.changes}
+	if !im.dryRun && !im.invalid {
+		err := store.InventorySave(&im.batch)
+		if err == database.ErrHostNotFound || err == database.ErrHostBusy {
+			AbortWithError(http.StatusConflict, err)
+		}
+		AbortOnWriteError(err)
+		result.Imported = true
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// checkPolicyStep fails if step can't be executed by monitors. Webhooks
+// and scripts run whatever they are given on monitors, so only the ones
+// configured in monitors can be imported.
+func checkPolicyStep(step *InventoryPolicyStep) error {
+	required, ok := policyStepTypes[step.Type]
+	if !ok {
+		return ErrPolicyStep
+	} else if required == "url" && len(step.URL) == 0 || required == "command" && len(step.Command) == 0 {
+		return fmt.Errorf("%s is required by recovery step %s.", required, step.Type)
+	} else if len(required) > 0 && !configuredStep(step) {
+		return ErrStepNotConfigured
+	} else if step.Timeout < 0 {
+		return ErrInvalidParameter
+	}
+	return nil
+}
+
+// configuredStep tells if a step running the same webhook or script is
+// configured in monitors.
+func configuredStep(step *InventoryPolicyStep) bool {
+	for _, g := range groups {
+		for _, s := range g.Policy {
+			if s.Type == step.Type && s.URL == step.URL && s.Command == step.Command {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// importer records changes made by an import and collects them in one
+// batch, nothing is changed on dry run or if any change is invalid.
+type importer struct {
+	dryRun  bool
+	prune   bool
+	changes []InventoryChange
+	batch   database.InventoryChanges
+	invalid bool
+}
+
+func (im *importer) record(kind, name, action, detail string) {
+	im.changes = append(im.changes, InventoryChange{Kind: kind, Name: name, Action: action, Detail: detail})
+}
+
+// reject records a change which can't be made, so that nothing is saved.
+func (im *importer) reject(kind, name, action, detail string, err error) {
+	im.changes = append(im.changes, InventoryChange{Kind: kind, Name: name, Action: action, Detail: detail,
+		Error: err.Error()})
+	im.invalid = true
+}
+
+func (im *importer) importHost(h *InventoryHost, host *database.Host) error {
+	changes := len(im.changes)
+	change := &database.HostImport{Host: host}
+	if host == nil {
+		change.New = true
+		change.Host = &database.Host{
+			Name:      h.Name,
+			Group:     h.Group,
+			Status:    HostInitialStatus,
+			Disabled:  h.Disabled,
+			UpdatedAt: time.Now(),
+		}
+		im.record("host", h.Name, InventoryCreate, "")
+	} else if err := im.updateHost(h, change); err != nil {
+		return err
+	}
+
+	if err := im.importStates(h, change); err != nil {
+		return err
+	}
+	if err := im.importFencers(h, change); err != nil {
+		return err
+	}
+	if len(im.changes) > changes {
+		im.batch.Hosts = append(im.batch.Hosts, change)
+	}
+	return nil
+}
+
+func (im *importer) updateHost(h *InventoryHost, change *database.HostImport) error {
+	host := change.Host
+	if host.Group != h.Group {
+		im.record("host", h.Name, InventoryUpdate, fmt.Sprintf("group %q -> %q", host.Group, h.Group))
+		host.Group = h.Group
+		change.Cols = append(change.Cols, "host_group")
+	}
+	if host.Disabled && !h.Disabled {
+		states, history, err := enableChanges(host, "enabled by import")
+		if err != nil {
+			return err
+		}
+		im.record("host", h.Name, InventoryUpdate, "enable")
+		change.States, change.History = states, history
+		change.Cols = append(change.Cols, "status", "disabled", "updated_at")
+	} else if !host.Disabled && h.Disabled {
+		im.record("host", h.Name, InventoryUpdate, "disable")
+		host.Disabled = true
+		change.Cols = append(change.Cols, "disabled")
+	}
+	return nil
+}
+
+func (im *importer) importStates(h *InventoryHost, change *database.HostImport) error {
+	host := change.Host
+	states := make([]*database.HostState, 0)
+	if !change.New {
+		var err error
+		if states, err = store.StateGetAll(host.Id); err != nil {
+			return err
+		}
+	}
+	tags := map[string]bool{}
+	for _, tag := range h.States {
+		tags[tag] = true
+	}
+	existTags := map[string]bool{}
+	for _, state := range states {
+		existTags[state.Tag] = true
+		if !tags[state.Tag] && im.prune {
+			im.record("state", h.Name+"/"+state.Tag, InventoryDelete, "absent from inventory")
+			change.DeleteStates = append(change.DeleteStates, state.Id)
+		}
+	}
+	for _, tag := range h.States {
+		if existTags[tag] {
+			continue
+		}
+		existTags[tag] = true
+		im.record("state", h.Name+"/"+tag, InventoryCreate, "")
+		change.NewStates = append(change.NewStates, &database.HostState{HostId: host.Id, Tag: tag})
+	}
+	return nil
+}
+
+func (im *importer) importFencers(h *InventoryHost, change *database.HostImport) error {
+	host := change.Host
+	fencers := make([]*database.HostFencer, 0)
+	if !change.New {
+		var err error
+		if fencers, err = store.FencerGetByHost(host.Id); err != nil {
+			return err
+		}
+	}
+	key := func(fencerType, address string) string {
+		return fencerType + "/" + address
+	}
+	wanted := map[string]bool{}
+	for _, f := range h.Fencers {
+		wanted[key(f.Type, f.Host)] = true
+	}
+	existFencers := map[string]*database.HostFencer{}
+	for _, fencer := range fencers {
+		existFencers[key(fencer.Type, fencer.Host)] = fencer
+		if !wanted[key(fencer.Type, fencer.Host)] && im.prune {
+			im.record("fencer", h.Name+"/"+fencer.Host, InventoryDelete, "absent from inventory")
+			change.DeleteFencers = append(change.DeleteFencers, fencer.Id)
+		}
+	}
+
+	for _, f := range h.Fencers {
+		fencer := existFencers[key(f.Type, f.Host)]
+		if fencer == nil {
+			fencer = &database.HostFencer{
+				HostId:   host.Id,
+				Type:     f.Type,
+				Host:     f.Host,
+				Port:     f.Port,
+				Username: f.Username,
+				Password: f.Password,
+			}
+			existFencers[key(f.Type, f.Host)] = fencer
+			if len(fencer.Password) == 0 {
+				im.reject("fencer", h.Name+"/"+f.Host, InventoryCreate, f.Type, ErrPasswordRequired)
+				continue
+			}
+			im.record("fencer", h.Name+"/"+f.Host, InventoryCreate, f.Type)
+			change.NewFencers = append(change.NewFencers, fencer)
+			continue
+		}
+
+		updated := *fencer
+		updated.Port, updated.Username = f.Port, f.Username
+		if len(f.Password) > 0 {
+			updated.Password = f.Password
+		}
+		if reflect.DeepEqual(&updated, fencer) {
+			continue
+		}
+		im.record("fencer", h.Name+"/"+f.Host, InventoryUpdate, f.Type)
+		change.Fencers = append(change.Fencers, &updated)
+	}
+	return nil
+}
+
+// importGroups saves recovery policies which differ from the ones in
+// effect. With prune, policies imported before and absent from inventory
+// are deleted, so that monitors follow their configurations again.
+func (im *importer) importGroups(imported []InventoryGroup, stored []*database.RecoveryGroup) {
+	current := map[string]InventoryGroup{}
+	for _, g := range currentGroups(stored) {
+		current[g.Name] = g
+	}
+	storedGroups := map[string]*database.RecoveryGroup{}
+	for _, g := range stored {
+		storedGroups[g.Name] = g
+	}
+
+	names := map[string]bool{}
+	for _, g := range imported {
+		names[g.Name] = true
+		if exist, ok := current[g.Name]; ok && reflect.DeepEqual(normalizePolicy(exist.Policy), normalizePolicy(g.Policy)) {
+			continue
+		}
+		detail := fmt.Sprintf("%d recovery steps", len(g.Policy))
+		group := storedGroups[g.Name]
+		if group == nil {
+			group = &database.RecoveryGroup{Name: g.Name}
+			im.record("group", g.Name, InventoryCreate, detail)
+		} else {
+			im.record("group", g.Name, InventoryUpdate, detail)
+		}
+		group.Steps, group.UpdatedAt = recoverySteps(g.Policy), time.Now()
+		im.batch.Groups = append(im.batch.Groups, group)
+	}
+	if !im.prune {
+		return
+	}
+	for _, g := range stored {
+		if !names[g.Name] {
+			im.record("group", g.Name, InventoryDelete, "absent from inventory")
+			im.batch.DeleteGroups = append(im.batch.DeleteGroups, g.Id)
+		}
+	}
+}
+
+// currentGroups returns recovery policies in effect sorted by name, the
+// ones imported before take precedence over configurations of monitors.
+func currentGroups(stored []*database.RecoveryGroup) []InventoryGroup {
+	current := map[string]InventoryGroup{}
+	for _, g := range groups {
+		current[g.Name] = g
+	}
+	for _, g := range stored {
+		group := InventoryGroup{Name: g.Name, Policy: make([]InventoryPolicyStep, 0, len(g.Steps))}
+		for _, step := range g.Steps {
+			group.Policy = append(group.Policy, InventoryPolicyStep(step))
+		}
+		current[g.Name] = group
+	}
+
+	result := make([]InventoryGroup, 0, len(current))
+	for _, g := range current {
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func recoverySteps(policy []InventoryPolicyStep) []database.RecoveryStep {
+	steps := make([]database.RecoveryStep, 0, len(policy))
+	for _, step := range policy {
+		steps = append(steps, database.RecoveryStep(step))
+	}
+	return steps
+}
+
+func normalizePolicy(policy []InventoryPolicyStep) []InventoryPolicyStep {
+	if len(policy) == 0 {
+		return nil
+	}
+	return policy
+}
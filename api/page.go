@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"themis/database"
+)
+
+// maxPageLimit caps limit of list requests, lists are not limited if no
+// limit is given.
+const maxPageLimit = 1000
+
+// GetPage parses sort, limit and marker of list requests. Sort is a comma
+// separated list of key[:asc|desc], keys are mapped to columns by columns.
+func GetPage(c *gin.Context, columns map[string]string) database.Page {
+	var page database.Page
+
+	if sort := c.Query("sort"); len(sort) > 0 {
+		for _, spec := range strings.Split(sort, ",") {
+			parts := strings.SplitN(spec, ":", 2)
+			column, ok := columns[parts[0]]
+			if !ok {
+				AbortWithError(http.StatusBadRequest, fmt.Errorf("unsupported sort key %q.", parts[0]))
+			}
+			key := database.SortKey{Column: column}
+			if len(parts) == 2 {
+				switch parts[1] {
+				case "asc":
+				case "desc":
+					key.Desc = true
+				default:
+					AbortWithError(http.StatusBadRequest, fmt.Errorf("unsupported sort direction %q.", parts[1]))
+				}
+			}
+			page.Sort = append(page.Sort, key)
+		}
+	}
+	if limit := c.Query("limit"); len(limit) > 0 {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			AbortWithError(http.StatusBadRequest, ErrInvalidParameter)
+		} else if n > maxPageLimit {
+			n = maxPageLimit
+		}
+		// one more row tells if there is a next page
+		page.Limit = n + 1
+	}
+	if marker := c.Query("marker"); len(marker) > 0 {
+		id, err := strconv.Atoi(marker)
+		if err != nil {
+			AbortWithError(http.StatusBadRequest, ErrInvalidParameter)
+		}
+		page.Marker = id
+	}
+	return page
+}
+
+// SetNextPage links the next page after marker if page is full, it returns
+// number of rows to respond.
+func SetNextPage(c *gin.Context, page database.Page, count int, marker func(i int) int) int {
+	if page.Limit == 0 || count < page.Limit {
+		return count
+	}
+	count = page.Limit - 1
+
+	next := *c.Request.URL
+	query := next.Query()
+	query.Set("limit", strconv.Itoa(count))
+	query.Set("marker", strconv.Itoa(marker(count-1)))
+	next.RawQuery = query.Encode()
+	c.Header("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	return count
+}
+
+// AbortOnFindError aborts with 400 on unknown markers, 500 on other errors.
+func AbortOnFindError(err error) {
+	if err == database.ErrMarkerNotFound {
+		AbortWithError(http.StatusBadRequest, err)
+	} else if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+}
+
+// GetBool parses boolean query, nil if it is absent.
+func GetBool(c *gin.Context, key string) *bool {
+	value := c.Query(key)
+	if len(value) == 0 {
+		return nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		AbortWithError(http.StatusBadRequest, ErrInvalidParameter)
+	}
+	return &b
+}
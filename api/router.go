@@ -2,18 +2,25 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+	"themis/database"
 )
 
 var (
 	router *gin.Engine
+	// store serves all requests, database unless registered otherwise
+	store database.Store = database.NewSQLStore()
 )
 
+func RegisterStore(s database.Store) {
+	store = s
+}
+
 func Router() *gin.Engine {
 	if router == nil {
 		gin.SetMode(gin.ReleaseMode)
 
 		router = gin.New()
-		router.Use(gin.Logger(), FaultWrap())
+		router.Use(gin.Logger(), FaultWrap(), Authenticate(), ForwardWrites())
 	}
 	return router
 }
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"themis/database"
+)
+
+// useMemoryStore serves requests from a new memory store until test ends.
+func useMemoryStore(t *testing.T) database.Store {
+	s := database.NewMemoryStore()
+	RegisterStore(s)
+	t.Cleanup(func() { RegisterStore(database.NewSQLStore()) })
+	return s
+}
+
+// tokenAuthenticator knows identities of tokens.
+type tokenAuthenticator map[string]*Identity
+
+func (a tokenAuthenticator) Authenticate(token string) (*Identity, error) {
+	return a[token], nil
+}
+
+// useTokens turns on authentication with tokens reader, operator and admin
+// of their roles until test ends.
+func useTokens(t *testing.T) {
+	RegisterAuthenticators([]Authenticator{tokenAuthenticator{
+		"reader":   {Name: "r", Role: RoleReader},
+		"operator": {Name: "o", Role: RoleOperator},
+		"admin":    {Name: "a", Role: RoleAdmin},
+	}})
+	t.Cleanup(func() { RegisterAuthenticators(nil) })
+}
+
+// serve sends request to router, body is encoded in JSON unless it is nil.
+// headers are pairs of names and values.
+func serve(t *testing.T, method, path string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	Router().ServeHTTP(w, req)
+	return w
+}
+
+// decode checks status of response and decodes its body into obj.
+func decode(t *testing.T, w *httptest.ResponseRecorder, status int, obj interface{}) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status is %d, not %d: %s", w.Code, status, w.Body.String())
+	}
+	if obj != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), obj); err != nil {
+			t.Fatalf("bad response %q: %s", w.Body.String(), err)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	useMemoryStore(t)
+	useTokens(t)
+
+	w := serve(t, http.MethodGet, "/hosts", nil)
+	decode(t, w, http.StatusUnauthorized, nil)
+	if w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("WWW-Authenticate is not set")
+	}
+	decode(t, serve(t, http.MethodGet, "/hosts", nil, "Authorization", "Bearer unknown"), http.StatusUnauthorized, nil)
+	decode(t, serve(t, http.MethodGet, "/hosts", nil, "Authorization", "Bearer reader"), http.StatusOK, nil)
+	decode(t, serve(t, http.MethodGet, "/hosts", nil, "X-Auth-Token", "reader"), http.StatusOK, nil)
+
+	// readers can't write, admins can do everything
+	host := &database.Host{Name: "node1"}
+	decode(t, serve(t, http.MethodPost, "/hosts", host, "Authorization", "Bearer reader"), http.StatusForbidden, nil)
+	decode(t, serve(t, http.MethodPost, "/hosts", host, "Authorization", "Bearer operator"), http.StatusForbidden, nil)
+	decode(t, serve(t, http.MethodPost, "/hosts", host, "Authorization", "Bearer admin"), http.StatusCreated, host)
+	decode(t, serve(t, http.MethodPost, "/hosts/node1/disable", nil, "Authorization", "Bearer operator"), http.StatusAccepted, nil)
+}
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"themis/database"
@@ -30,14 +32,58 @@ func ParseBody(c *gin.Context, obj interface{}) {
 	}
 }
 
+// SetETag tells clients version of resource, so that they can update it
+// with If-Match.
+func SetETag(c *gin.Context, version int) {
+	c.Header("ETag", fmt.Sprintf("\"%d\"", version))
+}
+
+// IfMatchVersion returns version in If-Match header, 0 if any version matches.
+func IfMatchVersion(c *gin.Context) int {
+	match := strings.TrimSpace(c.GetHeader("If-Match"))
+	if len(match) == 0 || match == "*" {
+		return 0
+	}
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(match, "W/"), "\""))
+	if err != nil || version <= 0 {
+		AbortWithError(http.StatusBadRequest, ErrInvalidParameter)
+	}
+	return version
+}
+
+// CheckIfMatch aborts with 409 if If-Match header does not match version.
+func CheckIfMatch(c *gin.Context, version int) {
+	if expected := IfMatchVersion(c); expected > 0 && expected != version {
+		AbortWithError(http.StatusConflict, database.ErrConflict)
+	}
+}
+
+// AbortOnWriteError aborts with 409 on conflicts, 500 on other errors.
+func AbortOnWriteError(err error) {
+	if err == database.ErrConflict {
+		AbortWithError(http.StatusConflict, err)
+	} else if err != nil {
+		AbortWithError(http.StatusInternalServerError, err)
+	}
+}
+
+// GetHost returns host in path, which is given by name in :name, or by id
+// or name in :id. Numbers in :id are always taken as id.
 func GetHost(c *gin.Context) *database.Host {
-	hostId := GetId(c, "id")
+	var host *database.Host
+	var err error
+	if name := c.Param("name"); len(name) > 0 {
+		host, err = store.HostGetByName(name)
+	} else if id, e := strconv.Atoi(c.Param("id")); e == nil {
+		host, err = store.HostGetById(id)
+	} else {
+		host, err = store.HostGetByName(GetKey(c, "id", 1))
+	}
 
-	host, err := database.HostGetById(hostId)
 	if err != nil {
 		AbortWithError(http.StatusInternalServerError, err)
 	} else if host == nil {
-		AbortWithError(http.StatusBadRequest, ErrNotFound)
+		AbortWithError(http.StatusNotFound, ErrNotFound)
 	}
 	return host
 }
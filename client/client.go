@@ -2,6 +2,7 @@ package client
 
 import (
 	"fmt"
+	neturl "net/url"
 	"strings"
 	"time"
 )
@@ -20,6 +21,12 @@ func NewThemisClient(url string) *ThemisClient {
 	}
 }
 
+// SetToken sets bearer token of requests, which is required once
+// authentication is enabled on server.
+func (c *ThemisClient) SetToken(token string) {
+	c.http.token = token
+}
+
 type Host struct {
 	// ID uniquely identifies this host amongst all other hosts.
 	ID int `json:"id"`
@@ -27,6 +34,9 @@ type Host struct {
 	// Name contains the human-readable name for the host.
 	Name string `json:"name"`
 
+	// Group selects the recovery pipeline of the host.
+	Group string `json:"group"`
+
 	// Status contains the current status of the host.
 	Status string `json:"status"`
 
@@ -35,6 +45,9 @@ type Host struct {
 
 	// UpdatedAt contains timestamps of when the state of the host last changed.
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Version is bumped every time the host is updated.
+	Version int `json:"version,omitempty"`
 }
 
 func (c *ThemisClient) ListHosts() ([]Host, error) {
@@ -56,6 +69,17 @@ func (c *ThemisClient) ShowHost(id int) (Host, error) {
 	return host, err
 }
 
+// ShowHostByName gets host by name, names made of digits are supported too.
+func (c *ThemisClient) ShowHostByName(name string) (Host, error) {
+	var host Host
+
+	url := fmt.Sprintf("%s/hosts/by-name/%s", c.BaseUrl, neturl.PathEscape(name))
+	result := c.http.Get(url, nil)
+	err := result.ExtractInto(&host)
+
+	return host, err
+}
+
 func (c *ThemisClient) AddHost(h *Host) (Host, error) {
 	var host Host
 
@@ -92,6 +116,96 @@ func (c *ThemisClient) DisableHost(id int) (Host, error) {
 	return host, err
 }
 
+type HostSyncChange struct {
+	// Name is the name of the host being changed.
+	Name string `json:"name"`
+
+	// Action is one of "create", "update" or "orphan".
+	Action string `json:"action"`
+
+	// Detail describes why the host is changed.
+	Detail string `json:"detail"`
+}
+
+type HostSyncResult struct {
+	// DryRun indicates that changes were computed but not applied.
+	DryRun bool `json:"dry_run"`
+
+	// Changes contains all changes between themis hosts and nova.
+	Changes []HostSyncChange `json:"changes"`
+}
+
+func (c *ThemisClient) SyncHosts(dryRun bool) (HostSyncResult, error) {
+	var syncResult HostSyncResult
+
+	url := fmt.Sprintf("%s/hosts/sync?dry_run=%t", c.BaseUrl, dryRun)
+	result := c.http.Post(url, nil, &RequestOpts{OkCodes: []int{200}})
+	err := result.ExtractInto(&syncResult)
+
+	return syncResult, err
+}
+
+type HostImportRow struct {
+	// Line is the line of the row in source file, used to report errors.
+	Line int `json:"line"`
+
+	// Name contains the human-readable name for the host.
+	Name string `json:"name"`
+
+	// Group selects the recovery pipeline of the host.
+	Group string `json:"group"`
+
+	// FencerType is "ipmi" or "redfish", fencer is left out if all its fields are empty.
+	FencerType string `json:"fencer_type"`
+
+	// FencerHost is the address of BMC.
+	FencerHost string `json:"fencer_host"`
+
+	// FencerPort defaults to 623 for IPMI and 443 for Redfish.
+	FencerPort int `json:"fencer_port"`
+
+	// FencerUsername and FencerPassword log in BMC.
+	FencerUsername string `json:"fencer_username"`
+	FencerPassword string `json:"fencer_password"`
+}
+
+type HostImportRowResult struct {
+	// Line is the line of the row in source file.
+	Line int `json:"line"`
+
+	// Name is the name of the host.
+	Name string `json:"name"`
+
+	// HostId and FencerId are IDs of created host and fencer.
+	HostId   int `json:"host_id"`
+	FencerId int `json:"fencer_id"`
+
+	// Error tells why the row is invalid or failed to be created.
+	Error string `json:"error"`
+}
+
+type HostImportResult struct {
+	// DryRun indicates that rows were validated but not created.
+	DryRun bool `json:"dry_run"`
+
+	// Imported is false if any row is invalid or can't be saved, nothing is
+	// created then.
+	Imported bool `json:"imported"`
+
+	// Rows contains results of all rows in order.
+	Rows []HostImportRowResult `json:"rows"`
+}
+
+func (c *ThemisClient) ImportHosts(rows []HostImportRow, dryRun bool) (HostImportResult, error) {
+	var importResult HostImportResult
+
+	url := fmt.Sprintf("%s/hosts/import?dry_run=%t", c.BaseUrl, dryRun)
+	result := c.http.Post(url, rows, &RequestOpts{OkCodes: []int{200}})
+	err := result.ExtractInto(&importResult)
+
+	return importResult, err
+}
+
 type Fencer struct {
 	// ID uniquely identifies this fencer amongst all other fencers.
 	ID int `json:"id"`
@@ -99,13 +213,13 @@ type Fencer struct {
 	// HostId uniquely identifies host ID associated with this fencer.
 	HostId int `json:"host_id"`
 
-	// Type identifies fencer type, such as "IPMI".
+	// Type identifies fencer type, "ipmi" or "redfish".
 	Type string `json:"type"`
 
-	// Remote host name for IPMI LAN interface
+	// Remote host name for IPMI LAN interface or Redfish API
 	Host string `json:"host"`
 
-	// Remote RMCP port
+	// Remote RMCP or HTTPS port
 	Port int `json:"port"`
 
 	// Remote session username
@@ -113,6 +227,9 @@ type Fencer struct {
 
 	// Remote session password
 	Password string `json:"password"`
+
+	// Version is bumped every time the fencer is updated.
+	Version int `json:"version,omitempty"`
 }
 
 func (c *ThemisClient) ListFencers() ([]Fencer, error) {
@@ -149,3 +266,294 @@ func (c *ThemisClient) DeleteFencer(id int) error {
 	url := fmt.Sprintf("%s/fencers/%d", c.BaseUrl, id)
 	return c.http.Delete(url, nil)
 }
+
+type OperationStep struct {
+	// Seq is the order of the step in operation.
+	Seq int `json:"seq"`
+
+	// Name identifies the step, such as "power-off" or "evacuate".
+	Name string `json:"name"`
+
+	// Type identifies the step type, such as "hook" or "fence".
+	Type string `json:"type"`
+
+	// Status is one of pending, running, succeeded, failed or skipped.
+	Status string `json:"status"`
+
+	// Message contains error of the step if it failed.
+	Message string `json:"message"`
+
+	// StartedAt contains timestamps of when the step started.
+	StartedAt time.Time `json:"started_at"`
+
+	// FinishedAt contains timestamps of when the step finished.
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+type Operation struct {
+	// ID uniquely identifies this operation amongst all other operations.
+	ID int `json:"id"`
+
+	// HostId identifies host ID the operation acts on.
+	HostId int `json:"host_id"`
+
+	// HostName contains name of the host the operation acts on.
+	HostName string `json:"host_name"`
+
+	// Type identifies operation type, such as "fence".
+	Type string `json:"type"`
+
+	// Status is one of running, succeeded, failed or aborted.
+	Status string `json:"status"`
+
+	// LeaderName is the monitor which runs the operation.
+	LeaderName string `json:"leader_name"`
+
+	// Instances contains instances found on the host.
+	Instances []string `json:"instances"`
+
+	// Message describes why the operation failed or aborted.
+	Message string `json:"message"`
+
+	// CreatedAt contains timestamps of when the operation started.
+	CreatedAt time.Time `json:"created_at"`
+
+	// UpdatedAt contains timestamps of when the operation last changed.
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Steps contains all steps of the operation, only returned by ShowOperation.
+	Steps []OperationStep `json:"steps"`
+}
+
+func (c *ThemisClient) ListOperations() ([]Operation, error) {
+	var ops []Operation
+
+	url := fmt.Sprintf("%s/operations", c.BaseUrl)
+	result := c.http.Get(url, nil)
+	err := result.ExtractIntoSlicePtr(&ops, "")
+	return ops, err
+}
+
+func (c *ThemisClient) ShowOperation(id int) (Operation, error) {
+	var op Operation
+
+	url := fmt.Sprintf("%s/operations/%d", c.BaseUrl, id)
+	result := c.http.Get(url, nil)
+	err := result.ExtractInto(&op)
+
+	return op, err
+}
+
+type ClusterMember struct {
+	// Name identifies the monitor.
+	Name string `json:"name"`
+
+	// Leader is true if the monitor is the current leader.
+	Leader bool `json:"leader"`
+
+	// Term is the term of the latest leadership of the monitor.
+	Term int64 `json:"term"`
+
+	// TermStart contains timestamps of when the latest leadership started.
+	TermStart time.Time `json:"term_start"`
+
+	// LastProclaim contains timestamps of when the monitor last campaigned.
+	LastProclaim time.Time `json:"last_proclaim"`
+
+	// Address is the URL of REST API of the monitor.
+	Address string `json:"address"`
+}
+
+func (c *ThemisClient) ShowLeader() (ClusterMember, error) {
+	var leader ClusterMember
+
+	url := fmt.Sprintf("%s/cluster/leader", c.BaseUrl)
+	result := c.http.Get(url, nil)
+	err := result.ExtractInto(&leader)
+
+	return leader, err
+}
+
+func (c *ThemisClient) ListMembers() ([]ClusterMember, error) {
+	var members []ClusterMember
+
+	url := fmt.Sprintf("%s/cluster/members", c.BaseUrl)
+	result := c.http.Get(url, nil)
+	err := result.ExtractIntoSlicePtr(&members, "")
+	return members, err
+}
+
+func (c *ThemisClient) StepDown() error {
+	url := fmt.Sprintf("%s/cluster/leader/step-down", c.BaseUrl)
+	result := c.http.Post(url, nil, &RequestOpts{OkCodes: []int{202}})
+	return result.Err
+}
+
+type HostHistory struct {
+	// ID uniquely identifies this record amongst all other records.
+	ID int `json:"id"`
+
+	// HostId identifies host ID the transition happened on.
+	HostId int `json:"host_id"`
+
+	// OldStatus is the status before the transition.
+	OldStatus string `json:"old_status"`
+
+	// NewStatus is the status after the transition.
+	NewStatus string `json:"new_status"`
+
+	// Reason describes why the transition happened.
+	Reason string `json:"reason"`
+
+	// States contains failed times of each tag when the transition happened.
+	States map[string]int `json:"states"`
+
+	// LeaderName is the monitor which made the transition.
+	LeaderName string `json:"leader_name"`
+
+	// CreatedAt contains timestamps of when the transition happened.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c *ThemisClient) ListHostHistory(id int) ([]HostHistory, error) {
+	var histories []HostHistory
+
+	url := fmt.Sprintf("%s/hosts/%d/history", c.BaseUrl, id)
+	result := c.http.Get(url, nil)
+	err := result.ExtractIntoSlicePtr(&histories, "")
+	return histories, err
+}
+
+// InventoryVersion is the latest inventory format known by this client.
+const InventoryVersion = 1
+
+type Inventory struct {
+	// Version is the version of inventory format.
+	Version int `json:"version" yaml:"version"`
+
+	// ExportedAt contains timestamps of when the inventory was exported.
+	ExportedAt time.Time `json:"exported_at" yaml:"exported_at"`
+
+	// Redacted indicates that passwords of fencers were left out.
+	Redacted bool `json:"redacted" yaml:"redacted"`
+
+	// Encryption describes how passwords of fencers are encrypted, nil if
+	// they are in plain text. It is only known by clients.
+	Encryption *InventoryEncryption `json:"encryption,omitempty" yaml:"encryption,omitempty"`
+
+	// Hosts contains all hosts with their states and fencers.
+	Hosts []InventoryHost `json:"hosts" yaml:"hosts"`
+
+	// Groups contains recovery policies of host groups.
+	Groups []InventoryGroup `json:"groups" yaml:"groups"`
+}
+
+type InventoryEncryption struct {
+	// Cipher encrypts passwords, only "aes-256-gcm" is supported.
+	Cipher string `json:"cipher" yaml:"cipher"`
+
+	// KDF derives key from passphrase, only "scrypt" is supported.
+	KDF string `json:"kdf" yaml:"kdf"`
+
+	// Salt of KDF in base64.
+	Salt string `json:"salt" yaml:"salt"`
+}
+
+type InventoryHost struct {
+	// Name identifies the host, hosts are imported by name.
+	Name string `json:"name" yaml:"name"`
+
+	// Group selects the recovery pipeline of the host.
+	Group string `json:"group" yaml:"group"`
+
+	// Disabled contains information about whether the host is disabled.
+	Disabled bool `json:"disabled" yaml:"disabled"`
+
+	// States contains tags monitored on the host.
+	States []string `json:"states" yaml:"states"`
+
+	// Fencers contains fencers of the host.
+	Fencers []InventoryFencer `json:"fencers" yaml:"fencers"`
+}
+
+type InventoryFencer struct {
+	// Type identifies fencer type, such as "ipmi".
+	Type string `json:"type" yaml:"type"`
+
+	// Host is the address of the fencer, fencers are imported by type and host.
+	Host string `json:"host" yaml:"host"`
+
+	// Port of the fencer.
+	Port int `json:"port" yaml:"port"`
+
+	// Username of the fencer.
+	Username string `json:"username" yaml:"username"`
+
+	// Password of the fencer, empty keeps the current password on import.
+	Password string `json:"password" yaml:"password"`
+}
+
+type InventoryGroup struct {
+	// Name of the host group.
+	Name string `json:"name" yaml:"name"`
+
+	// Policy contains recovery steps of hosts in the group.
+	Policy []InventoryPolicyStep `json:"policy" yaml:"policy"`
+}
+
+type InventoryPolicyStep struct {
+	Type    string `json:"type" yaml:"type"`
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	URL     string `json:"url,omitempty" yaml:"url,omitempty"`
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+	Timeout int    `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+type InventoryChange struct {
+	// Kind is one of "host", "state", "fencer" or "group".
+	Kind string `json:"kind"`
+
+	// Name identifies what is changed, states and fencers are prefixed by host name.
+	Name string `json:"name"`
+
+	// Action is one of "create", "update" or "delete".
+	Action string `json:"action"`
+
+	// Detail describes the change.
+	Detail string `json:"detail"`
+
+	// Error is why the change failed, empty if it succeeded.
+	Error string `json:"error"`
+}
+
+type InventoryResult struct {
+	// DryRun indicates that changes were computed but not applied.
+	DryRun bool `json:"dry_run"`
+
+	// Imported indicates that changes were applied, nothing is applied if
+	// any change has an error.
+	Imported bool `json:"imported"`
+
+	// Changes contains all changes made by the import.
+	Changes []InventoryChange `json:"changes"`
+}
+
+func (c *ThemisClient) ExportInventory(redact bool) (Inventory, error) {
+	var inventory Inventory
+
+	url := fmt.Sprintf("%s/inventory?redact=%t", c.BaseUrl, redact)
+	result := c.http.Get(url, nil)
+	err := result.ExtractInto(&inventory)
+
+	return inventory, err
+}
+
+func (c *ThemisClient) ImportInventory(inventory *Inventory, dryRun, prune bool) (InventoryResult, error) {
+	var importResult InventoryResult
+
+	url := fmt.Sprintf("%s/inventory?dry_run=%t&prune=%t", c.BaseUrl, dryRun, prune)
+	result := c.http.Post(url, inventory, &RequestOpts{OkCodes: []int{200}})
+	err := result.ExtractInto(&importResult)
+
+	return importResult, err
+}
@@ -48,6 +48,9 @@ func defaultOkCodes(method string) []int {
 
 type HTTPClient struct {
 	httpClient http.Client
+
+	// token is sent as bearer token of requests if it is not empty
+	token string
 }
 
 func (c *HTTPClient) initReqOpts(url string, JSONBody interface{}, opts *RequestOpts) {
@@ -93,6 +96,9 @@ func (c *HTTPClient) Request(method, url string, options *RequestOpts) (*http.Re
 		req.Header.Set("Content-Type", *contentType)
 	}
 	req.Header.Set("Accept", applicationJSON)
+	if len(c.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
 
 	// Set connection parameter to close the connection immediately when we've got the response
 	req.Close = true
@@ -135,6 +141,11 @@ func (c *HTTPClient) Request(method, url string, options *RequestOpts) (*http.Re
 			if error400er, ok := errType.(Err400er); ok {
 				err = error400er.Error400(respErr)
 			}
+		case http.StatusUnauthorized:
+			err = ErrDefault401{respErr}
+			if error401er, ok := errType.(Err401er); ok {
+				err = error401er.Error401(respErr)
+			}
 		case http.StatusForbidden:
 			err = ErrDefault403{respErr}
 			if error403er, ok := errType.(Err403er); ok {
@@ -0,0 +1,226 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// HostListOpts filters and pages hosts, zero values match all hosts.
+type HostListOpts struct {
+	// Status matches any of the statuses.
+	Status []string
+
+	// Disabled matches disabled or enabled hosts if it is set.
+	Disabled *bool
+
+	// NamePrefix matches hosts whose names start with it.
+	NamePrefix string
+
+	// Group matches hosts of the group.
+	Group string
+
+	// FailedTag matches hosts which have failures on the tag.
+	FailedTag string
+
+	// Sort is a comma separated list of key[:asc|desc], keys are id, name,
+	// group, status, disabled and updated_at.
+	Sort string
+
+	// Limit is the size of pages, server caps it to 1000.
+	Limit int
+
+	// Marker is the ID of the last host of previous page.
+	Marker int
+}
+
+func (opts *HostListOpts) query() url.Values {
+	query := url.Values{}
+	if len(opts.Status) > 0 {
+		query.Set("status", strings.Join(opts.Status, ","))
+	}
+	if opts.Disabled != nil {
+		query.Set("disabled", strconv.FormatBool(*opts.Disabled))
+	}
+	setQuery(query, "name_prefix", opts.NamePrefix)
+	setQuery(query, "group", opts.Group)
+	setQuery(query, "failed_tag", opts.FailedTag)
+	setPageQuery(query, opts.Sort, opts.Limit, opts.Marker)
+	return query
+}
+
+// FencerListOpts filters and pages fencers, zero values match all fencers.
+type FencerListOpts struct {
+	// HostId matches fencers of the host.
+	HostId int
+
+	// Type matches fencers of the type, "ipmi" or "redfish".
+	Type string
+
+	// Sort is a comma separated list of key[:asc|desc], keys are id,
+	// host_id, type and host.
+	Sort string
+
+	// Limit is the size of pages, server caps it to 1000.
+	Limit int
+
+	// Marker is the ID of the last fencer of previous page.
+	Marker int
+}
+
+func (opts *FencerListOpts) query() url.Values {
+	query := url.Values{}
+	if opts.HostId > 0 {
+		query.Set("host_id", strconv.Itoa(opts.HostId))
+	}
+	setQuery(query, "type", opts.Type)
+	setPageQuery(query, opts.Sort, opts.Limit, opts.Marker)
+	return query
+}
+
+func setQuery(query url.Values, key, value string) {
+	if len(value) > 0 {
+		query.Set(key, value)
+	}
+}
+
+func setPageQuery(query url.Values, sort string, limit, marker int) {
+	setQuery(query, "sort", sort)
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if marker > 0 {
+		query.Set("marker", strconv.Itoa(marker))
+	}
+}
+
+// pager fetches pages one by one, following Link headers of responses.
+type pager struct {
+	client *ThemisClient
+	// URL of next page, empty once all pages are fetched
+	next string
+}
+
+func (c *ThemisClient) newPager(path string, query url.Values) pager {
+	next := c.BaseUrl + path
+	if len(query) > 0 {
+		next += "?" + query.Encode()
+	}
+	return pager{client: c, next: next}
+}
+
+// More tells if there are pages left.
+func (p *pager) More() bool {
+	return len(p.next) > 0
+}
+
+func (p *pager) fetch(to interface{}) error {
+	if !p.More() {
+		return fmt.Errorf("no more pages")
+	}
+	current := p.next
+	p.next = ""
+
+	result := p.client.http.Get(current, nil)
+	if err := result.ExtractIntoSlicePtr(to, ""); err != nil {
+		return err
+	}
+	next, err := nextLink(current, result.Header.Get("Link"))
+	if err != nil {
+		return err
+	}
+	p.next = next
+	return nil
+}
+
+// nextLink returns URL of next page in Link header, resolved against URL
+// of current page.
+func nextLink(current, header string) (string, error) {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) != `rel="next"` {
+				continue
+			}
+			base, err := url.Parse(current)
+			if err != nil {
+				return "", err
+			}
+			ref, err := url.Parse(target[1 : len(target)-1])
+			if err != nil {
+				return "", err
+			}
+			return base.ResolveReference(ref).String(), nil
+		}
+	}
+	return "", nil
+}
+
+// HostPager iterates over pages of hosts:
+//
+//	pager := themis.NewHostPager(client.HostListOpts{Limit: 100})
+//	for pager.More() {
+//		hosts, err := pager.Next()
+//		...
+//	}
+type HostPager struct {
+	pager
+}
+
+func (c *ThemisClient) NewHostPager(opts HostListOpts) *HostPager {
+	return &HostPager{c.newPager("/hosts", opts.query())}
+}
+
+// Next returns next page of hosts.
+func (p *HostPager) Next() ([]Host, error) {
+	var hosts []Host
+	err := p.fetch(&hosts)
+	return hosts, err
+}
+
+// All returns hosts of all pages left.
+func (p *HostPager) All() ([]Host, error) {
+	all := make([]Host, 0)
+	for p.More() {
+		hosts, err := p.Next()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, hosts...)
+	}
+	return all, nil
+}
+
+// FencerPager iterates over pages of fencers, just like HostPager.
+type FencerPager struct {
+	pager
+}
+
+func (c *ThemisClient) NewFencerPager(opts FencerListOpts) *FencerPager {
+	return &FencerPager{c.newPager("/fencers", opts.query())}
+}
+
+// Next returns next page of fencers.
+func (p *FencerPager) Next() ([]Fencer, error) {
+	var fencers []Fencer
+	err := p.fetch(&fencers)
+	return fencers, err
+}
+
+// All returns fencers of all pages left.
+func (p *FencerPager) All() ([]Fencer, error) {
+	all := make([]Fencer, 0)
+	for p.More() {
+		fencers, err := p.Next()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, fencers...)
+	}
+	return all, nil
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	texttable "github.com/syohex/go-texttable"
+	"themis/client"
+)
+
+func NewClusterCommand() *cobra.Command {
+	clusterCmd := &cobra.Command{
+		Use:   "cluster",
+		Short: "Monitor cluster related commands",
+	}
+
+	clusterCmd.AddCommand(newClusterLeaderCommand())
+	clusterCmd.AddCommand(newClusterMembersCommand())
+	clusterCmd.AddCommand(newClusterStepDownCommand())
+
+	return clusterCmd
+}
+
+func newClusterLeaderCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "leader",
+		Short: "show the current leader",
+		Run:   clusterLeaderCommandFunc,
+	}
+	return cmd
+}
+
+func newClusterMembersCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "members",
+		Short: "list all monitors which have campaigned",
+		Run:   clusterMembersCommandFunc,
+	}
+	return cmd
+}
+
+func newClusterStepDownCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "step-down",
+		Short: "ask the leader to hand over leadership",
+		Run:   clusterStepDownCommandFunc,
+	}
+	return cmd
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func displayMembers(members []client.ClusterMember) {
+	table := &texttable.TextTable{}
+
+	table.SetHeader("Name", "Address", "Leader", "Term", "TermStart", "LastProclaim")
+	for _, m := range members {
+		table.AddRow(
+			m.Name,
+			m.Address,
+			fmt.Sprint(m.Leader),
+			fmt.Sprint(m.Term),
+			formatTime(m.TermStart),
+			formatTime(m.LastProclaim),
+		)
+	}
+
+	fmt.Println(table.Draw())
+}
+
+func clusterLeaderCommandFunc(cmd *cobra.Command, args []string) {
+	themis := newClient()
+
+	leader, err := themis.ShowLeader()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	displayMembers([]client.ClusterMember{leader})
+}
+
+func clusterMembersCommandFunc(cmd *cobra.Command, args []string) {
+	themis := newClient()
+
+	members, err := themis.ListMembers()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	displayMembers(members)
+}
+
+func clusterStepDownCommandFunc(cmd *cobra.Command, args []string) {
+	themis := newClient()
+
+	if err := themis.StepDown(); err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	fmt.Println("leader is stepping down.")
+}
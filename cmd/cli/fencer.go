@@ -11,11 +11,12 @@ import (
 )
 
 var (
-	HostId   int
-	IPMIHost string
-	IPMIPort int
-	Username string
-	Password string
+	HostRef    string
+	FencerType string
+	IPMIHost   string
+	IPMIPort   int
+	Username   string
+	Password   string
 )
 
 func NewFencerCommand() *cobra.Command {
@@ -56,11 +57,12 @@ func newFencerAddCommand() *cobra.Command {
 		Short: "Add a new fencer for host",
 		Run:   fencerAddCommandFunc,
 	}
-	cmd.Flags().IntVarP(&HostId, "id", "I", 0, "host id")
-	cmd.Flags().IntVarP(&IPMIPort, "port", "P", 623, "IPMI port")
-	cmd.Flags().StringVarP(&IPMIHost, "host", "H", "", "IPMI Remote host name for LAN interface")
-	cmd.Flags().StringVarP(&Username, "username", "u", "", "IPMI username")
-	cmd.Flags().StringVarP(&Password, "password", "p", "", "IPMI password")
+	cmd.Flags().StringVarP(&HostRef, "id", "I", "", "host id or name")
+	cmd.Flags().StringVarP(&FencerType, "type", "t", "ipmi", "fencer type, ipmi or redfish")
+	cmd.Flags().IntVarP(&IPMIPort, "port", "P", 0, "IPMI or Redfish port, default 623 for IPMI and 443 for Redfish")
+	cmd.Flags().StringVarP(&IPMIHost, "host", "H", "", "IPMI Remote host name for LAN interface or Redfish API")
+	cmd.Flags().StringVarP(&Username, "username", "u", "", "IPMI or Redfish username")
+	cmd.Flags().StringVarP(&Password, "password", "p", "", "IPMI or Redfish password")
 
 	cmd.MarkFlagRequired("id")
 	cmd.MarkFlagRequired("host")
@@ -113,7 +115,7 @@ func getFencerId(args []string) int {
 }
 
 func fencerListCommandFunc(cmd *cobra.Command, args []string) {
-	themis := client.NewThemisClient(globalFlags.Url)
+	themis := newClient()
 
 	fencers, err := themis.ListFencers()
 	if err != nil {
@@ -124,7 +126,7 @@ func fencerListCommandFunc(cmd *cobra.Command, args []string) {
 }
 
 func fencerGetCommandFunc(cmd *cobra.Command, args []string) {
-	themis := client.NewThemisClient(globalFlags.Url)
+	themis := newClient()
 
 	fencer, err := themis.ShowFencer(getFencerId(args))
 	if err != nil {
@@ -135,9 +137,9 @@ func fencerGetCommandFunc(cmd *cobra.Command, args []string) {
 }
 
 func fencerAddCommandFunc(cmd *cobra.Command, args []string) {
-	themis := client.NewThemisClient(globalFlags.Url)
+	themis := newClient()
 
-	host, err := themis.ShowHost(HostId)
+	host, err := themis.ShowHost(resolveHost(themis, HostRef))
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(-1)
@@ -145,7 +147,7 @@ func fencerAddCommandFunc(cmd *cobra.Command, args []string) {
 
 	req := &client.Fencer{
 		HostId:   host.ID,
-		Type:     "ipmi",
+		Type:     FencerType,
 		Host:     IPMIHost,
 		Port:     IPMIPort,
 		Username: Username,
@@ -162,7 +164,7 @@ func fencerAddCommandFunc(cmd *cobra.Command, args []string) {
 }
 
 func fencerDeleteCommandFunc(cmd *cobra.Command, args []string) {
-	themis := client.NewThemisClient(globalFlags.Url)
+	themis := newClient()
 	err := themis.DeleteFencer(getFencerId(args))
 
 	if err != nil {
@@ -3,7 +3,9 @@ package cli
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"themis/client"
@@ -11,6 +13,12 @@ import (
 	texttable "github.com/syohex/go-texttable"
 )
 
+var (
+	DryRun    bool
+	HostGroup string
+	ListOpts  client.HostListOpts
+)
+
 // NewHostCommand returns the cobra command for "Host".
 func NewHostCommand() *cobra.Command {
 	hostCmd := &cobra.Command{
@@ -24,6 +32,9 @@ func NewHostCommand() *cobra.Command {
 	hostCmd.AddCommand(newHostListCommand())
 	hostCmd.AddCommand(newHostEnableCommand())
 	hostCmd.AddCommand(newHostDisableCommand())
+	hostCmd.AddCommand(newHostSyncCommand())
+	hostCmd.AddCommand(newHostImportCommand())
+	hostCmd.AddCommand(newHostHistoryCommand())
 
 	return hostCmd
 }
@@ -34,12 +45,13 @@ func newHostAddCommand() *cobra.Command {
 		Short: "Adds a new host",
 		Run:   hostAddCommandFunc,
 	}
+	cmd.Flags().StringVarP(&HostGroup, "group", "g", "", "host group which selects recovery pipeline")
 	return cmd
 }
 
 func newHostDeleteCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "del <host id>",
+		Use:   "del <host id or name>",
 		Short: "Delete a host",
 		Run:   hostDeleteCommandFunc,
 	}
@@ -48,7 +60,7 @@ func newHostDeleteCommand() *cobra.Command {
 
 func newHostGetCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "get <host id>",
+		Use:   "get <host id or name>",
 		Short: "Get a host information",
 		Run:   hostGetCommandFunc,
 	}
@@ -60,12 +72,19 @@ func newHostListCommand() *cobra.Command {
 		Short: "list all host information",
 		Run:   hostListCommandFunc,
 	}
+	cmd.Flags().StringSliceVar(&ListOpts.Status, "status", nil, "only list hosts of statuses, separated by comma")
+	cmd.Flags().StringVarP(&ListOpts.Group, "group", "g", "", "only list hosts of group")
+	cmd.Flags().StringVar(&ListOpts.NamePrefix, "name-prefix", "", "only list hosts whose names start with prefix")
+	cmd.Flags().StringVar(&ListOpts.FailedTag, "failed-tag", "", "only list hosts which have failures on tag")
+	cmd.Flags().StringVar(&ListOpts.Sort, "sort", "", "sort keys, such as status,updated_at:desc")
+	cmd.Flags().IntVar(&ListOpts.Limit, "limit", 0, "list at most limit hosts")
+	cmd.Flags().IntVar(&ListOpts.Marker, "marker", 0, "list hosts after host of this id")
 	return cmd
 }
 
 func newHostEnableCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "enable <host id>",
+		Use:   "enable <host id or name>",
 		Short: "Enable a host",
 		Run:   hostEnableCommandFunc,
 	}
@@ -74,21 +93,40 @@ func newHostEnableCommand() *cobra.Command {
 
 func newHostDisableCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "disable <host id>",
+		Use:   "disable <host id or name>",
 		Short: "Disable a host",
 		Run:   hostDisableCommandFunc,
 	}
 	return cmd
 }
 
+func newHostSyncCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Sync hosts from nova compute nodes",
+		Run:   hostSyncCommandFunc,
+	}
+	cmd.Flags().BoolVar(&DryRun, "dry-run", false, "only show changes without applying them")
+	return cmd
+}
+
+func newHostHistoryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history <host id or name>",
+		Short: "Show status transitions of a host",
+		Run:   hostHistoryCommandFunc,
+	}
+	return cmd
+}
+
 func displayHosts(hosts []client.Host) {
 	table := &texttable.TextTable{}
 
-	table.SetHeader("ID", "Name", "Status", "Disabled", "UpdatedAt")
+	table.SetHeader("ID", "Name", "Group", "Status", "Disabled", "UpdatedAt")
 	for _, h := range hosts {
 		table.AddRow(
 			fmt.Sprint(h.ID),
-			h.Name, h.Status,
+			h.Name, h.Group, h.Status,
 			fmt.Sprint(h.Disabled),
 			h.UpdatedAt.Format(time.RFC3339),
 		)
@@ -98,33 +136,50 @@ func displayHosts(hosts []client.Host) {
 }
 
 func hostListCommandFunc(cmd *cobra.Command, args []string) {
-	themis := client.NewThemisClient(globalFlags.Url)
-
-	hosts, err := themis.ListHosts()
+	themis := newClient()
+	pager := themis.NewHostPager(ListOpts)
+
+	var hosts []client.Host
+	var err error
+	if ListOpts.Limit > 0 {
+		hosts, err = pager.Next()
+	} else {
+		hosts, err = pager.All()
+	}
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(-1)
 	}
 	displayHosts(hosts)
+	if pager.More() && len(hosts) > 0 {
+		fmt.Printf("More hosts, continue with --marker %d\n", hosts[len(hosts)-1].ID)
+	}
 }
 
-func getHostId(args []string) int {
+func getHostId(themis *client.ThemisClient, args []string) int {
 	if len(args) != 1 {
-		fmt.Println("ERROR: you must specify host id")
+		fmt.Println("ERROR: you must specify host id or name")
 		os.Exit(-1)
 	}
+	return resolveHost(themis, args[0])
+}
 
-	id, err := strconv.Atoi(args[0])
+// resolveHost returns id of host given by id or name, numbers are taken as id.
+func resolveHost(themis *client.ThemisClient, host string) int {
+	if id, err := strconv.Atoi(host); err == nil {
+		return id
+	}
+	h, err := themis.ShowHostByName(host)
 	if err != nil {
-		fmt.Println("ERROR: you must specify a valid id")
+		fmt.Println(err)
 		os.Exit(-1)
 	}
-	return id
+	return h.ID
 }
 
 func hostGetCommandFunc(cmd *cobra.Command, args []string) {
-	themis := client.NewThemisClient(globalFlags.Url)
-	host, err := themis.ShowHost(getHostId(args))
+	themis := newClient()
+	host, err := themis.ShowHost(getHostId(themis, args))
 
 	if err != nil {
 		fmt.Println(err)
@@ -139,9 +194,9 @@ func hostAddCommandFunc(cmd *cobra.Command, args []string) {
 		fmt.Println("ERROR: you must specify hostname")
 		os.Exit(-1)
 	}
-	req := &client.Host{Name: args[0]}
+	req := &client.Host{Name: args[0], Group: HostGroup}
 
-	themis := client.NewThemisClient(globalFlags.Url)
+	themis := newClient()
 	host, err := themis.AddHost(req)
 
 	if err != nil {
@@ -153,8 +208,8 @@ func hostAddCommandFunc(cmd *cobra.Command, args []string) {
 }
 
 func hostDeleteCommandFunc(cmd *cobra.Command, args []string) {
-	themis := client.NewThemisClient(globalFlags.Url)
-	err := themis.DeleteHost(getHostId(args))
+	themis := newClient()
+	err := themis.DeleteHost(getHostId(themis, args))
 
 	if err != nil {
 		fmt.Println(err)
@@ -163,8 +218,8 @@ func hostDeleteCommandFunc(cmd *cobra.Command, args []string) {
 }
 
 func hostEnableCommandFunc(cmd *cobra.Command, args []string) {
-	themis := client.NewThemisClient(globalFlags.Url)
-	host, err := themis.EnableHost(getHostId(args))
+	themis := newClient()
+	host, err := themis.EnableHost(getHostId(themis, args))
 
 	if err != nil {
 		fmt.Println(err)
@@ -175,8 +230,8 @@ func hostEnableCommandFunc(cmd *cobra.Command, args []string) {
 }
 
 func hostDisableCommandFunc(cmd *cobra.Command, args []string) {
-	themis := client.NewThemisClient(globalFlags.Url)
-	host, err := themis.DisableHost(getHostId(args))
+	themis := newClient()
+	host, err := themis.DisableHost(getHostId(themis, args))
 
 	if err != nil {
 		fmt.Println(err)
@@ -185,3 +240,47 @@ func hostDisableCommandFunc(cmd *cobra.Command, args []string) {
 
 	displayHosts([]client.Host{host})
 }
+
+func hostSyncCommandFunc(cmd *cobra.Command, args []string) {
+	themis := newClient()
+	result, err := themis.SyncHosts(DryRun)
+
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+
+	table := &texttable.TextTable{}
+	table.SetHeader("Name", "Action", "Detail")
+	for _, c := range result.Changes {
+		table.AddRow(c.Name, c.Action, c.Detail)
+	}
+	fmt.Println(table.Draw())
+}
+
+func hostHistoryCommandFunc(cmd *cobra.Command, args []string) {
+	themis := newClient()
+	histories, err := themis.ListHostHistory(getHostId(themis, args))
+
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+
+	table := &texttable.TextTable{}
+	table.SetHeader("Time", "From", "To", "Reason", "States", "Leader")
+	for _, h := range histories {
+		states := make([]string, 0, len(h.States))
+		for tag, failedTimes := range h.States {
+			states = append(states, fmt.Sprintf("%s=%d", tag, failedTimes))
+		}
+		sort.Strings(states)
+		table.AddRow(
+			h.CreatedAt.Format(time.RFC3339),
+			h.OldStatus, h.NewStatus, h.Reason,
+			strings.Join(states, ","),
+			h.LeaderName,
+		)
+	}
+	fmt.Println(table.Draw())
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	texttable "github.com/syohex/go-texttable"
+	"themis/client"
+)
+
+// columns of hosts csv file, only name is required
+var hostImportColumns = []string{
+	"name", "group",
+	"fencer_type", "fencer_host", "fencer_port", "fencer_username", "fencer_password",
+}
+
+func newHostImportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <hosts.csv>",
+		Short: "Add hosts and their fencers from a csv file",
+		Long: "Add hosts and their fencers from a csv file, - for stdin. First line of file names\n" +
+			"columns, which are " + strings.Join(hostImportColumns, ", ") + ".\n" +
+			"Nothing is added if any row is invalid.",
+		Run: hostImportCommandFunc,
+	}
+	cmd.Flags().BoolVar(&DryRun, "dry-run", false, "only validate rows without adding them")
+	return cmd
+}
+
+// readHostRows reads rows of hosts from csv, errors of rows are returned
+// by line.
+func readHostRows(r io.Reader) ([]client.HostImportRow, map[int]string, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	// trailing empty columns may be left out
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("file is empty")
+	} else if err != nil {
+		return nil, nil, err
+	}
+	columns := map[string]int{}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		known := false
+		for _, c := range hostImportColumns {
+			known = known || c == column
+		}
+		if !known {
+			return nil, nil, fmt.Errorf("unknown column %q, columns are %s", column, strings.Join(hostImportColumns, ", "))
+		} else if _, ok := columns[column]; ok {
+			return nil, nil, fmt.Errorf("column %q is duplicated", column)
+		}
+		columns[column] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, nil, fmt.Errorf("column name is required")
+	}
+
+	rows := make([]client.HostImportRow, 0)
+	errs := map[int]string{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := client.HostImportRow{
+			Line:           line,
+			Name:           field("name"),
+			Group:          field("group"),
+			FencerType:     strings.ToLower(field("fencer_type")),
+			FencerHost:     field("fencer_host"),
+			FencerUsername: field("fencer_username"),
+			FencerPassword: field("fencer_password"),
+		}
+		if len(record) > len(header) {
+			errs[line] = fmt.Sprintf("%d fields found, expect at most %d", len(record), len(header))
+		} else if port := field("fencer_port"); len(port) > 0 {
+			if row.FencerPort, err = strconv.Atoi(port); err != nil {
+				errs[line] = fmt.Sprintf("invalid fencer port %q", port)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, errs, nil
+}
+
+func displayHostImport(rows []client.HostImportRowResult) {
+	table := &texttable.TextTable{}
+
+	table.SetHeader("Line", "Name", "HostId", "FencerId", "Error")
+	for _, r := range rows {
+		hostId, fencerId := "", ""
+		if r.HostId > 0 {
+			hostId = fmt.Sprint(r.HostId)
+		}
+		if r.FencerId > 0 {
+			fencerId = fmt.Sprint(r.FencerId)
+		}
+		table.AddRow(fmt.Sprint(r.Line), r.Name, hostId, fencerId, r.Error)
+	}
+
+	fmt.Println(table.Draw())
+}
+
+func hostImportCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Println("ERROR: you must specify csv file")
+		os.Exit(-1)
+	}
+	file := os.Stdin
+	if args[0] != "-" {
+		var err error
+		file, err = os.Open(args[0])
+		exitOnError(err)
+		defer file.Close()
+	}
+	rows, errs, err := readHostRows(file)
+	exitOnError(err)
+
+	// rows which can't be parsed are never sent
+	if len(errs) > 0 {
+		results := make([]client.HostImportRowResult, 0, len(errs))
+		for _, row := range rows {
+			if e, ok := errs[row.Line]; ok {
+				results = append(results, client.HostImportRowResult{Line: row.Line, Name: row.Name, Error: e})
+			}
+		}
+		displayHostImport(results)
+		os.Exit(-1)
+	}
+
+	themis := newClient()
+	result, err := themis.ImportHosts(rows, DryRun)
+	exitOnError(err)
+
+	displayHostImport(result.Rows)
+	failed := false
+	for _, r := range result.Rows {
+		failed = failed || len(r.Error) > 0
+	}
+	if DryRun && !failed {
+		fmt.Println("Dry run, nothing is added.")
+	} else if !result.Imported {
+		fmt.Println("Rows failed, nothing is added.")
+	}
+	if failed {
+		os.Exit(-1)
+	}
+}
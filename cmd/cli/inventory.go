@@ -0,0 +1,266 @@
+package cli
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	texttable "github.com/syohex/go-texttable"
+	"golang.org/x/crypto/scrypt"
+	"gopkg.in/yaml.v2"
+	"themis/client"
+)
+
+const (
+	// encrypted passwords are prefixed so that they are never taken as plain text
+	encryptedPrefix = "enc:"
+	passphraseEnv   = "THEMIS_PASSPHRASE"
+)
+
+var (
+	ExportFile     string
+	ImportFile     string
+	InventoryFmt   string
+	Redact         bool
+	Encrypt        bool
+	PassphraseFile string
+	Prune          bool
+)
+
+func NewExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export hosts, states, fencers and groups",
+		Run:   exportCommandFunc,
+	}
+	cmd.Flags().StringVarP(&ExportFile, "output", "o", "-", "file to write, - for stdout")
+	cmd.Flags().StringVar(&InventoryFmt, "format", "", "yaml or json, default by extension of file, otherwise yaml")
+	cmd.Flags().BoolVar(&Redact, "redact", false, "leave out passwords of fencers")
+	cmd.Flags().BoolVar(&Encrypt, "encrypt", false, "encrypt passwords of fencers with a passphrase")
+	cmd.Flags().StringVar(&PassphraseFile, "passphrase-file", "", "file holding passphrase, default $"+passphraseEnv)
+	return cmd
+}
+
+func NewImportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import hosts, states, fencers and groups, hosts are matched by name",
+		Run:   importCommandFunc,
+	}
+	cmd.Flags().StringVarP(&ImportFile, "file", "f", "", "file to read, - for stdin")
+	cmd.Flags().StringVar(&InventoryFmt, "format", "", "yaml or json, default by extension of file, otherwise yaml")
+	cmd.Flags().BoolVar(&DryRun, "dry-run", false, "only show changes without applying them")
+	cmd.Flags().BoolVar(&Prune, "prune", false, "delete hosts, states, fencers and imported groups absent from file")
+	cmd.Flags().StringVar(&PassphraseFile, "passphrase-file", "", "file holding passphrase, default $"+passphraseEnv)
+	cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(-1)
+	}
+}
+
+// inventoryFormat returns format of file, yaml unless told otherwise.
+func inventoryFormat(file string) string {
+	if len(InventoryFmt) > 0 {
+		return InventoryFmt
+	} else if strings.ToLower(filepath.Ext(file)) == ".json" {
+		return "json"
+	}
+	return "yaml"
+}
+
+func exportCommandFunc(cmd *cobra.Command, args []string) {
+	if Redact && Encrypt {
+		exitOnError(errors.New("--redact and --encrypt can not be used together"))
+	}
+	themis := newClient()
+	inventory, err := themis.ExportInventory(Redact)
+	exitOnError(err)
+
+	if Encrypt {
+		passphrase, err := readPassphrase()
+		exitOnError(err)
+		exitOnError(encryptInventory(&inventory, passphrase))
+	}
+
+	var data []byte
+	switch inventoryFormat(ExportFile) {
+	case "json":
+		data, err = json.MarshalIndent(&inventory, "", "  ")
+		data = append(data, '\n')
+	case "yaml":
+		data, err = yaml.Marshal(&inventory)
+	default:
+		err = fmt.Errorf("unsupported format %s", InventoryFmt)
+	}
+	exitOnError(err)
+
+	if ExportFile == "-" {
+		os.Stdout.Write(data)
+		return
+	}
+	// file holds credentials
+	exitOnError(ioutil.WriteFile(ExportFile, data, 0600))
+}
+
+func importCommandFunc(cmd *cobra.Command, args []string) {
+	var data []byte
+	var err error
+	if ImportFile == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(ImportFile)
+	}
+	exitOnError(err)
+
+	var inventory client.Inventory
+	switch inventoryFormat(ImportFile) {
+	case "json":
+		err = json.Unmarshal(data, &inventory)
+	case "yaml":
+		err = yaml.Unmarshal(data, &inventory)
+	default:
+		err = fmt.Errorf("unsupported format %s", InventoryFmt)
+	}
+	exitOnError(err)
+	if inventory.Version > client.InventoryVersion {
+		exitOnError(fmt.Errorf("inventory version %d is newer than this client", inventory.Version))
+	}
+
+	if inventory.Encryption != nil {
+		passphrase, err := readPassphrase()
+		exitOnError(err)
+		exitOnError(decryptInventory(&inventory, passphrase))
+	}
+
+	themis := newClient()
+	result, err := themis.ImportInventory(&inventory, DryRun, Prune)
+	exitOnError(err)
+
+	table := &texttable.TextTable{}
+	table.SetHeader("Kind", "Name", "Action", "Detail", "Error")
+	for _, c := range result.Changes {
+		table.AddRow(c.Kind, c.Name, c.Action, c.Detail, c.Error)
+	}
+	fmt.Println(table.Draw())
+	if DryRun {
+		fmt.Println("Dry run, nothing is changed.")
+	} else if !result.Imported {
+		fmt.Println("Nothing is changed, fix errors and import again.")
+	}
+}
+
+func readPassphrase() ([]byte, error) {
+	var passphrase string
+	if len(PassphraseFile) > 0 {
+		data, err := ioutil.ReadFile(PassphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		passphrase = string(data)
+	} else {
+		passphrase = os.Getenv(passphraseEnv)
+	}
+	passphrase = strings.TrimRight(passphrase, "\r\n")
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase is required, use --passphrase-file or $%s", passphraseEnv)
+	}
+	return []byte(passphrase), nil
+}
+
+// inventoryCipher derives AES-256-GCM from passphrase and salt by scrypt.
+func inventoryCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptInventory encrypts passwords of fencers, the rest stays readable.
+func encryptInventory(inventory *client.Inventory, passphrase []byte) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := inventoryCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	for i := range inventory.Hosts {
+		for j := range inventory.Hosts[i].Fencers {
+			fencer := &inventory.Hosts[i].Fencers[j]
+			if len(fencer.Password) == 0 {
+				continue
+			}
+			nonce := make([]byte, aead.NonceSize())
+			if _, err := rand.Read(nonce); err != nil {
+				return err
+			}
+			sealed := aead.Seal(nonce, nonce, []byte(fencer.Password), nil)
+			fencer.Password = encryptedPrefix + base64.StdEncoding.EncodeToString(sealed)
+		}
+	}
+	inventory.Encryption = &client.InventoryEncryption{
+		Cipher: "aes-256-gcm",
+		KDF:    "scrypt",
+		Salt:   base64.StdEncoding.EncodeToString(salt),
+	}
+	return nil
+}
+
+func decryptInventory(inventory *client.Inventory, passphrase []byte) error {
+	e := inventory.Encryption
+	if e.Cipher != "aes-256-gcm" || e.KDF != "scrypt" {
+		return fmt.Errorf("unsupported encryption %s with %s", e.Cipher, e.KDF)
+	}
+	salt, err := base64.StdEncoding.DecodeString(e.Salt)
+	if err != nil {
+		return err
+	}
+	aead, err := inventoryCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	for i := range inventory.Hosts {
+		for j := range inventory.Hosts[i].Fencers {
+			fencer := &inventory.Hosts[i].Fencers[j]
+			if !strings.HasPrefix(fencer.Password, encryptedPrefix) {
+				continue
+			}
+			sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(fencer.Password, encryptedPrefix))
+			if err != nil {
+				return err
+			} else if len(sealed) < aead.NonceSize() {
+				return fmt.Errorf("invalid password of fencer %s", fencer.Host)
+			}
+			nonce := sealed[:aead.NonceSize()]
+			password, err := aead.Open(nil, nonce, sealed[aead.NonceSize():], nil)
+			if err != nil {
+				return errors.New("decrypt passwords failed, wrong passphrase?")
+			}
+			fencer.Password = string(password)
+		}
+	}
+	inventory.Encryption = nil
+	return nil
+}
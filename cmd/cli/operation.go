@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	texttable "github.com/syohex/go-texttable"
+	"themis/client"
+)
+
+func NewOperationCommand() *cobra.Command {
+	operationCmd := &cobra.Command{
+		Use:   "operation",
+		Short: "Fence operation related commands",
+	}
+
+	operationCmd.AddCommand(newOperationListCommand())
+	operationCmd.AddCommand(newOperationGetCommand())
+
+	return operationCmd
+}
+
+func newOperationListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list all operations",
+		Run:   operationListCommandFunc,
+	}
+	return cmd
+}
+
+func newOperationGetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get <operation id>",
+		Short: "show an operation and its steps",
+		Run:   operationGetCommandFunc,
+	}
+	return cmd
+}
+
+func displayOperations(ops []client.Operation) {
+	table := &texttable.TextTable{}
+
+	table.SetHeader("ID", "Host", "Type", "Status",
+		"Leader", "Instances", "CreatedAt", "Message")
+	for _, op := range ops {
+		table.AddRow(
+			fmt.Sprint(op.ID),
+			op.HostName,
+			op.Type,
+			op.Status,
+			op.LeaderName,
+			strings.Join(op.Instances, ","),
+			op.CreatedAt.Format(time.RFC3339),
+			op.Message,
+		)
+	}
+
+	fmt.Println(table.Draw())
+}
+
+func displayOperationSteps(steps []client.OperationStep) {
+	table := &texttable.TextTable{}
+
+	table.SetHeader("Seq", "Name", "Type", "Status",
+		"StartedAt", "FinishedAt", "Message")
+	for _, s := range steps {
+		table.AddRow(
+			fmt.Sprint(s.Seq),
+			s.Name,
+			s.Type,
+			s.Status,
+			s.StartedAt.Format(time.RFC3339),
+			s.FinishedAt.Format(time.RFC3339),
+			s.Message,
+		)
+	}
+
+	fmt.Println(table.Draw())
+}
+
+func getOperationId(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("ERROR: you must specify operation id")
+		os.Exit(-1)
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Println("ERROR: you must specify a valid id")
+		os.Exit(-1)
+	}
+	return id
+}
+
+func operationListCommandFunc(cmd *cobra.Command, args []string) {
+	themis := newClient()
+
+	ops, err := themis.ListOperations()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	displayOperations(ops)
+}
+
+func operationGetCommandFunc(cmd *cobra.Command, args []string) {
+	themis := newClient()
+
+	op, err := themis.ShowOperation(getOperationId(args))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	displayOperations([]client.Operation{op})
+	displayOperationSteps(op.Steps)
+}
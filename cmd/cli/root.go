@@ -3,18 +3,33 @@ package cli
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
+	"themis/client"
+
+	"github.com/BurntSushi/toml"
 	"github.com/spf13/cobra"
 )
 
 type GlobalFlags struct {
-	Debug bool
-	Url   string
+	Debug  bool
+	Url    string
+	Token  string
+	Config string
+}
+
+// FileConfig is the config file of themisctl, flags and environment
+// variables take precedence over it.
+type FileConfig struct {
+	Url   string `toml:"url"`
+	Token string `toml:"token"`
 }
 
 const (
 	cliName        = "themisctl"
 	cliDescription = "A simple command line client for themis."
+
+	tokenEnv = "THEMIS_TOKEN"
 )
 
 var (
@@ -22,6 +37,8 @@ var (
 		Use:        cliName,
 		Short:      cliDescription,
 		SuggestFor: []string{"themisctl"},
+
+		PersistentPreRunE: loadConfig,
 	}
 	globalFlags = GlobalFlags{}
 )
@@ -30,10 +47,16 @@ func init() {
 
 	rootCmd.PersistentFlags().BoolVar(&globalFlags.Debug, "debug", false, "enable client-side debug logging")
 	rootCmd.PersistentFlags().StringVar(&globalFlags.Url, "url", "http://127.0.0.1:7878", "themis server URL")
+	rootCmd.PersistentFlags().StringVar(&globalFlags.Token, "token", "", "bearer token of themis server, defaults to $"+tokenEnv)
+	rootCmd.PersistentFlags().StringVar(&globalFlags.Config, "config", defaultConfigPath(), "config file with url and token")
 
 	rootCmd.AddCommand(
 		NewHostCommand(),
 		NewFencerCommand(),
+		NewOperationCommand(),
+		NewClusterCommand(),
+		NewExportCommand(),
+		NewImportCommand(),
 	)
 }
 
@@ -41,6 +64,48 @@ func init() {
 	cobra.EnablePrefixMatching = true
 }
 
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "themis", "themisctl.toml")
+}
+
+// loadConfig fills url and token which are not given by flags, from the
+// environment variable then the config file.
+func loadConfig(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	if !flags.Changed("token") {
+		globalFlags.Token = os.Getenv(tokenEnv)
+	}
+
+	if len(globalFlags.Config) == 0 {
+		return nil
+	}
+	var config FileConfig
+	if _, err := toml.DecodeFile(globalFlags.Config, &config); err != nil {
+		// the default config file is optional
+		if os.IsNotExist(err) && !flags.Changed("config") {
+			return nil
+		}
+		return fmt.Errorf("can not load config file %s: %s", globalFlags.Config, err)
+	}
+	if !flags.Changed("url") && len(config.Url) > 0 {
+		globalFlags.Url = config.Url
+	}
+	if len(globalFlags.Token) == 0 {
+		globalFlags.Token = config.Token
+	}
+	return nil
+}
+
+func newClient() *client.ThemisClient {
+	themis := client.NewThemisClient(globalFlags.Url)
+	themis.SetToken(globalFlags.Token)
+	return themis
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	texttable "github.com/syohex/go-texttable"
+	"themis/config"
+	"themis/database"
+)
+
+var (
+	migrateTarget  int
+	rollbackTarget int
+)
+
+func NewDBCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db <subcommand>",
+		Short: "Manage schema of database.",
+	}
+
+	cmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "Path to toml config file.")
+
+	cmd.AddCommand(newDBMigrateCommand())
+	cmd.AddCommand(newDBStatusCommand())
+	cmd.AddCommand(newDBRollbackCommand())
+
+	return cmd
+}
+
+func newDBMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade schema of database.",
+		Run:   dbMigrateCommandFunc,
+	}
+
+	cmd.Flags().IntVar(&migrateTarget, "to", 0, "target schema version, default the latest version.")
+
+	return cmd
+}
+
+func newDBStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show applied and pending migrations.",
+		Run:   dbStatusCommandFunc,
+	}
+}
+
+func newDBRollbackCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Revert schema of database.",
+		Run:   dbRollbackCommandFunc,
+	}
+
+	cmd.Flags().IntVar(&rollbackTarget, "to", -1, "target schema version, default the previous version.")
+
+	return cmd
+}
+
+// openDatabase connects to database without checking its schema.
+func openDatabase() {
+	themisCfg := config.NewConfig(configFile)
+
+	// log to console
+	themisCfg.LogFile = ""
+	themisCfg.SetupLogging()
+
+	database.Open(&themisCfg.Database)
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(-1)
+	}
+}
+
+func dbMigrateCommandFunc(cmd *cobra.Command, args []string) {
+	openDatabase()
+	exitOnError(database.Migrate(migrateTarget))
+
+	version, err := database.SchemaVersionGet()
+	exitOnError(err)
+	fmt.Printf("Schema is at version %d.\n", version)
+}
+
+func dbStatusCommandFunc(cmd *cobra.Command, args []string) {
+	openDatabase()
+	status, err := database.SchemaStatus()
+	exitOnError(err)
+
+	table := &texttable.TextTable{}
+	table.SetHeader("Version", "Description", "Status", "AppliedAt")
+	for _, s := range status {
+		state := "pending"
+		appliedAt := ""
+		if s.Applied {
+			state = "applied"
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Version > database.LatestVersion() {
+			state = "unknown"
+		}
+		table.AddRow(fmt.Sprint(s.Version), s.Description, state, appliedAt)
+	}
+	fmt.Println(table.Draw())
+}
+
+func dbRollbackCommandFunc(cmd *cobra.Command, args []string) {
+	openDatabase()
+	exitOnError(database.Rollback(rollbackTarget))
+
+	version, err := database.SchemaVersionGet()
+	exitOnError(err)
+	fmt.Printf("Schema is at version %d.\n", version)
+}
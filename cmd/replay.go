@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	texttable "github.com/syohex/go-texttable"
+	"themis/config"
+	"themis/database"
+	"themis/monitor"
+)
+
+var (
+	replayFrom string
+	replayTo   string
+)
+
+func NewReplayCommand() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "replay",
+		Short: "Replay journal events through a policy engine in memory.",
+		Run:   replayMain,
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to toml config file.")
+	cmd.Flags().StringVar(&replayFrom, "from", "", "replay events received since, in RFC3339 format.")
+	cmd.Flags().StringVar(&replayTo, "to", "", "replay events received until, in RFC3339 format, default now.")
+
+	return &cmd
+}
+
+func parseReplayTime(name, value string, defaultTime time.Time) time.Time {
+	if len(value) == 0 {
+		return defaultTime
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		fmt.Printf("ERROR: invalid --%s: %s\n", name, err)
+		os.Exit(-1)
+	}
+	return t
+}
+
+func replayMain(cmd *cobra.Command, args []string) {
+
+	// load configurations
+	themisCfg := config.NewConfig(configFile)
+
+	// log to console
+	themisCfg.LogFile = ""
+	themisCfg.SetupLogging()
+
+	if len(replayFrom) == 0 {
+		fmt.Println("ERROR: you must specify --from")
+		os.Exit(-1)
+	}
+	from := parseReplayTime("from", replayFrom, time.Time{})
+	to := parseReplayTime("to", replayTo, time.Now())
+
+	journal := monitor.NewJournal(&themisCfg.Journal)
+	if journal == nil {
+		fmt.Println("ERROR: journal is disabled in configurations")
+		os.Exit(-1)
+	}
+	if themisCfg.Journal.Backend == "database" {
+		// never migrate the database of a deployment from an offline tool
+		database.Open(&themisCfg.Database)
+		if err := database.CheckSchema(); err != nil {
+			fmt.Println("ERROR:", err)
+			os.Exit(-1)
+		}
+	}
+	events, err := journal.Read(from, to)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	database.Close()
+	plog.Infof("Replay %d events.", len(events))
+
+	// replay works on a scratch store in memory
+	store := database.NewMemoryStore()
+	monitor.Replay(themisCfg, store, events)
+	displayReplay(store)
+}
+
+// displayReplay prints all status transitions made during replay.
+func displayReplay(store database.Store) {
+	hosts, err := store.HostGetAll()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	names := map[int]string{}
+	histories := make([]*database.HostStatusHistory, 0)
+	for _, host := range hosts {
+		names[host.Id] = host.Name
+		records, err := store.HostHistoryGetAll(host.Id)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		histories = append(histories, records...)
+	}
+	sort.Slice(histories, func(i, j int) bool {
+		return histories[i].Id < histories[j].Id
+	})
+
+	table := &texttable.TextTable{}
+	table.SetHeader("Time", "Host", "From", "To", "Reason", "States")
+	for _, h := range histories {
+		states := make([]string, 0, len(h.States))
+		for tag, failedTimes := range h.States {
+			states = append(states, fmt.Sprintf("%s=%d", tag, failedTimes))
+		}
+		sort.Strings(states)
+		table.AddRow(
+			h.CreatedAt.Format(time.RFC3339),
+			names[h.HostId], h.OldStatus, h.NewStatus, h.Reason,
+			strings.Join(states, ","),
+		)
+	}
+	fmt.Println(table.Draw())
+}
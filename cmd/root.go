@@ -37,6 +37,8 @@ func init() {
 	rootCmd.AddCommand(
 		NewMonitorCommand(),
 		NewAgentCommand(),
+		NewReplayCommand(),
+		NewDBCommand(),
 	)
 }
 
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/BurntSushi/toml"
@@ -19,22 +21,154 @@ type ThemisConfig struct {
 	// API configurations
 	BindHost string
 	BindPort int
+	// URL other monitors use to reach our API, defaults to bind address
+	AdvertiseURL string
+	// API is open to anyone unless tokens or keystone are configured
+	Auth AuthConfig
 
 	Database DatabaseConfig
+	Election ElectionConfig
+	// replicate state among monitors instead of sharing a database
+	Raft     RaftConfig
 	Monitors map[string]MonitorConfig
 
 	Fence FenceConfig
 
+	// journal of all events received by the leader
+	Journal JournalConfig
+
+	// recovery pipelines keyed by host group
+	Recovery map[string]RecoveryConfig
+
+	// hooks executed around each phase of fence operation
+	Hooks []HookConfig
+
 	Openstack OpenstackConfig
+
+	Kubernetes KubernetesConfig
 }
 
 type DatabaseConfig struct {
 	Driver   string
 	Host     string
+	Port     int
 	Username string
 	Password string
 	Name     string
 	Path     string // for sqlite3
+	// for postgres, disable, require, verify-ca or verify-full
+	SSLMode     string
+	SSLRootCert string
+	// connection pool, 0 means no limit on open connections and the
+	// default of database/sql on idle connections
+	MaxOpenConns int
+	MaxIdleConns int
+	// seconds a connection is reused, 0 means forever
+	ConnMaxLifetime int
+	// seconds to keep retrying when database is unavailable at startup
+	ConnectTimeout int
+	// upgrade schema when monitor starts, otherwise run `themis db migrate`
+	AutoMigrate bool
+}
+
+type ElectionConfig struct {
+	// seconds a leadership lasts without being renewed
+	Term int
+	// seconds between renewals of leadership, must be less than Term / 3
+	ProclaimInterval int
+	// max seconds of random delay added to campaign retries
+	Jitter int
+}
+
+func (cfg *ElectionConfig) validate() error {
+	if cfg.Term <= 0 || cfg.ProclaimInterval <= 0 || cfg.Jitter < 0 {
+		return errors.New("election term and proclaimInterval must be positive, jitter must not be negative")
+	}
+	if cfg.ProclaimInterval*3 >= cfg.Term {
+		return fmt.Errorf("election proclaimInterval %d must be less than term / 3", cfg.ProclaimInterval)
+	}
+	return nil
+}
+
+type AuthConfig struct {
+	Tokens   []TokenConfig
+	Keystone KeystoneAuthConfig
+}
+
+type TokenConfig struct {
+	// who holds the token, for logs
+	Name  string
+	Token string
+	// reader, operator or admin
+	Role string
+}
+
+type KeystoneAuthConfig struct {
+	// keystone tokens are accepted if set
+	AuthURL  string
+	CAFile   string
+	Insecure bool
+	// seconds validated tokens are cached
+	CacheTTL int
+	// only tokens scoped to the project are accepted, it is given by id or
+	// by name together with name of its domain
+	ProjectId     string
+	ProjectName   string
+	ProjectDomain string
+	// themis roles keyed by keystone roles, roles not listed grant nothing
+	Roles map[string]string
+}
+
+var authRoles = map[string]bool{"reader": true, "operator": true, "admin": true}
+
+// Enabled tells if requests to API must be authenticated.
+func (cfg *AuthConfig) Enabled() bool {
+	return len(cfg.Tokens) > 0 || len(cfg.Keystone.AuthURL) > 0
+}
+
+func (cfg *AuthConfig) validate() error {
+	tokens := map[string]bool{}
+	for _, t := range cfg.Tokens {
+		if len(t.Token) == 0 {
+			return fmt.Errorf("token of %q must not be empty", t.Name)
+		} else if tokens[t.Token] {
+			return fmt.Errorf("token of %q is duplicated", t.Name)
+		} else if !authRoles[t.Role] {
+			return fmt.Errorf("role %q of token %q must be reader, operator or admin", t.Role, t.Name)
+		}
+		tokens[t.Token] = true
+	}
+	return cfg.Keystone.validate()
+}
+
+func (cfg *KeystoneAuthConfig) validate() error {
+	if len(cfg.AuthURL) == 0 {
+		return nil
+	}
+	if len(cfg.ProjectId) == 0 && (len(cfg.ProjectName) == 0 || len(cfg.ProjectDomain) == 0) {
+		return fmt.Errorf("keystone projectId, or projectName with projectDomain must be set")
+	}
+	if len(cfg.Roles) == 0 {
+		return fmt.Errorf("keystone roles must be mapped to reader, operator or admin")
+	}
+	for keystoneRole, role := range cfg.Roles {
+		if !authRoles[role] {
+			return fmt.Errorf("role %q mapped from keystone role %q must be reader, operator or admin", role, keystoneRole)
+		}
+	}
+	return nil
+}
+
+type RaftConfig struct {
+	Enabled bool
+	// unique name of this node, defaults to hostname
+	NodeId string
+	// address raft listens on for other nodes
+	BindAddr string
+	// directory to save raft logs and snapshots
+	DataDir string
+	// all nodes of the cluster including this one, keyed by node id
+	Peers map[string]string
 }
 
 type MonitorConfig struct {
@@ -42,8 +176,34 @@ type MonitorConfig struct {
 	Address string
 }
 
+type JournalConfig struct {
+	// none, database or file
+	Backend string
+	// path of journal file, a new file is started every day
+	Path string
+	// days to keep events, 0 means forever
+	Retention int
+}
+
 type FenceConfig struct {
 	DisableFenceOps bool
+	// verify certificates of redfish BMCs with CA file, or skip verification
+	RedfishCAFile   string
+	RedfishInsecure bool
+}
+
+type RecoveryConfig struct {
+	Steps []RecoveryStepConfig
+}
+
+type RecoveryStepConfig struct {
+	// disable-service, evacuate, kubernetes, webhook or script
+	Type string
+	// optional, defaults to Type
+	Name    string
+	URL     string // for webhook
+	Command string // for script
+	Timeout int    // seconds
 }
 
 type OpenstackConfig struct {
@@ -53,6 +213,29 @@ type OpenstackConfig struct {
 	ProjectName string
 	DomainName  string
 	RegionName  string
+
+	// interval in seconds to sync hosts from nova, 0 means disabled.
+	SyncInterval int
+}
+
+type HookConfig struct {
+	// pre-fence, post-fence, pre-evacuate or post-evacuate
+	Phase string
+	// exec or webhook
+	Type    string
+	Command string // for exec
+	URL     string // for webhook
+	Timeout int    // seconds
+	// must-succeed or best-effort
+	Policy string
+}
+
+type KubernetesConfig struct {
+	APIServer string
+	Token     string
+	TokenFile string
+	CAFile    string
+	Insecure  bool
 }
 
 func NewConfig(configFile string) *ThemisConfig {
@@ -66,6 +249,12 @@ func NewConfig(configFile string) *ThemisConfig {
 			plog.Fatalf("Failed to load config file due to %s\n", err)
 		}
 	}
+	if err := defaultCfg.Election.validate(); err != nil {
+		plog.Fatalf("Invalid configurations: %s\n", err)
+	}
+	if err := defaultCfg.Auth.validate(); err != nil {
+		plog.Fatalf("Invalid configurations: %s\n", err)
+	}
 	return defaultCfg
 }
 
@@ -76,17 +265,51 @@ func NewDefaultConfig() *ThemisConfig {
 		LogFile:  "themis.log",
 		BindHost: "localhost",
 		BindPort: 7878,
+		Auth: AuthConfig{
+			Tokens: []TokenConfig{},
+			Keystone: KeystoneAuthConfig{
+				CacheTTL: 300,
+			},
+		},
 		Database: DatabaseConfig{
 			Driver:   "sqlite3",
 			Path:     "themis.db",
 			Host:     "",
 			Username: "",
 			Password: "",
+
+			ConnMaxLifetime: 300,
+			ConnectTimeout:  60,
+			AutoMigrate:     true,
+		},
+		Election: ElectionConfig{
+			Term:             30,
+			ProclaimInterval: 6,
+			Jitter:           5,
+		},
+		Raft: RaftConfig{
+			Enabled:  false,
+			BindAddr: "127.0.0.1:7879",
+			DataDir:  "raft",
+			Peers:    map[string]string{},
 		},
 		Monitors: map[string]MonitorConfig{},
 		Fence: FenceConfig{
 			DisableFenceOps: false,
 		},
+		Journal: JournalConfig{
+			Backend:   "none",
+			Path:      "events.journal",
+			Retention: 7,
+		},
+		Recovery: map[string]RecoveryConfig{
+			"default": {
+				Steps: []RecoveryStepConfig{
+					{Type: "disable-service"},
+					{Type: "evacuate"},
+				},
+			},
+		},
 		Openstack: OpenstackConfig{
 			AuthURL:     "http://localhost:5000",
 			Username:    "admin",
@@ -94,6 +317,15 @@ func NewDefaultConfig() *ThemisConfig {
 			ProjectName: "admin",
 			DomainName:  "default",
 			RegionName:  "RegionOne",
+
+			SyncInterval: 0,
+		},
+		Hooks: []HookConfig{},
+		Kubernetes: KubernetesConfig{
+			APIServer: "https://kubernetes.default.svc",
+			TokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+			CAFile:    "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt",
+			Insecure:  false,
 		},
 	}
 }
@@ -0,0 +1,29 @@
+package config
+
+import "testing"
+
+func TestElectionConfigValidate(t *testing.T) {
+	if err := NewDefaultConfig().Election.validate(); err != nil {
+		t.Errorf("default election is invalid: %s", err)
+	}
+
+	for _, c := range []struct {
+		term, proclaimInterval, jitter int
+		valid                          bool
+	}{
+		{term: 10, proclaimInterval: 3, valid: true},
+		{term: 10, proclaimInterval: 3, jitter: 2, valid: true},
+		// a term must last longer than three proclaims
+		{term: 9, proclaimInterval: 3},
+		{term: 10, proclaimInterval: 4},
+		{term: 0, proclaimInterval: 1},
+		{term: 10, proclaimInterval: 0},
+		{term: 10, proclaimInterval: -1},
+		{term: 10, proclaimInterval: 3, jitter: -1},
+	} {
+		cfg := &ElectionConfig{Term: c.term, ProclaimInterval: c.proclaimInterval, Jitter: c.jitter}
+		if err := cfg.validate(); (err == nil) != c.valid {
+			t.Errorf("election %+v is valid %t: %v", *cfg, err == nil, err)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package database
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/coreos/pkg/capnslog"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/go-xorm/xorm"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 
 	"themis/config"
@@ -14,20 +18,55 @@ import (
 
 var plog = capnslog.NewPackageLogger("themis", "database")
 
+var (
+	ErrHostNotFound = registerError(errors.New("host not found."))
+	ErrHostBusy     = registerError(errors.New("an operation is in progress on host."))
+	ErrConflict     = registerError(errors.New("resource has been changed by others, reload and try again."))
+)
+
 var (
 	engine    *xorm.Engine
 	allTables []interface{}
 )
 
+// backoff of retrying to connect to database at startup
+const (
+	connectBackoff    = time.Second
+	maxConnectBackoff = 30 * time.Second
+)
+
+// status of operations in progress, same as monitor.OperationRunning
+const operationRunning = "running"
+
+// Engine connects to database and makes sure its schema matches this binary.
 func Engine(cfg *config.DatabaseConfig) *xorm.Engine {
+	if engine == nil {
+		Open(cfg)
+		if err := checkSchema(cfg.AutoMigrate); err != nil {
+			plog.Fatal(err)
+		}
+	}
+	return engine
+}
+
+// Open connects to database without checking its schema, it is used to
+// manage schema.
+func Open(cfg *config.DatabaseConfig) *xorm.Engine {
 	var err error
 
 	if engine == nil {
 		url := ""
 		switch cfg.Driver {
 		case "mysql":
-			url = fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=true",
-				cfg.Username, cfg.Password, cfg.Host, cfg.Name)
+			address := cfg.Host
+			if cfg.Port > 0 {
+				address = fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+			}
+			// clientFoundRows makes lease renewal within one second count as affected.
+			url = fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=true&clientFoundRows=true",
+				cfg.Username, cfg.Password, address, cfg.Name)
+		case "postgres":
+			url = postgresURL(cfg)
 		case "sqlite3":
 			url = cfg.Path
 		default:
@@ -39,22 +78,83 @@ func Engine(cfg *config.DatabaseConfig) *xorm.Engine {
 		}
 		engine.DatabaseTZ = time.Local
 		engine.TZLocation = time.Local
-		// fast fail if if we can not connect to database
-		err = engine.Ping()
-		if err != nil {
-			plog.Fatal(err)
+		engine.SetMaxOpenConns(cfg.MaxOpenConns)
+		if cfg.MaxIdleConns > 0 {
+			engine.SetMaxIdleConns(cfg.MaxIdleConns)
 		}
-		// register and update database models
-		err := engine.Sync2(allTables...)
-		if err != nil {
+		engine.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+		// fail if we can not connect to database in time
+		if err := connect(time.Duration(cfg.ConnectTimeout) * time.Second); err != nil {
 			plog.Fatal(err)
 		}
 	}
 	return engine
 }
 
-func HostInsert(host *Host) error {
-	_, err := engine.Insert(host)
+// connect pings database until it succeeds or timeout passes, waiting
+// longer after each failure.
+func connect(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := connectBackoff
+	for {
+		err := engine.Ping()
+		if err == nil {
+			return nil
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return err
+		} else if wait > backoff {
+			wait = backoff
+		}
+		plog.Warningf("Connect to database failed, retry in %s: %s", wait.Round(time.Millisecond), err)
+		time.Sleep(wait)
+		if backoff *= 2; backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
+
+// postgresURL returns DSN of lib/pq, values are quoted so that they can
+// contain spaces.
+func postgresURL(cfg *config.DatabaseConfig) string {
+	options := []string{}
+	add := func(key, value string) {
+		if len(value) > 0 {
+			value = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+			options = append(options, fmt.Sprintf("%s='%s'", key, value))
+		}
+	}
+	add("host", cfg.Host)
+	if cfg.Port > 0 {
+		add("port", strconv.Itoa(cfg.Port))
+	}
+	add("user", cfg.Username)
+	add("password", cfg.Password)
+	add("dbname", cfg.Name)
+	add("sslmode", cfg.SSLMode)
+	add("sslrootcert", cfg.SSLRootCert)
+	return strings.Join(options, " ")
+}
+
+// Close closes engine, so that Engine can connect to another database.
+func Close() error {
+	if engine == nil {
+		return nil
+	}
+	err := engine.Close()
+	engine = nil
+	return err
+}
+
+// HostInsert inserts host together with its fencers, which are linked to
+// the new host.
+func HostInsert(host *Host, fencers ...*HostFencer) error {
+	ops := []*writeOp{insertOp(host)}
+	for _, fencer := range fencers {
+		ops = append(ops, insertOp(fencer).link(0, "HostId"))
+	}
+	_, err := write(ops...)
 	return err
 }
 
@@ -97,20 +197,79 @@ func HostGetByName(hostname string) (*Host, error) {
 }
 
 func HostUpdate(id int, host *Host) error {
-	_, err := engine.ID(id).Update(host)
+	_, err := write(updateOp(id, host))
 	return err
 }
 
 func HostUpdateFields(host *Host, fields ...string) error {
-	_, err := engine.ID(host.Id).Cols(fields...).Update(host)
+	_, err := write(updateOp(host.Id, host, fields...))
 	return err
 }
 
-func HostDelete(id int) error {
-	_, err := engine.ID(id).Delete(new(Host))
+// HostUpdateStatus saves status of host together with a history of the transition.
+func HostUpdateStatus(host *Host, history *HostStatusHistory) error {
+	_, err := write(updateOp(host.Id, host, "status", "disabled", "updated_at"), insertOp(history))
 	return err
 }
 
+// HostEnable saves status of host, failed times of its states and a history
+// of the transition in one transaction.
+func HostEnable(host *Host, states []*HostState, history *HostStatusHistory) error {
+	ops := []*writeOp{updateOp(host.Id, host, "status", "disabled", "updated_at")}
+	for _, state := range states {
+		ops = append(ops, updateOp(state.Id, state, "failed_times"))
+	}
+	_, err := write(append(ops, insertOp(history))...)
+	return err
+}
+
+func HostHistoryGetAll(hostId int) ([]*HostStatusHistory, error) {
+	histories := make([]*HostStatusHistory, 0)
+
+	err := engine.Where("host_id=?", hostId).Desc("id").Iterate(new(HostStatusHistory),
+		func(i int, bean interface{}) error {
+			history := bean.(*HostStatusHistory)
+			histories = append(histories, history)
+			return nil
+		})
+	return histories, err
+}
+
+// hostExists checks that host exists when other ops are applied.
+func hostExists(id int) *writeOp {
+	return checkOp(new(Host), ErrHostNotFound, "id=?", id)
+}
+
+// versionIs fails with ErrConflict if row is not at version, 0 means any version.
+func versionIs(bean interface{}, id, version int) []*writeOp {
+	if version == 0 {
+		return nil
+	}
+	return []*writeOp{checkOp(bean, ErrConflict, "id=? AND version=?", id, version)}
+}
+
+// HostDelete deletes host with everything belongs to it in one transaction,
+// it fails with ErrHostBusy if an operation is in progress on host.
+func HostDelete(id, version int) error {
+	_, err := write(hostDeleteOps(id, version)...)
+	return err
+}
+
+// hostDeleteOps returns ops deleting host with everything belongs to it.
+func hostDeleteOps(id, version int) []*writeOp {
+	ops := append([]*writeOp{hostExists(id)}, versionIs(new(Host), id, version)...)
+	return append(ops,
+		checkAbsentOp(new(Operation), ErrHostBusy, "host_id=? AND status=?", id, operationRunning),
+		deleteWhereOp(new(OperationStep),
+			"operation_id IN (SELECT id FROM "+engine.Quote(tableName(new(Operation)))+" WHERE host_id=?)", id),
+		deleteWhereOp(new(Operation), "host_id=?", id),
+		deleteWhereOp(new(HostState), "host_id=?", id),
+		deleteWhereOp(new(HostFencer), "host_id=?", id),
+		deleteWhereOp(new(HostStatusHistory), "host_id=?", id),
+		deleteOp(id, new(Host)),
+	)
+}
+
 func StateGetAll(hostId int) ([]*HostState, error) {
 	states := make([]*HostState, 0)
 
@@ -123,6 +282,19 @@ func StateGetAll(hostId int) ([]*HostState, error) {
 	return states, err
 }
 
+// StateGetAllHosts returns states of all hosts keyed by host id.
+func StateGetAllHosts() (map[int][]*HostState, error) {
+	states := map[int][]*HostState{}
+
+	err := engine.Asc("id").Iterate(new(HostState),
+		func(i int, bean interface{}) error {
+			state := bean.(*HostState)
+			states[state.HostId] = append(states[state.HostId], state)
+			return nil
+		})
+	return states, err
+}
+
 func StateGetById(id int) (*HostState, error) {
 	var state = HostState{Id: id}
 
@@ -137,22 +309,18 @@ func StateGetById(id int) (*HostState, error) {
 }
 
 func StateInsert(state *HostState) error {
-	_, err := engine.Insert(state)
+	_, err := write(hostExists(state.HostId), insertOp(state))
 	return err
 }
 
+// StateUpdate updates tag and failed times, a state never moves to another host.
 func StateUpdate(id int, state *HostState) error {
-	_, err := engine.ID(id).Update(state)
+	_, err := write(updateOp(id, state, "tag", "failed_times"))
 	return err
 }
 
-func StateUpdateFields(state *HostState, fields ...string) error {
-	_, err := engine.ID(state.Id).Cols(fields...).Update(state)
-	return err
-}
-
-func StateDelete(id int) error {
-	_, err := engine.ID(id).Delete(new(HostState))
+func StateDelete(id, version int) error {
+	_, err := write(append(versionIs(new(HostState), id, version), deleteOp(id, new(HostState)))...)
 	return err
 }
 
@@ -194,16 +362,116 @@ func FencerGetById(id int) (*HostFencer, error) {
 }
 
 func FencerInsert(fencer *HostFencer) error {
-	_, err := engine.Insert(fencer)
+	_, err := write(hostExists(fencer.HostId), insertOp(fencer))
 	return err
 }
 
 func FencerUpdate(id int, fencer *HostFencer) error {
-	_, err := engine.ID(id).Update(fencer)
+	_, err := write(hostExists(fencer.HostId), updateOp(id, fencer))
+	return err
+}
+
+func FencerDelete(id, version int) error {
+	_, err := write(append(versionIs(new(HostFencer), id, version), deleteOp(id, new(HostFencer)))...)
+	return err
+}
+
+// RecoveryGroupGetAll returns recovery groups imported from inventory,
+// sorted by name.
+func RecoveryGroupGetAll() ([]*RecoveryGroup, error) {
+	groups := make([]*RecoveryGroup, 0)
+
+	err := engine.Asc("name").Iterate(new(RecoveryGroup),
+		func(i int, bean interface{}) error {
+			group := bean.(*RecoveryGroup)
+			groups = append(groups, group)
+			return nil
+		})
+	return groups, err
+}
+
+func OperationGetAll(hostId int, status string) ([]*Operation, error) {
+	ops := make([]*Operation, 0)
+
+	session := engine.Desc("id")
+	if hostId > 0 {
+		session = session.Where("host_id=?", hostId)
+	}
+	if len(status) > 0 {
+		session = session.And("status=?", status)
+	}
+	err := session.Iterate(new(Operation),
+		func(i int, bean interface{}) error {
+			op := bean.(*Operation)
+			ops = append(ops, op)
+			return nil
+		})
+	return ops, err
+}
+
+func OperationGetById(id int) (*Operation, error) {
+	var op = Operation{Id: id}
+
+	exist, err := engine.Get(&op)
+	if err != nil {
+		return nil, err
+	} else if exist {
+		return &op, nil
+	} else {
+		return nil, nil
+	}
+}
+
+func OperationGetLatest(hostId int) (*Operation, error) {
+	var op Operation
+
+	exist, err := engine.Where("host_id=?", hostId).Desc("id").Get(&op)
+	if err != nil {
+		return nil, err
+	} else if exist {
+		return &op, nil
+	} else {
+		return nil, nil
+	}
+}
+
+func OperationStepGetAll(operationId int) ([]*OperationStep, error) {
+	steps := make([]*OperationStep, 0)
+
+	err := engine.Where("operation_id=?", operationId).Asc("seq").Iterate(new(OperationStep),
+		func(i int, bean interface{}) error {
+			step := bean.(*OperationStep)
+			steps = append(steps, step)
+			return nil
+		})
+	return steps, err
+}
+
+func JournalAppend(events []*JournalEvent) error {
+	ops := make([]*writeOp, 0, len(events))
+	for _, event := range events {
+		ops = append(ops, insertOp(event))
+	}
+	_, err := write(ops...)
 	return err
 }
 
-func FencerDelete(id int) error {
-	_, err := engine.ID(id).Delete(new(HostFencer))
+// JournalGetRange returns events received within [from, to] in order.
+func JournalGetRange(from, to time.Time) ([]*JournalEvent, error) {
+	events := make([]*JournalEvent, 0)
+
+	err := engine.Where("event_time>=? AND event_time<=?", formatTime(from), formatTime(to)).
+		Asc("event_time", "id").Iterate(new(JournalEvent),
+		func(i int, bean interface{}) error {
+			event := bean.(*JournalEvent)
+			events = append(events, event)
+			return nil
+		})
+	return events, err
+}
+
+// JournalPurge deletes events received before t.
+func JournalPurge(t time.Time) error {
+	_, err := write(deleteWhereOp(new(JournalEvent), "event_time<?", formatTime(t)))
 	return err
 }
@@ -0,0 +1,187 @@
+package database
+
+// HostChanges holds changes made to one host within one policy cycle.
+type HostChanges struct {
+	Host *Host
+	// host is not saved yet
+	New bool
+	// states not saved yet
+	NewStates []*HostState
+	// states whose failed times changed
+	States []*HostState
+	// status transition, nil if status is not changed
+	History *HostStatusHistory
+}
+
+// ops returns ops saving changes, ids of new rows are assigned by write.
+func (c *HostChanges) ops() []*writeOp {
+	ops := make([]*writeOp, 0)
+
+	link := func(op *writeOp) *writeOp {
+		if c.New {
+			return op.link(0, "HostId")
+		}
+		return op
+	}
+	if c.New {
+		c.Host.Id = 0
+		ops = append(ops, insertOp(c.Host))
+	} else if c.History != nil {
+		ops = append(ops, updateOp(c.Host.Id, c.Host, "status", "disabled", "updated_at"))
+	}
+	for _, state := range c.NewStates {
+		state.Id = 0
+		ops = append(ops, link(insertOp(state)))
+	}
+	for _, state := range c.States {
+		ops = append(ops, updateOp(state.Id, state, "failed_times"))
+	}
+	if c.History != nil {
+		c.History.Id = 0
+		ops = append(ops, link(insertOp(c.History)))
+	}
+	return ops
+}
+
+// hostsOps returns ops saving changes of hosts in one write.
+func (g *Guarded) hostsOps(changes ...*HostChanges) []*writeOp {
+	ops := g.check()
+	for _, c := range changes {
+		offset := len(ops)
+		for _, op := range c.ops() {
+			if len(op.LinkField) > 0 {
+				op.LinkOp += offset
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// HostsSave saves changes of all hosts in one transaction. If it fails,
+// changes of every host are saved separately, so that one broken host does
+// not hold back others. It returns error of each host in order.
+func (g *Guarded) HostsSave(changes []*HostChanges) []error {
+	errs := make([]error, len(changes))
+
+	ops := g.hostsOps(changes...)
+	if len(ops) == len(g.check()) {
+		return errs
+	}
+	_, err := write(ops...)
+	if err == nil {
+		return errs
+	} else if err == ErrStaleEpoch {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	plog.Warning("Save changes of all hosts failed, save them one by one: ", err)
+	for i, c := range changes {
+		if ops := g.hostsOps(c); len(ops) > len(g.check()) {
+			_, errs[i] = write(ops...)
+		}
+	}
+	return errs
+}
+
+// HostImport holds changes made to one host by an import of inventory.
+type HostImport struct {
+	Host *Host
+	// host is not saved yet
+	New bool
+	// columns of host to update
+	Cols []string
+	// states reset and the transition recorded when host is enabled
+	States        []*HostState
+	History       *HostStatusHistory
+	NewStates     []*HostState
+	DeleteStates  []int
+	NewFencers    []*HostFencer
+	Fencers       []*HostFencer
+	DeleteFencers []int
+}
+
+// ops returns ops saving changes, offset is index of the first op in write.
+func (c *HostImport) ops(offset int) []*writeOp {
+	ops := make([]*writeOp, 0)
+
+	link := func(op *writeOp) *writeOp {
+		if c.New {
+			return op.link(offset, "HostId")
+		}
+		return op
+	}
+	if c.New {
+		c.Host.Id = 0
+		ops = append(ops, insertOp(c.Host))
+	} else {
+		ops = append(ops, hostExists(c.Host.Id))
+		if len(c.Cols) > 0 {
+			ops = append(ops, updateOp(c.Host.Id, c.Host, c.Cols...))
+		}
+	}
+	for _, state := range c.States {
+		ops = append(ops, updateOp(state.Id, state, "failed_times"))
+	}
+	if c.History != nil {
+		c.History.Id = 0
+		ops = append(ops, link(insertOp(c.History)))
+	}
+	for _, state := range c.NewStates {
+		state.Id = 0
+		ops = append(ops, link(insertOp(state)))
+	}
+	for _, id := range c.DeleteStates {
+		ops = append(ops, deleteOp(id, new(HostState)))
+	}
+	for _, fencer := range c.NewFencers {
+		fencer.Id = 0
+		ops = append(ops, link(insertOp(fencer)))
+	}
+	for _, fencer := range c.Fencers {
+		ops = append(ops, updateOp(fencer.Id, fencer))
+	}
+	for _, id := range c.DeleteFencers {
+		ops = append(ops, deleteOp(id, new(HostFencer)))
+	}
+	return ops
+}
+
+// InventoryChanges holds all changes made by an import of inventory.
+type InventoryChanges struct {
+	Hosts []*HostImport
+	// hosts absent from inventory
+	DeleteHosts []int
+	// recovery groups to save, new ones have no id
+	Groups       []*RecoveryGroup
+	DeleteGroups []int
+}
+
+// InventorySave saves all changes of an import in one transaction.
+func InventorySave(c *InventoryChanges) error {
+	ops := make([]*writeOp, 0)
+	for _, h := range c.Hosts {
+		ops = append(ops, h.ops(len(ops))...)
+	}
+	for _, id := range c.DeleteHosts {
+		ops = append(ops, hostDeleteOps(id, 0)...)
+	}
+	for _, group := range c.Groups {
+		if group.Id == 0 {
+			ops = append(ops, insertOp(group))
+		} else {
+			ops = append(ops, updateOp(group.Id, group, "steps", "updated_at"))
+		}
+	}
+	for _, id := range c.DeleteGroups {
+		ops = append(ops, deleteOp(id, new(RecoveryGroup)))
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	_, err := write(ops...)
+	return err
+}
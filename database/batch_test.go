@@ -0,0 +1,161 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInventorySave(t *testing.T) {
+	testGuardedStores(t, func(t *testing.T, store Store) {
+		old := &Host{Name: "old", Status: "active", Disabled: true}
+		gone := &Host{Name: "gone", Status: "active"}
+		for _, host := range []*Host{old, gone} {
+			if err := store.HostInsert(host); err != nil {
+				t.Fatal(err)
+			}
+		}
+		state := &HostState{HostId: old.Id, Tag: "network", FailedTimes: 3}
+		if err := store.StateInsert(state); err != nil {
+			t.Fatal(err)
+		}
+		fencer := &HostFencer{HostId: old.Id, Type: "ipmi", Host: "bmc0", Port: 623, Username: "u", Password: "p"}
+		if err := store.FencerInsert(fencer); err != nil {
+			t.Fatal(err)
+		}
+
+		// old host is enabled and gets a new fencer, gone is deleted
+		old.Disabled, old.Status, old.Group = false, "initializing", "g1"
+		state.FailedTimes = 0
+		fencer.Port = 6230
+		changes := &InventoryChanges{
+			Hosts: []*HostImport{
+				{
+					Host: &Host{Name: "new", Status: "initializing"}, New: true,
+					NewStates:  []*HostState{{Tag: "manage"}, {Tag: "storage"}},
+					NewFencers: []*HostFencer{{Type: "redfish", Host: "bmc1", Port: 443, Username: "u", Password: "p"}},
+				},
+				{
+					Host: old, Cols: []string{"host_group", "status", "disabled", "updated_at"},
+					States:     []*HostState{state},
+					History:    &HostStatusHistory{HostId: old.Id, OldStatus: "active", NewStatus: "initializing"},
+					NewFencers: []*HostFencer{{HostId: old.Id, Type: "ipmi", Host: "bmc2", Port: 623, Username: "u", Password: "p"}},
+					Fencers:    []*HostFencer{fencer},
+				},
+			},
+			DeleteHosts: []int{gone.Id},
+			Groups: []*RecoveryGroup{{Name: "g1", UpdatedAt: time.Now(),
+				Steps: []RecoveryStep{{Type: "script", Command: "true", Timeout: 5}}}},
+		}
+		if err := store.InventorySave(changes); err != nil {
+			t.Fatalf("save inventory failed: %s", err)
+		}
+
+		created, _ := store.HostGetByName("new")
+		if created == nil || created.Id != changes.Hosts[0].Host.Id {
+			t.Fatalf("new host is not saved: %+v", created)
+		}
+		if states, _ := store.StateGetAll(created.Id); len(states) != 2 {
+			t.Errorf("unexpected states of new host %v", states)
+		}
+		if fencers, _ := store.FencerGetByHost(created.Id); len(fencers) != 1 || fencers[0].Host != "bmc1" {
+			t.Errorf("unexpected fencers of new host %v", fencers)
+		}
+
+		saved, _ := store.HostGetById(old.Id)
+		if saved.Disabled || saved.Group != "g1" || saved.Version != 2 || old.Version != 2 {
+			t.Errorf("old host is not enabled: %+v", saved)
+		}
+		if saved, _ := store.StateGetById(state.Id); saved.FailedTimes != 0 {
+			t.Errorf("failed times are not reset: %+v", saved)
+		}
+		if histories, _ := store.HostHistoryGetAll(old.Id); len(histories) != 1 {
+			t.Errorf("unexpected histories %v", histories)
+		}
+		fencers, _ := store.FencerGetByHost(old.Id)
+		if len(fencers) != 2 || fencers[0].Port != 6230 || fencers[1].Host != "bmc2" {
+			t.Errorf("unexpected fencers of old host %v", fencers)
+		}
+		if host, _ := store.HostGetById(gone.Id); host != nil {
+			t.Errorf("host is not deleted")
+		}
+
+		groups, _ := store.RecoveryGroupGetAll()
+		if len(groups) != 1 || groups[0].Name != "g1" || len(groups[0].Steps) != 1 ||
+			groups[0].Steps[0].Command != "true" || groups[0].Version != 1 {
+			t.Fatalf("unexpected groups %+v", groups)
+		}
+
+		// group is updated and new host is deleted
+		group := groups[0]
+		group.Steps = nil
+		err := store.InventorySave(&InventoryChanges{
+			DeleteHosts: []int{created.Id},
+			Groups:      []*RecoveryGroup{group, {Name: "a"}},
+		})
+		if err != nil {
+			t.Fatalf("save inventory failed: %s", err)
+		}
+		groups, _ = store.RecoveryGroupGetAll()
+		if len(groups) != 2 || groups[0].Name != "a" || len(groups[1].Steps) != 0 || groups[1].Version != 2 {
+			t.Fatalf("unexpected groups %+v", groups)
+		}
+		if err := store.InventorySave(&InventoryChanges{DeleteGroups: []int{groups[0].Id}}); err != nil {
+			t.Fatalf("delete group failed: %s", err)
+		}
+		if groups, _ = store.RecoveryGroupGetAll(); len(groups) != 1 {
+			t.Errorf("group is not deleted: %+v", groups)
+		}
+	})
+}
+
+func TestInventorySaveAllOrNothing(t *testing.T) {
+	testGuardedStores(t, func(t *testing.T, store Store) {
+		host := &Host{Name: "node1", Status: "active"}
+		if err := store.HostInsert(host); err != nil {
+			t.Fatal(err)
+		}
+		stale := *host
+		host.Group = "g1"
+		if err := store.HostUpdate(host.Id, host); err != nil {
+			t.Fatal(err)
+		}
+
+		// host has been changed since it was loaded
+		stale.Disabled = true
+		err := store.InventorySave(&InventoryChanges{
+			Hosts: []*HostImport{
+				{Host: &Host{Name: "node2"}, New: true, NewStates: []*HostState{{Tag: "manage"}}},
+				{Host: &stale, Cols: []string{"disabled"}},
+			},
+			Groups: []*RecoveryGroup{{Name: "g1"}},
+		})
+		if err != ErrConflict {
+			t.Fatalf("expect conflict, got %v", err)
+		}
+		if created, _ := store.HostGetByName("node2"); created != nil {
+			t.Errorf("new host is saved")
+		}
+		if groups, _ := store.RecoveryGroupGetAll(); len(groups) != 0 {
+			t.Errorf("groups are saved %v", groups)
+		}
+		if saved, _ := store.HostGetById(host.Id); saved.Disabled {
+			t.Errorf("stale host is saved")
+		}
+
+		// running operations keep hosts from being deleted
+		op := &Operation{HostId: host.Id, HostName: host.Name, Type: "fence", Status: operationRunning}
+		if err := store.Guard(nil).OperationInsert(op, nil); err != nil {
+			t.Fatal(err)
+		}
+		err = store.InventorySave(&InventoryChanges{
+			Hosts:       []*HostImport{{Host: &Host{Name: "node2"}, New: true}},
+			DeleteHosts: []int{host.Id},
+		})
+		if err != ErrHostBusy {
+			t.Fatalf("expect busy host, got %v", err)
+		}
+		if created, _ := store.HostGetByName("node2"); created != nil {
+			t.Errorf("new host is saved")
+		}
+	})
+}
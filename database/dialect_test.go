@@ -0,0 +1,216 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"themis/config"
+)
+
+func TestPostgresURL(t *testing.T) {
+	cfg := &config.DatabaseConfig{
+		Host:        "db.example.com",
+		Port:        5433,
+		Username:    "themis",
+		Password:    `it's a \secret`,
+		Name:        "themis",
+		SSLMode:     "verify-full",
+		SSLRootCert: "/etc/themis/db ca.crt",
+	}
+	expected := `host='db.example.com' port='5433' user='themis' password='it\'s a \\secret' ` +
+		`dbname='themis' sslmode='verify-full' sslrootcert='/etc/themis/db ca.crt'`
+	if url := postgresURL(cfg); url != expected {
+		t.Errorf("unexpected url %s", url)
+	}
+
+	// empty options are left to defaults of lib/pq
+	if url := postgresURL(&config.DatabaseConfig{Host: "localhost", Name: "themis"}); url != "host='localhost' dbname='themis'" {
+		t.Errorf("unexpected url %s", url)
+	}
+}
+
+// testDatabases runs test on SQLite and postgres.
+func testDatabases(t *testing.T, test func(t *testing.T)) {
+	t.Run("sqlite3", func(t *testing.T) {
+		openSQLite(t)
+		test(t)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		openPostgres(t)
+		test(t)
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	testDatabases(t, func(t *testing.T) {
+		host := &Host{Name: "node1", Status: "active", Disabled: true, NovaForcedDown: true}
+		if err := HostInsert(host); err != nil {
+			t.Fatal(err)
+		}
+
+		// boolean columns survive rollback and migration on every driver
+		if err := Rollback(LatestVersion() - 2); err != nil {
+			t.Fatalf("rollback: %s", err)
+		}
+		if err := Migrate(0); err != nil {
+			t.Fatalf("migrate: %s", err)
+		}
+		saved, err := HostGetById(host.Id)
+		if err != nil || saved == nil {
+			t.Fatalf("host is lost: %v", err)
+		}
+		if !saved.Disabled || !saved.NovaForcedDown || saved.NovaDisabled || saved.Version != 1 {
+			t.Errorf("unexpected host %+v", saved)
+		}
+
+		// foreign keys are dropped before tables
+		if err := Rollback(0); err != nil {
+			t.Fatalf("rollback to empty schema: %s", err)
+		}
+		if version, _ := SchemaVersionGet(); version != 0 {
+			t.Errorf("schema is at version %d", version)
+		}
+		if exist, _ := engine.IsTableExist("host"); exist {
+			t.Errorf("table host is not dropped")
+		}
+		if err := Migrate(0); err != nil {
+			t.Fatalf("migrate from empty schema: %s", err)
+		}
+	})
+}
+
+// useMigration appends m to migrations until test ends.
+func useMigration(t *testing.T, m *Migration) {
+	migrations = append(migrations, m)
+	t.Cleanup(func() { migrations = migrations[:len(migrations)-1] })
+}
+
+func TestMigrationFailed(t *testing.T) {
+	testDatabases(t, func(t *testing.T) {
+		useMigration(t, &Migration{
+			Version:     LatestVersion() + 1,
+			Description: "broken",
+			Up: func(s *xorm.Session) error {
+				if err := s.Sync2(new(testTable)); err != nil {
+					return err
+				}
+				_, err := s.Exec("ALTER TABLE no_such_table ADD COLUMN broken INTEGER")
+				return err
+			},
+			Down: func(s *xorm.Session) error {
+				if err := s.DropTable(new(testTable)); err != nil {
+					return err
+				}
+				_, err := s.Exec("DROP TABLE no_such_table")
+				return err
+			},
+		})
+
+		// changes of failed migration are rolled back together with its version
+		if err := Migrate(0); err == nil {
+			t.Fatalf("broken migration succeeds")
+		}
+		if version, _ := SchemaVersionGet(); version != LatestVersion()-1 {
+			t.Errorf("schema is at version %d", version)
+		}
+		if exist, _ := engine.IsTableExist(new(testTable)); exist {
+			t.Errorf("table of failed migration is kept")
+		}
+
+		// migration recorded by others is not run again
+		if _, err := engine.Insert(&SchemaVersion{Version: LatestVersion(), Description: "broken"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := runMigration(migrations[LatestVersion()-1], true); err != nil {
+			t.Errorf("recorded migration runs again: %s", err)
+		}
+		// and reverting it fails without losing the record
+		if err := Rollback(-1); err == nil {
+			t.Fatalf("broken rollback succeeds")
+		}
+		if version, _ := SchemaVersionGet(); version != LatestVersion() {
+			t.Errorf("schema is at version %d", version)
+		}
+		if _, err := engine.Delete(&SchemaVersion{Version: LatestVersion()}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// testTable is created by test migrations only.
+type testTable struct {
+	Id int `xorm:"pk autoincr"`
+}
+
+func TestCheckSchema(t *testing.T) {
+	testDatabases(t, func(t *testing.T) {
+		if err := CheckSchema(); err != nil {
+			t.Fatalf("latest schema is rejected: %s", err)
+		}
+
+		// old schema is reported but never migrated
+		if err := Rollback(LatestVersion() - 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckSchema(); err != ErrSchemaTooOld {
+			t.Errorf("expect schema too old, got %v", err)
+		}
+		if version, _ := SchemaVersionGet(); version != LatestVersion()-1 {
+			t.Errorf("schema is migrated to version %d", version)
+		}
+	})
+}
+
+func TestHostFindDialect(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		base := time.Now().Add(-time.Hour).Truncate(time.Second)
+		for i, name := range []string{"rack_1-a", "rack%1-b", "rack11-c", "rack_1-d"} {
+			host := &Host{Name: name, Group: "g", Status: "active", Disabled: i%2 == 1,
+				UpdatedAt: base.Add(time.Duration(i%2) * time.Minute)}
+			if err := store.HostInsert(host); err != nil {
+				t.Fatal(err)
+			}
+		}
+		names := func(q *HostQuery) string {
+			t.Helper()
+			hosts, err := store.HostFind(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := make([]string, 0)
+			for _, host := range hosts {
+				found = append(found, host.Name)
+			}
+			return strings.Join(found, ",")
+		}
+
+		// wildcards of LIKE are matched literally
+		if found := names(&HostQuery{NamePrefix: "rack_1"}); found != "rack_1-a,rack_1-d" {
+			t.Errorf("hosts with prefix rack_1: %s", found)
+		}
+		if found := names(&HostQuery{NamePrefix: "rack%"}); found != "rack%1-b" {
+			t.Errorf("hosts with prefix rack%%: %s", found)
+		}
+		enabled := false
+		if found := names(&HostQuery{Disabled: &enabled}); found != "rack_1-a,rack11-c" {
+			t.Errorf("enabled hosts: %s", found)
+		}
+
+		// markers in the middle of equal timestamps
+		page := Page{Sort: []SortKey{{Column: "updated_at", Desc: true}}, Limit: 2}
+		if found := names(&HostQuery{Page: page}); found != "rack%1-b,rack_1-d" {
+			t.Errorf("first page: %s", found)
+		}
+		page.Marker = 4
+		if found := names(&HostQuery{Page: page}); found != "rack_1-a,rack11-c" {
+			t.Errorf("second page: %s", found)
+		}
+		page.Marker = 99
+		if _, err := store.HostFind(&HostQuery{Page: page}); err != ErrMarkerNotFound {
+			t.Errorf("unknown marker: %v", err)
+		}
+	})
+}
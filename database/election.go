@@ -0,0 +1,138 @@
+package database
+
+import (
+	"time"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// expiredTime is used to expire a lease, TIMESTAMP can not hold zero time.
+var expiredTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// formatTime formats t the same way xorm saves TIMESTAMP columns, so that
+// raw conditions compare correctly on every driver.
+func formatTime(t time.Time) string {
+	return t.In(engine.DatabaseTZ).Format(timeLayout)
+}
+
+// Released returns true if leader has quit the election.
+func (r *ElectionRecord) Released() bool {
+	return !r.LastUpdate.After(expiredTime)
+}
+
+func ElectionGet(name string) (*ElectionRecord, error) {
+	var record ElectionRecord
+
+	exist, err := engine.Where("election_name=?", name).Get(&record)
+	if err != nil {
+		return nil, err
+	} else if exist {
+		return &record, nil
+	} else {
+		return nil, nil
+	}
+}
+
+// ElectionProclaim acquires or renews the lease of election for leader, and
+// returns the term of the lease.
+//
+// The lease is taken by a compare-and-swap update which only matches if we
+// already hold the lease or the lease has expired, so it works on any driver.
+// Term is increased whenever the lease changes hands. Address of leader is
+// saved together so that others can reach the leader.
+func ElectionProclaim(name, leader, address string, term time.Duration) (int64, bool, error) {
+	session := engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return 0, false, err
+	}
+
+	var current ElectionRecord
+	exist, err := session.Where("election_name=?", name).Get(&current)
+	if err != nil {
+		session.Rollback()
+		return 0, false, err
+	}
+
+	now := time.Now()
+	record := &ElectionRecord{
+		ElectionName: name,
+		LeaderName:   leader,
+		Address:      address,
+		LastUpdate:   now,
+		Term:         1,
+	}
+	if !exist {
+		// nobody has campaigned yet
+		if _, err := session.Insert(record); err != nil {
+			session.Rollback()
+			// lose the race if others inserted at the same time
+			if current, _ := ElectionGet(name); current != nil {
+				return 0, false, nil
+			}
+			return 0, false, err
+		}
+		return record.Term, true, session.Commit()
+	}
+
+	record.Term = current.Term
+	if current.LeaderName != leader || now.Sub(current.LastUpdate) >= term {
+		record.Term = current.Term + 1
+	}
+	affected, err := session.Where("election_name=? AND term=?", name, current.Term).
+		And("(leader_name=? OR last_update<?)", leader, formatTime(now.Add(-term))).
+		Cols("leader_name", "address", "last_update", "term").Update(record)
+	if err != nil {
+		session.Rollback()
+		return 0, false, err
+	}
+	if affected == 0 {
+		session.Rollback()
+		return 0, false, nil
+	}
+	return record.Term, true, session.Commit()
+}
+
+// ElectionQuit gives up the lease if leader holds it. The record is kept
+// so that term keeps increasing.
+func ElectionQuit(name, leader string) error {
+	record := &ElectionRecord{LastUpdate: expiredTime}
+	_, err := engine.Where("election_name=? AND leader_name=?", name, leader).
+		Cols("last_update").Update(record)
+	return err
+}
+
+func ElectionMemberGetAll(name string) ([]*ElectionMember, error) {
+	members := make([]*ElectionMember, 0)
+
+	err := engine.Where("election_name=?", name).Asc("name").Iterate(new(ElectionMember),
+		func(i int, bean interface{}) error {
+			member := bean.(*ElectionMember)
+			members = append(members, member)
+			return nil
+		})
+	return members, err
+}
+
+// ElectionMemberSave records a proclaim of member, term and its start are
+// only saved if newTerm is set.
+func ElectionMemberSave(member *ElectionMember, newTerm bool) error {
+	var current ElectionMember
+
+	exist, err := engine.Where("election_name=? AND name=?",
+		member.ElectionName, member.Name).Get(&current)
+	if err != nil {
+		return err
+	} else if !exist {
+		_, err := write(insertOp(member))
+		return err
+	}
+
+	fields := []string{"address", "last_proclaim"}
+	if newTerm {
+		fields = append(fields, "term", "term_start")
+	}
+	_, err = write(updateOp(current.Id, member, fields...))
+	return err
+}
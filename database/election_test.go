@@ -0,0 +1,165 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testTerm = 30 * time.Second
+
+// expireLease makes lease of election expire as if its leader stopped
+// proclaiming a term ago.
+func expireLease(t *testing.T, store Store, name string) {
+	t.Helper()
+	lastUpdate := time.Now().Add(-2 * testTerm)
+	if m, ok := store.(*memoryStore); ok {
+		m.elections[name].LastUpdate = lastUpdate
+		return
+	}
+	_, err := engine.Where("election_name=?", name).Cols("last_update").
+		Update(&ElectionRecord{LastUpdate: lastUpdate})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func proclaim(t *testing.T, store Store, leader string, expectTerm int64, expectOk bool) {
+	t.Helper()
+	term, ok, err := store.ElectionProclaim("themis", leader, leader+":7878", testTerm)
+	if err != nil {
+		t.Fatalf("%s proclaims: %s", leader, err)
+	}
+	if ok != expectOk || term != expectTerm {
+		t.Fatalf("%s proclaims: term %d ok %v, expect term %d ok %v", leader, term, ok, expectTerm, expectOk)
+	}
+}
+
+func checkLeader(t *testing.T, store Store, leader string, term int64) {
+	t.Helper()
+	record, err := store.ElectionGet("themis")
+	if err != nil || record == nil {
+		t.Fatalf("no election record: %v", err)
+	}
+	if record.LeaderName != leader || record.Address != leader+":7878" || record.Term != term {
+		t.Fatalf("leader is %s at %s of term %d, expect %s of term %d",
+			record.LeaderName, record.Address, record.Term, leader, term)
+	}
+}
+
+func TestElectionProclaim(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		if record, err := store.ElectionGet("themis"); err != nil || record != nil {
+			t.Fatalf("unexpected record %v: %v", record, err)
+		}
+
+		// first campaigner takes the lease
+		proclaim(t, store, "a", 1, true)
+		checkLeader(t, store, "a", 1)
+
+		// others can not take a valid lease, leader renews it in its term
+		proclaim(t, store, "b", 0, false)
+		proclaim(t, store, "a", 1, true)
+		checkLeader(t, store, "a", 1)
+
+		// expired lease is taken by others in a new term
+		expireLease(t, store, "themis")
+		proclaim(t, store, "b", 2, true)
+		proclaim(t, store, "a", 0, false)
+		checkLeader(t, store, "b", 2)
+
+		// leader renewing its own expired lease starts a new term too
+		expireLease(t, store, "themis")
+		proclaim(t, store, "b", 3, true)
+		checkLeader(t, store, "b", 3)
+	})
+}
+
+func TestElectionQuit(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		proclaim(t, store, "a", 1, true)
+
+		// only leader can give up the lease
+		if err := store.ElectionQuit("themis", "b"); err != nil {
+			t.Fatal(err)
+		}
+		proclaim(t, store, "b", 0, false)
+
+		if err := store.ElectionQuit("themis", "a"); err != nil {
+			t.Fatal(err)
+		}
+		record, _ := store.ElectionGet("themis")
+		if !record.Released() {
+			t.Fatalf("lease is not released")
+		}
+		proclaim(t, store, "b", 2, true)
+		checkLeader(t, store, "b", 2)
+	})
+}
+
+func TestElectionConcurrentProclaim(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		for round := 0; round < 3; round++ {
+			if round > 0 {
+				expireLease(t, store, "themis")
+			}
+
+			var wg sync.WaitGroup
+			var mutex sync.Mutex
+			winners := []string{}
+			for i := 0; i < 8; i++ {
+				leader := fmt.Sprintf("m%d-%d", round, i)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, ok, err := store.ElectionProclaim("themis", leader, leader+":7878", testTerm)
+					if err == nil && ok {
+						mutex.Lock()
+						winners = append(winners, leader)
+						mutex.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			// every campaigner may fail on a busy database, but never
+			// more than one wins the same lease
+			if len(winners) > 1 {
+				t.Fatalf("round %d: %v all take the lease", round, winners)
+			} else if len(winners) == 1 {
+				record, _ := store.ElectionGet("themis")
+				if record.LeaderName != winners[0] {
+					t.Fatalf("round %d: %s wins, but %s holds the lease", round, winners[0], record.LeaderName)
+				}
+			}
+		}
+	})
+}
+
+func TestElectionMemberSave(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		start := time.Now().Add(-time.Minute).Truncate(time.Second)
+		member := &ElectionMember{ElectionName: "themis", Name: "a", Address: "a:7878",
+			Term: 1, TermStart: start, LastProclaim: start}
+		if err := store.ElectionMemberSave(member, true); err != nil {
+			t.Fatal(err)
+		}
+
+		// term is only saved if it is new
+		proclaimed := start.Add(30 * time.Second)
+		member = &ElectionMember{ElectionName: "themis", Name: "a", Address: "a:7879",
+			Term: 2, TermStart: proclaimed, LastProclaim: proclaimed}
+		if err := store.ElectionMemberSave(member, false); err != nil {
+			t.Fatal(err)
+		}
+		members, err := store.ElectionMemberGetAll("themis")
+		if err != nil || len(members) != 1 {
+			t.Fatalf("unexpected members %v: %v", members, err)
+		}
+		m := members[0]
+		if m.Address != "a:7879" || !m.LastProclaim.Equal(proclaimed) || m.Term != 1 || !m.TermStart.Equal(start) {
+			t.Fatalf("unexpected member %+v", m)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+const epochCondition = "election_name=? AND leader_name=? AND term=?"
+
+var ErrStaleEpoch = registerError(errors.New("leadership epoch is stale."))
+
+// Epoch identifies one term of leadership, it is used as fencing token so
+// that writes from a stale leader are rejected.
+type Epoch struct {
+	Election string
+	Leader   string
+	Term     int64
+}
+
+func (e *Epoch) args() []interface{} {
+	return []interface{}{e.Election, e.Leader, e.Term}
+}
+
+// EpochValid checks if epoch is still the current term and its lease has not expired.
+func EpochValid(e *Epoch, term time.Duration) (bool, error) {
+	if e == nil {
+		return true, nil
+	}
+	record, err := ElectionGet(e.Election)
+	if err != nil {
+		return false, err
+	}
+	if record == nil || record.LeaderName != e.Leader || record.Term != e.Term {
+		return false, nil
+	}
+	return time.Since(record.LastUpdate) < term, nil
+}
+
+// Guarded performs writes conditioned on an epoch, writes are not guarded
+// if epoch is nil.
+type Guarded struct {
+	epoch *Epoch
+}
+
+func Guard(epoch *Epoch) *Guarded {
+	return &Guarded{epoch: epoch}
+}
+
+func (g *Guarded) update(id int, bean interface{}, fields ...string) error {
+	op := updateOp(id, bean, fields...)
+	if g.epoch != nil {
+		op.Where = "EXISTS (SELECT 1 FROM election_record WHERE " + epochCondition + ")"
+		op.Args = g.epoch.args()
+	}
+	results, err := write(op)
+	if err != nil {
+		return err
+	}
+	if results[0].Affected == 0 && g.epoch != nil {
+		// tell stale epoch from missing row
+		current, err := engine.Where(epochCondition, g.epoch.args()...).Exist(new(ElectionRecord))
+		if err != nil {
+			return err
+		} else if !current {
+			return ErrStaleEpoch
+		}
+	}
+	return nil
+}
+
+// check returns an op which fails the write if epoch is not the current term.
+func (g *Guarded) check() []*writeOp {
+	if g.epoch == nil {
+		return nil
+	}
+	return []*writeOp{checkOp(new(ElectionRecord), ErrStaleEpoch, epochCondition, g.epoch.args()...)}
+}
+
+func (g *Guarded) HostUpdateFields(host *Host, fields ...string) error {
+	return g.update(host.Id, host, fields...)
+}
+
+// HostUpdateStatus saves status of host together with a history of the transition.
+func (g *Guarded) HostUpdateStatus(host *Host, history *HostStatusHistory) error {
+	ops := append(g.check(), updateOp(host.Id, host, "status", "disabled", "updated_at"), insertOp(history))
+	_, err := write(ops...)
+	return err
+}
+
+// OperationInsert saves operation together with all its steps.
+func (g *Guarded) OperationInsert(op *Operation, steps []*OperationStep) error {
+	ops := append(g.check(), insertOp(op))
+	index := len(ops) - 1
+	for _, step := range steps {
+		ops = append(ops, insertOp(step).link(index, "OperationId"))
+	}
+	_, err := write(ops...)
+	return err
+}
+
+func (g *Guarded) OperationUpdateFields(op *Operation, fields ...string) error {
+	return g.update(op.Id, op, fields...)
+}
+
+func (g *Guarded) OperationStepUpdateFields(step *OperationStep, fields ...string) error {
+	return g.update(step.Id, step, fields...)
+}
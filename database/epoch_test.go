@@ -0,0 +1,114 @@
+package database
+
+import (
+	"testing"
+)
+
+// localReplicator applies replicated commands to local database, like a
+// raft cluster of one node.
+type localReplicator struct{}
+
+func (localReplicator) Replicate(data []byte) (interface{}, error) {
+	return ApplyCommand(data), nil
+}
+
+func testGuardedStores(t *testing.T, test func(t *testing.T, store Store)) {
+	testStores(t, test)
+	t.Run("replicated", func(t *testing.T) {
+		openSQLite(t)
+		SetReplicator(localReplicator{})
+		t.Cleanup(func() { SetReplicator(nil) })
+		test(t, NewSQLStore())
+	})
+}
+
+func TestGuardedStaleEpoch(t *testing.T) {
+	testGuardedStores(t, func(t *testing.T, store Store) {
+		host := &Host{Name: "node1", Status: "active"}
+		if err := store.HostInsert(host); err != nil {
+			t.Fatal(err)
+		}
+		proclaim(t, store, "a", 1, true)
+		a := store.Guard(&Epoch{Election: "themis", Leader: "a", Term: 1})
+		host.Status = "checking"
+		if err := a.HostUpdateFields(host, "status"); err != nil {
+			t.Fatalf("leader a updates host: %s", err)
+		}
+		if host.Version != 2 {
+			t.Fatalf("host is at version %d after update", host.Version)
+		}
+
+		// b takes over, writes of a are rejected and change nothing
+		expireLease(t, store, "themis")
+		proclaim(t, store, "b", 2, true)
+		stale := *host
+		stale.Status = "failed"
+		if err := a.HostUpdateFields(&stale, "status"); err != ErrStaleEpoch {
+			t.Fatalf("stale leader updates host: %v", err)
+		}
+		if stale.Version != 2 {
+			t.Errorf("version is bumped to %d by rejected update", stale.Version)
+		}
+		history := &HostStatusHistory{HostId: host.Id, OldStatus: "checking", NewStatus: "failed", States: map[string]int{}}
+		if err := a.HostUpdateStatus(&stale, history); err != ErrStaleEpoch {
+			t.Fatalf("stale leader updates status: %v", err)
+		}
+		if stale.Version != 2 {
+			t.Errorf("version is bumped to %d by rejected status update", stale.Version)
+		}
+		saved, _ := store.HostGetById(host.Id)
+		if saved.Status != "checking" || saved.Version != 2 {
+			t.Fatalf("host is changed to %s at version %d by stale leader", saved.Status, saved.Version)
+		}
+		if histories, _ := store.HostHistoryGetAll(host.Id); len(histories) > 0 {
+			t.Errorf("history is saved by stale leader")
+		}
+
+		// the same host is written by the current leader
+		b := store.Guard(&Epoch{Election: "themis", Leader: "b", Term: 2})
+		if err := b.HostUpdateFields(&stale, "status"); err != nil {
+			t.Fatalf("leader b updates host after stale write: %v", err)
+		}
+		if stale.Version != 3 {
+			t.Errorf("host is at version %d after update", stale.Version)
+		}
+		saved, _ = store.HostGetById(host.Id)
+		if saved.Status != "failed" || saved.Version != 3 {
+			t.Errorf("host is %s at version %d", saved.Status, saved.Version)
+		}
+	})
+}
+
+func TestUpdateVersions(t *testing.T) {
+	testGuardedStores(t, func(t *testing.T, store Store) {
+		host := &Host{Name: "node1", Status: "active"}
+		if err := store.HostInsert(host); err != nil {
+			t.Fatal(err)
+		}
+
+		// conflicting update keeps version of bean
+		stale := *host
+		host.Status = "checking"
+		if err := store.HostUpdateFields(host, "status"); err != nil {
+			t.Fatal(err)
+		}
+		stale.Status = "failed"
+		if err := store.HostUpdateFields(&stale, "status"); err != ErrConflict {
+			t.Fatalf("conflicting update: %v", err)
+		}
+		if stale.Version != 1 || host.Version != 2 {
+			t.Errorf("versions are %d and %d", stale.Version, host.Version)
+		}
+
+		// update of a deleted row changes nothing
+		if err := store.HostDelete(host.Id, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Guard(nil).HostUpdateFields(host, "status"); err != nil && err != ErrHostNotFound {
+			t.Fatalf("update deleted host: %v", err)
+		}
+		if host.Version != 2 {
+			t.Errorf("version is bumped to %d by update of deleted host", host.Version)
+		}
+	})
+}
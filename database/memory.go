@@ -0,0 +1,1002 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var (
+	// errDuplicateName stands for violating unique name of hosts.
+	errDuplicateName = errors.New("host name already exists.")
+	// errDuplicateGroup stands for violating unique name of recovery groups.
+	errDuplicateGroup = errors.New("recovery group already exists.")
+)
+
+// memoryStore keeps everything in memory and loses it on exit, it is used
+// by tests, replays and labs. It follows what sqlStore does, including
+// versions and guards of writes.
+type memoryStore struct {
+	mutex      sync.Mutex
+	lastIds    map[string]int
+	hosts      map[int]*Host
+	states     map[int]*HostState
+	fencers    map[int]*HostFencer
+	histories  map[int]*HostStatusHistory
+	operations map[int]*Operation
+	steps      map[int]*OperationStep
+	elections  map[string]*ElectionRecord
+	members    map[string]*ElectionMember
+	groups     map[int]*RecoveryGroup
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		lastIds:    map[string]int{},
+		hosts:      map[int]*Host{},
+		states:     map[int]*HostState{},
+		fencers:    map[int]*HostFencer{},
+		histories:  map[int]*HostStatusHistory{},
+		operations: map[int]*Operation{},
+		steps:      map[int]*OperationStep{},
+		elections:  map[string]*ElectionRecord{},
+		members:    map[string]*ElectionMember{},
+		groups:     map[int]*RecoveryGroup{},
+	}
+}
+
+// clone copies bean together with its slices and maps, so that callers
+// never share rows with the store.
+func clone(bean interface{}) interface{} {
+	src := reflect.ValueOf(bean).Elem()
+	dst := reflect.New(src.Type())
+	dst.Elem().Set(src)
+	for i := 0; i < src.NumField(); i++ {
+		field := dst.Elem().Field(i)
+		switch field.Kind() {
+		case reflect.Slice:
+			if !field.IsNil() {
+				copied := reflect.MakeSlice(field.Type(), field.Len(), field.Len())
+				reflect.Copy(copied, field)
+				field.Set(copied)
+			}
+		case reflect.Map:
+			if !field.IsNil() {
+				copied := reflect.MakeMap(field.Type())
+				for _, key := range field.MapKeys() {
+					copied.SetMapIndex(key, field.MapIndex(key))
+				}
+				field.Set(copied)
+			}
+		}
+	}
+	return dst.Interface()
+}
+
+// columnName returns column of struct field the same way xorm names it.
+func columnName(field reflect.StructField) string {
+	tag := field.Tag.Get("xorm")
+	if start := strings.Index(tag, "'"); start >= 0 {
+		if end := strings.Index(tag[start+1:], "'"); end >= 0 {
+			return tag[start+1 : start+1+end]
+		}
+	}
+	var name []rune
+	for i, r := range field.Name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				name = append(name, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		name = append(name, r)
+	}
+	return string(name)
+}
+
+// copyColumns copies cols of src to dst, or all non-zero fields like xorm
+// does if cols is empty. Id and version are never copied.
+func copyColumns(dst, src interface{}, cols []string) {
+	d := reflect.ValueOf(dst).Elem()
+	s := reflect.ValueOf(src).Elem()
+	wanted := map[string]bool{}
+	for _, col := range cols {
+		wanted[col] = true
+	}
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Type().Field(i)
+		if field.Name == "Id" || field.Name == "Version" || field.Tag.Get("xorm") == "-" {
+			continue
+		}
+		if len(cols) > 0 && !wanted[columnName(field)] {
+			continue
+		} else if len(cols) == 0 && s.Field(i).IsZero() {
+			continue
+		}
+		d.Field(i).Set(reflect.ValueOf(clone(src)).Elem().Field(i))
+	}
+}
+
+func (m *memoryStore) nextId(table string) int {
+	m.lastIds[table]++
+	return m.lastIds[table]
+}
+
+// checkVersion fails with ErrConflict if bean is not at version of current.
+func checkVersion(current, bean interface{}) error {
+	version, ok := getVersion(bean)
+	if !ok || version == 0 {
+		return nil
+	}
+	if currentVersion, _ := getVersion(current); currentVersion != version {
+		return ErrConflict
+	}
+	return nil
+}
+
+// update copies cols of bean to current and bumps versions of both.
+func update(current, bean interface{}, cols ...string) {
+	copyColumns(current, bean, cols)
+	if version, ok := getVersion(current); ok {
+		setField(current, "Version", int64(version+1))
+		setField(bean, "Version", int64(version+1))
+	}
+}
+
+// insert assigns id and version to bean, and returns the copy to keep.
+func (m *memoryStore) insert(table string, bean interface{}) interface{} {
+	setField(bean, "Id", int64(m.nextId(table)))
+	if version, ok := getVersion(bean); ok && version == 0 {
+		setField(bean, "Version", 1)
+	}
+	return clone(bean)
+}
+
+func (m *memoryStore) HostInsert(host *Host, fencers ...*HostFencer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, h := range m.hosts {
+		if h.Name == host.Name {
+			return errDuplicateName
+		}
+	}
+	row := m.insert("host", host).(*Host)
+	m.hosts[row.Id] = row
+	for _, fencer := range fencers {
+		fencer.HostId = row.Id
+		row := m.insert("host_fencer", fencer).(*HostFencer)
+		m.fencers[row.Id] = row
+	}
+	return nil
+}
+
+func (m *memoryStore) HostGetAll() ([]*Host, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	hosts := make([]*Host, 0, len(m.hosts))
+	for _, host := range m.hosts {
+		hosts = append(hosts, clone(host).(*Host))
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Id < hosts[j].Id })
+	return hosts, nil
+}
+
+func (m *memoryStore) HostFind(q *HostQuery) ([]*Host, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var marker *Host
+	if q.Marker > 0 {
+		if marker = m.hosts[q.Marker]; marker == nil {
+			return nil, ErrMarkerNotFound
+		}
+	}
+	failed := map[int]bool{}
+	for _, state := range m.states {
+		if state.Tag == q.FailedTag && state.FailedTimes > 0 {
+			failed[state.HostId] = true
+		}
+	}
+
+	hosts := make([]*Host, 0)
+	for _, host := range m.hosts {
+		if len(q.Status) > 0 && !containsString(q.Status, host.Status) {
+			continue
+		} else if q.Disabled != nil && host.Disabled != *q.Disabled {
+			continue
+		} else if !strings.HasPrefix(host.Name, q.NamePrefix) {
+			continue
+		} else if len(q.Group) > 0 && host.Group != q.Group {
+			continue
+		} else if len(q.FailedTag) > 0 && !failed[host.Id] {
+			continue
+		}
+		hosts = append(hosts, clone(host).(*Host))
+	}
+	return pageRows(hosts, marker, &q.Page).([]*Host), nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryStore) HostGetById(id int) (*Host, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if host, ok := m.hosts[id]; ok {
+		return clone(host).(*Host), nil
+	}
+	return nil, nil
+}
+
+func (m *memoryStore) HostGetByName(name string) (*Host, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, host := range m.hosts {
+		if host.Name == name {
+			return clone(host).(*Host), nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryStore) updateHost(host *Host, fields ...string) error {
+	current, ok := m.hosts[host.Id]
+	if !ok {
+		return nil
+	} else if err := checkVersion(current, host); err != nil {
+		return err
+	}
+	update(current, host, fields...)
+	return nil
+}
+
+func (m *memoryStore) HostUpdate(id int, host *Host) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	host.Id = id
+	return m.updateHost(host)
+}
+
+func (m *memoryStore) HostUpdateFields(host *Host, fields ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.updateHost(host, fields...)
+}
+
+func (m *memoryStore) HostUpdateStatus(host *Host, history *HostStatusHistory) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.updateStatus(host, nil, history)
+}
+
+func (m *memoryStore) HostEnable(host *Host, states []*HostState, history *HostStatusHistory) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.updateStatus(host, states, history)
+}
+
+// updateStatus saves status of host, failed times of states and history
+// all or nothing.
+func (m *memoryStore) updateStatus(host *Host, states []*HostState, history *HostStatusHistory) error {
+	current, ok := m.hosts[host.Id]
+	if ok {
+		if err := checkVersion(current, host); err != nil {
+			return err
+		}
+	}
+	for _, state := range states {
+		if currentState, ok := m.states[state.Id]; ok {
+			if err := checkVersion(currentState, state); err != nil {
+				return err
+			}
+		}
+	}
+
+	if ok {
+		update(current, host, "status", "disabled", "updated_at")
+	}
+	for _, state := range states {
+		if currentState, ok := m.states[state.Id]; ok {
+			update(currentState, state, "failed_times")
+		}
+	}
+	row := m.insert("host_status_history", history).(*HostStatusHistory)
+	m.histories[row.Id] = row
+	return nil
+}
+
+func (m *memoryStore) HostDelete(id, version int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.checkHostDelete(id, version); err != nil {
+		return err
+	}
+	m.deleteHost(id)
+	return nil
+}
+
+// checkHostDelete fails if host can't be deleted, it must be called with
+// mutex held.
+func (m *memoryStore) checkHostDelete(id, version int) error {
+	host, ok := m.hosts[id]
+	if !ok {
+		return ErrHostNotFound
+	} else if version > 0 && host.Version != version {
+		return ErrConflict
+	}
+	for _, op := range m.operations {
+		if op.HostId == id && op.Status == operationRunning {
+			return ErrHostBusy
+		}
+	}
+	return nil
+}
+
+// deleteHost deletes host with everything belongs to it, it must be called
+// with mutex held.
+func (m *memoryStore) deleteHost(id int) {
+	for opId, op := range m.operations {
+		if op.HostId != id {
+			continue
+		}
+		for stepId, step := range m.steps {
+			if step.OperationId == opId {
+				delete(m.steps, stepId)
+			}
+		}
+		delete(m.operations, opId)
+	}
+	for stateId, state := range m.states {
+		if state.HostId == id {
+			delete(m.states, stateId)
+		}
+	}
+	for fencerId, fencer := range m.fencers {
+		if fencer.HostId == id {
+			delete(m.fencers, fencerId)
+		}
+	}
+	for historyId, history := range m.histories {
+		if history.HostId == id {
+			delete(m.histories, historyId)
+		}
+	}
+	delete(m.hosts, id)
+}
+
+func (m *memoryStore) HostHistoryGetAll(hostId int) ([]*HostStatusHistory, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	histories := make([]*HostStatusHistory, 0)
+	for _, history := range m.histories {
+		if history.HostId == hostId {
+			histories = append(histories, clone(history).(*HostStatusHistory))
+		}
+	}
+	sort.Slice(histories, func(i, j int) bool { return histories[i].Id > histories[j].Id })
+	return histories, nil
+}
+
+func (m *memoryStore) StateGetAll(hostId int) ([]*HostState, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	states := make([]*HostState, 0)
+	for _, state := range m.states {
+		if state.HostId == hostId {
+			states = append(states, clone(state).(*HostState))
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Id < states[j].Id })
+	return states, nil
+}
+
+func (m *memoryStore) StateGetAllHosts() (map[int][]*HostState, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ids := make([]int, 0, len(m.states))
+	for id := range m.states {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	states := map[int][]*HostState{}
+	for _, id := range ids {
+		state := clone(m.states[id]).(*HostState)
+		states[state.HostId] = append(states[state.HostId], state)
+	}
+	return states, nil
+}
+
+func (m *memoryStore) StateGetById(id int) (*HostState, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if state, ok := m.states[id]; ok {
+		return clone(state).(*HostState), nil
+	}
+	return nil, nil
+}
+
+func (m *memoryStore) StateInsert(state *HostState) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.hosts[state.HostId]; !ok {
+		return ErrHostNotFound
+	}
+	row := m.insert("host_state", state).(*HostState)
+	m.states[row.Id] = row
+	return nil
+}
+
+func (m *memoryStore) StateUpdate(id int, state *HostState) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	current, ok := m.states[id]
+	if !ok {
+		return nil
+	} else if err := checkVersion(current, state); err != nil {
+		return err
+	}
+	update(current, state, "tag", "failed_times")
+	return nil
+}
+
+func (m *memoryStore) StateDelete(id, version int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if state, ok := m.states[id]; ok && version > 0 && state.Version != version {
+		return ErrConflict
+	}
+	delete(m.states, id)
+	return nil
+}
+
+func (m *memoryStore) FencerGetAll() ([]*HostFencer, error) {
+	return m.fencersOf(0), nil
+}
+
+func (m *memoryStore) FencerFind(q *FencerQuery) ([]*HostFencer, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var marker *HostFencer
+	if q.Marker > 0 {
+		if marker = m.fencers[q.Marker]; marker == nil {
+			return nil, ErrMarkerNotFound
+		}
+	}
+
+	fencers := make([]*HostFencer, 0)
+	for _, fencer := range m.fencers {
+		if (q.HostId == 0 || fencer.HostId == q.HostId) && (len(q.Type) == 0 || fencer.Type == q.Type) {
+			fencers = append(fencers, clone(fencer).(*HostFencer))
+		}
+	}
+	return pageRows(fencers, marker, &q.Page).([]*HostFencer), nil
+}
+
+func (m *memoryStore) FencerGetByHost(hostId int) ([]*HostFencer, error) {
+	return m.fencersOf(hostId), nil
+}
+
+// fencersOf returns fencers of host, or all fencers if hostId is 0.
+func (m *memoryStore) fencersOf(hostId int) []*HostFencer {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fencers := make([]*HostFencer, 0)
+	for _, fencer := range m.fencers {
+		if hostId == 0 || fencer.HostId == hostId {
+			fencers = append(fencers, clone(fencer).(*HostFencer))
+		}
+	}
+	sort.Slice(fencers, func(i, j int) bool { return fencers[i].Id < fencers[j].Id })
+	return fencers
+}
+
+func (m *memoryStore) FencerGetById(id int) (*HostFencer, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if fencer, ok := m.fencers[id]; ok {
+		return clone(fencer).(*HostFencer), nil
+	}
+	return nil, nil
+}
+
+func (m *memoryStore) FencerInsert(fencer *HostFencer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.hosts[fencer.HostId]; !ok {
+		return ErrHostNotFound
+	}
+	row := m.insert("host_fencer", fencer).(*HostFencer)
+	m.fencers[row.Id] = row
+	return nil
+}
+
+func (m *memoryStore) FencerUpdate(id int, fencer *HostFencer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.hosts[fencer.HostId]; !ok {
+		return ErrHostNotFound
+	}
+	current, ok := m.fencers[id]
+	if !ok {
+		return nil
+	} else if err := checkVersion(current, fencer); err != nil {
+		return err
+	}
+	update(current, fencer)
+	return nil
+}
+
+func (m *memoryStore) FencerDelete(id, version int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if fencer, ok := m.fencers[id]; ok && version > 0 && fencer.Version != version {
+		return ErrConflict
+	}
+	delete(m.fencers, id)
+	return nil
+}
+
+func (m *memoryStore) RecoveryGroupGetAll() ([]*RecoveryGroup, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	groups := make([]*RecoveryGroup, 0, len(m.groups))
+	for _, group := range m.groups {
+		groups = append(groups, clone(group).(*RecoveryGroup))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+func (m *memoryStore) InventorySave(c *InventoryChanges) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.checkInventory(c); err != nil {
+		return err
+	}
+	for _, h := range c.Hosts {
+		m.saveHostImport(h)
+	}
+	for _, id := range c.DeleteHosts {
+		m.deleteHost(id)
+	}
+	for _, group := range c.Groups {
+		if current, ok := m.groups[group.Id]; ok {
+			update(current, group, "steps", "updated_at")
+		} else {
+			row := m.insert("recovery_group", group).(*RecoveryGroup)
+			m.groups[row.Id] = row
+		}
+	}
+	for _, id := range c.DeleteGroups {
+		delete(m.groups, id)
+	}
+	return nil
+}
+
+// checkInventory fails if any change of c can't be saved, so that nothing
+// is saved. It must be called with mutex held.
+func (m *memoryStore) checkInventory(c *InventoryChanges) error {
+	names := map[string]bool{}
+	for _, h := range m.hosts {
+		names[h.Name] = true
+	}
+	for _, h := range c.Hosts {
+		if h.New {
+			if names[h.Host.Name] {
+				return errDuplicateName
+			}
+			names[h.Host.Name] = true
+			continue
+		}
+		current, ok := m.hosts[h.Host.Id]
+		if !ok {
+			return ErrHostNotFound
+		} else if len(h.Cols) > 0 {
+			if err := checkVersion(current, h.Host); err != nil {
+				return err
+			}
+		}
+		for _, state := range h.States {
+			if current, ok := m.states[state.Id]; ok {
+				if err := checkVersion(current, state); err != nil {
+					return err
+				}
+			}
+		}
+		for _, fencer := range h.Fencers {
+			if current, ok := m.fencers[fencer.Id]; ok {
+				if err := checkVersion(current, fencer); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, id := range c.DeleteHosts {
+		if err := m.checkHostDelete(id, 0); err != nil {
+			return err
+		}
+	}
+
+	groups := map[string]bool{}
+	for _, group := range m.groups {
+		groups[group.Name] = true
+	}
+	for _, group := range c.Groups {
+		if current, ok := m.groups[group.Id]; ok {
+			if err := checkVersion(current, group); err != nil {
+				return err
+			}
+		} else if groups[group.Name] {
+			return errDuplicateGroup
+		}
+		groups[group.Name] = true
+	}
+	return nil
+}
+
+// saveHostImport must be called with mutex held.
+func (m *memoryStore) saveHostImport(h *HostImport) {
+	if h.New {
+		row := m.insert("host", h.Host).(*Host)
+		m.hosts[row.Id] = row
+	} else if len(h.Cols) > 0 {
+		update(m.hosts[h.Host.Id], h.Host, h.Cols...)
+	}
+	for _, state := range h.States {
+		if current, ok := m.states[state.Id]; ok {
+			update(current, state, "failed_times")
+		}
+	}
+	if h.History != nil {
+		h.History.HostId = h.Host.Id
+		row := m.insert("host_status_history", h.History).(*HostStatusHistory)
+		m.histories[row.Id] = row
+	}
+	for _, state := range h.NewStates {
+		state.HostId = h.Host.Id
+		row := m.insert("host_state", state).(*HostState)
+		m.states[row.Id] = row
+	}
+	for _, id := range h.DeleteStates {
+		delete(m.states, id)
+	}
+	for _, fencer := range h.NewFencers {
+		fencer.HostId = h.Host.Id
+		row := m.insert("host_fencer", fencer).(*HostFencer)
+		m.fencers[row.Id] = row
+	}
+	for _, fencer := range h.Fencers {
+		if current, ok := m.fencers[fencer.Id]; ok {
+			update(current, fencer)
+		}
+	}
+	for _, id := range h.DeleteFencers {
+		delete(m.fencers, id)
+	}
+}
+
+func (m *memoryStore) OperationGetAll(hostId int, status string) ([]*Operation, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ops := make([]*Operation, 0)
+	for _, op := range m.operations {
+		if (hostId == 0 || op.HostId == hostId) && (len(status) == 0 || op.Status == status) {
+			ops = append(ops, clone(op).(*Operation))
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Id > ops[j].Id })
+	return ops, nil
+}
+
+func (m *memoryStore) OperationGetById(id int) (*Operation, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if op, ok := m.operations[id]; ok {
+		return clone(op).(*Operation), nil
+	}
+	return nil, nil
+}
+
+func (m *memoryStore) OperationGetLatest(hostId int) (*Operation, error) {
+	ops, err := m.OperationGetAll(hostId, "")
+	if err != nil || len(ops) == 0 {
+		return nil, err
+	}
+	return ops[0], nil
+}
+
+func (m *memoryStore) OperationStepGetAll(operationId int) ([]*OperationStep, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	steps := make([]*OperationStep, 0)
+	for _, step := range m.steps {
+		if step.OperationId == operationId {
+			steps = append(steps, clone(step).(*OperationStep))
+		}
+	}
+	sort.Slice(steps, func(i, j int) bool { return steps[i].Seq < steps[j].Seq })
+	return steps, nil
+}
+
+func (m *memoryStore) ElectionGet(name string) (*ElectionRecord, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if record, ok := m.elections[name]; ok {
+		return clone(record).(*ElectionRecord), nil
+	}
+	return nil, nil
+}
+
+// ElectionProclaim works the same as ElectionProclaim of database.
+func (m *memoryStore) ElectionProclaim(name, leader, address string, term time.Duration) (int64, bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	current, ok := m.elections[name]
+	if !ok {
+		m.elections[name] = &ElectionRecord{
+			Id:           uint32(m.nextId("election_record")),
+			ElectionName: name,
+			LeaderName:   leader,
+			Address:      address,
+			LastUpdate:   now,
+			Term:         1,
+		}
+		return 1, true, nil
+	}
+
+	if current.LeaderName != leader && now.Sub(current.LastUpdate) < term {
+		return 0, false, nil
+	}
+	if current.LeaderName != leader || now.Sub(current.LastUpdate) >= term {
+		current.Term++
+	}
+	current.LeaderName = leader
+	current.Address = address
+	current.LastUpdate = now
+	return current.Term, true, nil
+}
+
+func (m *memoryStore) ElectionQuit(name, leader string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if record, ok := m.elections[name]; ok && record.LeaderName == leader {
+		record.LastUpdate = expiredTime
+	}
+	return nil
+}
+
+func (m *memoryStore) ElectionMemberGetAll(name string) ([]*ElectionMember, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	members := make([]*ElectionMember, 0)
+	for _, member := range m.members {
+		if member.ElectionName == name {
+			members = append(members, clone(member).(*ElectionMember))
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members, nil
+}
+
+func (m *memoryStore) ElectionMemberSave(member *ElectionMember, newTerm bool) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := member.ElectionName + "/" + member.Name
+	current, ok := m.members[key]
+	if !ok {
+		m.members[key] = m.insert("election_member", member).(*ElectionMember)
+		return nil
+	}
+	current.Address = member.Address
+	current.LastProclaim = member.LastProclaim
+	if newTerm {
+		current.Term = member.Term
+		current.TermStart = member.TermStart
+	}
+	return nil
+}
+
+func (m *memoryStore) EpochValid(e *Epoch, term time.Duration) (bool, error) {
+	if e == nil {
+		return true, nil
+	}
+	record, _ := m.ElectionGet(e.Election)
+	if record == nil || record.LeaderName != e.Leader || record.Term != e.Term {
+		return false, nil
+	}
+	return time.Since(record.LastUpdate) < term, nil
+}
+
+func (m *memoryStore) Guard(epoch *Epoch) GuardedStore {
+	return &memoryGuarded{m: m, epoch: epoch}
+}
+
+// memoryGuarded rejects writes once epoch is not the current term.
+type memoryGuarded struct {
+	m     *memoryStore
+	epoch *Epoch
+}
+
+// check must be called with mutex of store held.
+func (g *memoryGuarded) check() error {
+	if g.epoch == nil {
+		return nil
+	}
+	record, ok := g.m.elections[g.epoch.Election]
+	if !ok || record.LeaderName != g.epoch.Leader || record.Term != g.epoch.Term {
+		return ErrStaleEpoch
+	}
+	return nil
+}
+
+func (g *memoryGuarded) HostUpdateFields(host *Host, fields ...string) error {
+	g.m.mutex.Lock()
+	defer g.m.mutex.Unlock()
+
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.m.updateHost(host, fields...)
+}
+
+func (g *memoryGuarded) HostUpdateStatus(host *Host, history *HostStatusHistory) error {
+	g.m.mutex.Lock()
+	defer g.m.mutex.Unlock()
+
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.m.updateStatus(host, nil, history)
+}
+
+// HostsSave saves changes of every host all or nothing, hosts do not hold
+// back each other.
+func (g *memoryGuarded) HostsSave(changes []*HostChanges) []error {
+	g.m.mutex.Lock()
+	defer g.m.mutex.Unlock()
+
+	errs := make([]error, len(changes))
+	if err := g.check(); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	for i, c := range changes {
+		errs[i] = g.m.saveChanges(c)
+	}
+	return errs
+}
+
+// saveChanges must be called with mutex held.
+func (m *memoryStore) saveChanges(c *HostChanges) error {
+	if c.New {
+		for _, h := range m.hosts {
+			if h.Name == c.Host.Name {
+				return errDuplicateName
+			}
+		}
+	} else if current, ok := m.hosts[c.Host.Id]; ok && c.History != nil {
+		if err := checkVersion(current, c.Host); err != nil {
+			return err
+		}
+	}
+	for _, state := range c.States {
+		if current, ok := m.states[state.Id]; ok {
+			if err := checkVersion(current, state); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.New {
+		row := m.insert("host", c.Host).(*Host)
+		m.hosts[row.Id] = row
+	} else if current, ok := m.hosts[c.Host.Id]; ok && c.History != nil {
+		update(current, c.Host, "status", "disabled", "updated_at")
+	}
+	for _, state := range c.NewStates {
+		state.HostId = c.Host.Id
+		row := m.insert("host_state", state).(*HostState)
+		m.states[row.Id] = row
+	}
+	for _, state := range c.States {
+		if current, ok := m.states[state.Id]; ok {
+			update(current, state, "failed_times")
+		}
+	}
+	if c.History != nil {
+		c.History.HostId = c.Host.Id
+		row := m.insert("host_status_history", c.History).(*HostStatusHistory)
+		m.histories[row.Id] = row
+	}
+	return nil
+}
+
+func (g *memoryGuarded) OperationInsert(op *Operation, steps []*OperationStep) error {
+	g.m.mutex.Lock()
+	defer g.m.mutex.Unlock()
+
+	if err := g.check(); err != nil {
+		return err
+	}
+	row := g.m.insert("operation", op).(*Operation)
+	row.Steps = nil
+	g.m.operations[row.Id] = row
+	for _, step := range steps {
+		step.OperationId = op.Id
+		row := g.m.insert("operation_step", step).(*OperationStep)
+		g.m.steps[row.Id] = row
+	}
+	return nil
+}
+
+func (g *memoryGuarded) OperationUpdateFields(op *Operation, fields ...string) error {
+	g.m.mutex.Lock()
+	defer g.m.mutex.Unlock()
+
+	if err := g.check(); err != nil {
+		return err
+	}
+	if current, ok := g.m.operations[op.Id]; ok {
+		update(current, op, fields...)
+	}
+	return nil
+}
+
+func (g *memoryGuarded) OperationStepUpdateFields(step *OperationStep, fields ...string) error {
+	g.m.mutex.Lock()
+	defer g.m.mutex.Unlock()
+
+	if err := g.check(); err != nil {
+		return err
+	}
+	if current, ok := g.m.steps[step.Id]; ok {
+		update(current, step, fields...)
+	}
+	return nil
+}
@@ -0,0 +1,538 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-xorm/xorm"
+)
+
+var (
+	ErrSchemaTooNew  = errors.New("database schema is newer than this binary.")
+	ErrSchemaTooOld  = errors.New("database schema is out of date, run `themis db migrate` first.")
+	ErrNoDowngrade   = errors.New("migration can not be rolled back.")
+	ErrInvalidTarget = errors.New("invalid target schema version.")
+)
+
+// SchemaVersion records one applied migration. It is local to each
+// database, so it is never replicated.
+type SchemaVersion struct {
+	Version     int       `xorm:"pk"`
+	Description string    `xorm:"varchar(255)"`
+	AppliedAt   time.Time `xorm:"TIMESTAMP"`
+}
+
+// Migration upgrades schema by one version, Down reverts what Up did. Both
+// run in the transaction which records the schema version.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(s *xorm.Session) error
+	Down        func(s *xorm.Session) error
+}
+
+// MigrationStatus tells whether a migration has been applied.
+type MigrationStatus struct {
+	Version     int
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+// migrations must be ordered by version without gaps, never change a
+// migration once released, add a new one instead.
+var migrations = []*Migration{
+	{
+		Version:     1,
+		Description: "initial schema",
+		// tables may exist already if they were created before migrations
+		// were introduced, Sync2 only creates what is missing.
+		Up: func(s *xorm.Session) error {
+			return s.Sync2(v1Tables...)
+		},
+		Down: func(s *xorm.Session) error {
+			for _, table := range v1Tables {
+				if err := s.DropTable(table); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "foreign keys to hosts and operations",
+		Up:          addForeignKeys,
+		Down:        dropForeignKeys,
+	},
+	{
+		Version:     3,
+		Description: "versions of hosts, states and fencers",
+		Up: func(s *xorm.Session) error {
+			for _, table := range versionedTables {
+				// sqlite keeps the column when it is rolled back
+				exist, err := engine.Dialect().IsColumnExist(table, "version")
+				if err != nil {
+					return err
+				} else if exist {
+					continue
+				}
+				sql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s INTEGER NOT NULL DEFAULT 1",
+					engine.Quote(table), engine.Quote("version"))
+				if _, err := s.Exec(sql); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(s *xorm.Session) error {
+			// older sqlite can not drop columns, older binaries just ignore it
+			if engine.DriverName() == "sqlite3" {
+				return nil
+			}
+			for _, table := range versionedTables {
+				sql := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", engine.Quote(table), engine.Quote("version"))
+				if _, err := s.Exec(sql); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     4,
+		Description: "boolean columns",
+		Up: func(s *xorm.Session) error {
+			return alterBoolColumns(s, true)
+		},
+		Down: func(s *xorm.Session) error {
+			return alterBoolColumns(s, false)
+		},
+	},
+	{
+		Version:     5,
+		Description: "recovery groups imported from inventory",
+		Up: func(s *xorm.Session) error {
+			return s.Sync2(new(v5RecoveryGroup))
+		},
+		Down: func(s *xorm.Session) error {
+			return s.DropTable(new(v5RecoveryGroup))
+		},
+	},
+}
+
+// boolColumns were created as tinyint(1), which is a boolean of mysql only.
+var boolColumns = map[string][]string{
+	"host": {"disabled", "nova_disabled", "nova_forced_down", "orphaned"},
+}
+
+// alterBoolColumns converts boolColumns between smallint and boolean of
+// postgres, other databases store booleans as integers anyway.
+func alterBoolColumns(s *xorm.Session, toBool bool) error {
+	if engine.DriverName() != "postgres" {
+		return nil
+	}
+	for table, columns := range boolColumns {
+		for _, column := range columns {
+			sql := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE BOOLEAN USING %s <> 0",
+				engine.Quote(table), engine.Quote(column), engine.Quote(column))
+			if !toBool {
+				sql = fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE SMALLINT USING CASE WHEN %s THEN 1 ELSE 0 END",
+					engine.Quote(table), engine.Quote(column), engine.Quote(column))
+			}
+			if _, err := s.Exec(sql); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tables updated by both operators and monitors
+var versionedTables = []string{"host", "host_state", "host_fencer"}
+
+// foreignKey is a column referencing id of parent table.
+type foreignKey struct {
+	table  string
+	column string
+	parent string
+}
+
+func (fk *foreignKey) name() string {
+	return "fk_" + fk.table + "_" + fk.column
+}
+
+// parents must come before their children.
+var foreignKeys = []*foreignKey{
+	{"operation", "host_id", "host"},
+	{"operation_step", "operation_id", "operation"},
+	{"host_state", "host_id", "host"},
+	{"host_fencer", "host_id", "host"},
+	{"host_status_history", "host_id", "host"},
+}
+
+// supportsForeignKeys tells if constraints can be added to existing tables,
+// sqlite can not, we rely on checks done within transactions instead.
+func supportsForeignKeys(e *xorm.Engine) bool {
+	return e.DriverName() == "mysql" || e.DriverName() == "postgres"
+}
+
+// supportsTransactionalDDL tells if schema changes can be rolled back, mysql
+// commits each of them implicitly.
+func supportsTransactionalDDL(e *xorm.Engine) bool {
+	return e.DriverName() != "mysql"
+}
+
+func addForeignKeys(s *xorm.Session) error {
+	// rows left behind by hosts deleted before would violate constraints
+	for _, fk := range foreignKeys {
+		sql := fmt.Sprintf("DELETE FROM %s WHERE %s NOT IN (SELECT id FROM %s)",
+			engine.Quote(fk.table), engine.Quote(fk.column), engine.Quote(fk.parent))
+		if _, err := s.Exec(sql); err != nil {
+			return err
+		}
+	}
+	if !supportsForeignKeys(engine) {
+		return nil
+	}
+	for _, fk := range foreignKeys {
+		sql := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (id)",
+			engine.Quote(fk.table), engine.Quote(fk.name()), engine.Quote(fk.column), engine.Quote(fk.parent))
+		if _, err := s.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropForeignKeys(s *xorm.Session) error {
+	if !supportsForeignKeys(engine) {
+		return nil
+	}
+	for i := len(foreignKeys) - 1; i >= 0; i-- {
+		fk := foreignKeys[i]
+		drop := "CONSTRAINT"
+		if engine.DriverName() == "mysql" {
+			drop = "FOREIGN KEY"
+		}
+		sql := fmt.Sprintf("ALTER TABLE %s DROP %s %s", engine.Quote(fk.table), drop, engine.Quote(fk.name()))
+		if _, err := s.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LatestVersion returns schema version this binary works with.
+func LatestVersion() int {
+	return len(migrations)
+}
+
+// SchemaVersionGet returns current schema version, 0 means empty database.
+func SchemaVersionGet() (int, error) {
+	var version int
+
+	if err := engine.Sync2(new(SchemaVersion)); err != nil {
+		return 0, err
+	}
+	_, err := engine.SQL("SELECT COALESCE(MAX(version), 0) FROM " +
+		engine.Quote(tableName(new(SchemaVersion)))).Get(&version)
+	return version, err
+}
+
+// SchemaStatus returns all migrations known by this binary and the ones
+// applied by a newer binary.
+func SchemaStatus() ([]*MigrationStatus, error) {
+	if err := engine.Sync2(new(SchemaVersion)); err != nil {
+		return nil, err
+	}
+	applied := make([]*SchemaVersion, 0)
+	if err := engine.Asc("version").Find(&applied); err != nil {
+		return nil, err
+	}
+	records := map[int]*SchemaVersion{}
+	for _, v := range applied {
+		records[v.Version] = v
+	}
+
+	status := make([]*MigrationStatus, 0)
+	for _, m := range migrations {
+		s := &MigrationStatus{Version: m.Version, Description: m.Description}
+		if v, ok := records[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = v.AppliedAt
+		}
+		status = append(status, s)
+	}
+	for _, v := range applied {
+		if v.Version > LatestVersion() {
+			status = append(status, &MigrationStatus{
+				Version:     v.Version,
+				Description: v.Description,
+				Applied:     true,
+				AppliedAt:   v.AppliedAt,
+			})
+		}
+	}
+	return status, nil
+}
+
+// Migrate upgrades schema to target version, 0 means the latest version.
+func Migrate(target int) error {
+	if target == 0 {
+		target = LatestVersion()
+	}
+	current, err := SchemaVersionGet()
+	if err != nil {
+		return err
+	}
+	if current > LatestVersion() {
+		return ErrSchemaTooNew
+	} else if target < current || target > LatestVersion() {
+		return ErrInvalidTarget
+	}
+
+	for _, m := range migrations[current:target] {
+		plog.Infof("Migrate schema to version %d: %s", m.Version, m.Description)
+		if err := runMigration(m, true); err != nil {
+			return fmt.Errorf("migrate to version %d failed: %s", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// Rollback reverts schema to target version, -1 means the previous version.
+func Rollback(target int) error {
+	current, err := SchemaVersionGet()
+	if err != nil {
+		return err
+	}
+	if current > LatestVersion() {
+		return ErrSchemaTooNew
+	}
+	if target < 0 {
+		target = current - 1
+	}
+	if target < 0 || target >= current {
+		return ErrInvalidTarget
+	}
+
+	for i := current - 1; i >= target; i-- {
+		m := migrations[i]
+		if m.Down == nil {
+			return ErrNoDowngrade
+		}
+		plog.Infof("Rollback schema version %d: %s", m.Version, m.Description)
+		if err := runMigration(m, false); err != nil {
+			return fmt.Errorf("rollback version %d failed: %s", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// runMigration applies or reverts m and records its schema version in one
+// transaction, so that a failed step leaves schema as it was. It is skipped
+// if the version is recorded already, such as by another monitor migrating
+// at the same time, which is the only guard on mysql as it commits DDL
+// implicitly.
+func runMigration(m *Migration, up bool) error {
+	session := engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	applied, err := session.Exist(&SchemaVersion{Version: m.Version})
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	if applied == up {
+		plog.Infof("Schema version %d is changed already, skip it.", m.Version)
+		return session.Rollback()
+	}
+
+	if up {
+		err = m.Up(session)
+		if err == nil {
+			_, err = session.Insert(&SchemaVersion{
+				Version:     m.Version,
+				Description: m.Description,
+				AppliedAt:   time.Now(),
+			})
+		}
+	} else {
+		err = m.Down(session)
+		if err == nil {
+			_, err = session.Delete(&SchemaVersion{Version: m.Version})
+		}
+	}
+	if err != nil {
+		session.Rollback()
+		if !supportsTransactionalDDL(engine) {
+			plog.Warningf("Schema version %d may be partly changed, check it before retry.", m.Version)
+		}
+		return err
+	}
+	return session.Commit()
+}
+
+// CheckSchema fails unless schema of database matches this binary, it never
+// migrates, so that tools reading production databases change nothing.
+func CheckSchema() error {
+	return checkSchema(false)
+}
+
+// checkSchema makes sure schema matches this binary before we serve.
+func checkSchema(autoMigrate bool) error {
+	current, err := SchemaVersionGet()
+	if err != nil {
+		return err
+	}
+	if current > LatestVersion() {
+		return ErrSchemaTooNew
+	} else if current < LatestVersion() {
+		if !autoMigrate {
+			return ErrSchemaTooOld
+		}
+		return Migrate(0)
+	}
+	return nil
+}
+
+// Tables of schema version 1, frozen so that later changes of models do
+// not change what migration 1 creates.
+var v1Tables = []interface{}{
+	new(v1ElectionRecord),
+	new(v1ElectionMember),
+	new(v1Host),
+	new(v1HostState),
+	new(v1HostStatusHistory),
+	new(v1HostFencer),
+	new(v1Operation),
+	new(v1OperationStep),
+	new(v1JournalEvent),
+}
+
+type v1ElectionRecord struct {
+	Id           uint32    `xorm:"autoincr pk"`
+	ElectionName string    `xorm:"varchar(64) unique notnull"`
+	LeaderName   string    `xorm:"varchar(64) notnull"`
+	LastUpdate   time.Time `xorm:"TIMESTAMP"`
+	Term         int64     `xorm:"notnull default 0"`
+	Address      string    `xorm:"varchar(255)"`
+}
+
+func (v1ElectionRecord) TableName() string { return "election_record" }
+
+type v1ElectionMember struct {
+	Id           int       `xorm:"pk autoincr"`
+	ElectionName string    `xorm:"varchar(64) notnull unique(member)"`
+	Name         string    `xorm:"varchar(64) notnull unique(member)"`
+	Term         int64     `xorm:"notnull default 0"`
+	TermStart    time.Time `xorm:"TIMESTAMP"`
+	LastProclaim time.Time `xorm:"TIMESTAMP"`
+	Address      string    `xorm:"varchar(255)"`
+}
+
+func (v1ElectionMember) TableName() string { return "election_member" }
+
+type v1Host struct {
+	Id             int       `xorm:"pk autoincr"`
+	Name           string    `xorm:"varchar(64) unique notnull"`
+	Group          string    `xorm:"'host_group' varchar(64)"`
+	Status         string    `xorm:"varchar(255)"`
+	Disabled       bool      `xorm:"tinyint(1)"`
+	UpdatedAt      time.Time `xorm:"TIMESTAMP"`
+	NovaDisabled   bool      `xorm:"tinyint(1)"`
+	NovaForcedDown bool      `xorm:"tinyint(1)"`
+	Orphaned       bool      `xorm:"tinyint(1)"`
+}
+
+func (v1Host) TableName() string { return "host" }
+
+type v1HostState struct {
+	Id          int `xorm:"pk autoincr"`
+	HostId      int
+	Tag         string `xorm:"varchar(64) notnull"`
+	FailedTimes int    `xorm:"default 0"`
+}
+
+func (v1HostState) TableName() string { return "host_state" }
+
+type v1HostStatusHistory struct {
+	Id         int       `xorm:"pk autoincr"`
+	HostId     int       `xorm:"index"`
+	OldStatus  string    `xorm:"varchar(64)"`
+	NewStatus  string    `xorm:"varchar(64)"`
+	Reason     string    `xorm:"text"`
+	States     string    `xorm:"text"`
+	LeaderName string    `xorm:"varchar(64)"`
+	CreatedAt  time.Time `xorm:"TIMESTAMP"`
+}
+
+func (v1HostStatusHistory) TableName() string { return "host_status_history" }
+
+type v1HostFencer struct {
+	Id       int `xorm:"pk autoincr"`
+	HostId   int
+	Type     string `xorm:"varchar(32) notnull"`
+	Host     string `xorm:"varchar(64) notnull"`
+	Port     int    `xorm:"default 623"`
+	Username string `xorm:"varchar(64) notnull"`
+	Password string `xorm:"varchar(64) notnull"`
+}
+
+func (v1HostFencer) TableName() string { return "host_fencer" }
+
+type v1Operation struct {
+	Id         int    `xorm:"pk autoincr"`
+	HostId     int    `xorm:"index"`
+	HostName   string `xorm:"varchar(64) notnull"`
+	Group      string `xorm:"'host_group' varchar(64)"`
+	Type       string `xorm:"varchar(32) notnull"`
+	Status     string `xorm:"varchar(32) notnull index"`
+	LeaderName string `xorm:"varchar(64)"`
+	FencerId   int
+	Instances  string    `xorm:"text"`
+	Message    string    `xorm:"text"`
+	CreatedAt  time.Time `xorm:"TIMESTAMP"`
+	UpdatedAt  time.Time `xorm:"TIMESTAMP"`
+}
+
+func (v1Operation) TableName() string { return "operation" }
+
+type v1OperationStep struct {
+	Id          int `xorm:"pk autoincr"`
+	OperationId int `xorm:"index"`
+	Seq         int
+	Name        string    `xorm:"varchar(64) notnull"`
+	Type        string    `xorm:"varchar(32) notnull"`
+	Status      string    `xorm:"varchar(32) notnull"`
+	Message     string    `xorm:"text"`
+	StartedAt   time.Time `xorm:"TIMESTAMP"`
+	FinishedAt  time.Time `xorm:"TIMESTAMP"`
+}
+
+func (v1OperationStep) TableName() string { return "operation_step" }
+
+type v1JournalEvent struct {
+	Id       int       `xorm:"pk autoincr"`
+	Time     time.Time `xorm:"'event_time' TIMESTAMP index"`
+	Hostname string    `xorm:"varchar(64) notnull"`
+	Tag      string    `xorm:"varchar(64) notnull"`
+	Status   string    `xorm:"varchar(32) notnull"`
+}
+
+func (v1JournalEvent) TableName() string { return "journal_event" }
+
+type v5RecoveryGroup struct {
+	Id        int       `xorm:"pk autoincr"`
+	Name      string    `xorm:"varchar(64) unique notnull"`
+	Steps     string    `xorm:"text"`
+	UpdatedAt time.Time `xorm:"TIMESTAMP"`
+	Version   int       `xorm:"notnull default 1"`
+}
+
+func (v5RecoveryGroup) TableName() string { return "recovery_group" }
@@ -5,9 +5,15 @@ import "time"
 func init() {
 	allTables = append(allTables,
 		new(ElectionRecord),
+		new(ElectionMember),
 		new(Host),
 		new(HostState),
+		new(HostStatusHistory),
 		new(HostFencer),
+		new(Operation),
+		new(OperationStep),
+		new(JournalEvent),
+		new(RecoveryGroup),
 	)
 }
 
@@ -16,14 +22,42 @@ type ElectionRecord struct {
 	ElectionName string    `xorm:"varchar(64) unique notnull"`
 	LeaderName   string    `xorm:"varchar(64) notnull"`
 	LastUpdate   time.Time `xorm:"TIMESTAMP"`
+	// Term increases every time leadership changes hands.
+	Term int64 `xorm:"notnull default 0"`
+	// URL of REST API of leader
+	Address string `xorm:"varchar(255)"`
+}
+
+// ElectionMember records every monitor which has campaigned.
+type ElectionMember struct {
+	Id           int    `xorm:"pk autoincr"`
+	ElectionName string `xorm:"varchar(64) notnull unique(member)"`
+	Name         string `xorm:"varchar(64) notnull unique(member)"`
+	// term of its latest leadership
+	Term         int64     `xorm:"notnull default 0"`
+	TermStart    time.Time `xorm:"TIMESTAMP"`
+	LastProclaim time.Time `xorm:"TIMESTAMP"`
+	// URL of REST API of member
+	Address string `xorm:"varchar(255)"`
+
+	Leader bool `xorm:"-"`
 }
 
 type Host struct {
 	Id        int       `json:"id" xorm:"pk autoincr"`
 	Name      string    `json:"name" binding:"required" xorm:"varchar(64) unique notnull"`
-	Status    string    `json:"status" xrom:"varchar(64) default 'initializing'"`
-	Disabled  bool      `json:"disabled" xorm:"tinyint(1)" default false`
+	Group     string    `json:"group" xorm:"'host_group' varchar(64)"`
+	Status    string    `json:"status" xorm:"varchar(255)"`
+	Disabled  bool      `json:"disabled" xorm:"bool"`
 	UpdatedAt time.Time `json:"updated_at" xorm:"TIMESTAMP"`
+
+	// mirrored from nova-compute service by inventory sync
+	NovaDisabled   bool `json:"nova_disabled" xorm:"bool"`
+	NovaForcedDown bool `json:"nova_forced_down" xorm:"bool"`
+	// host no longer exists in nova
+	Orphaned bool `json:"orphaned" xorm:"bool"`
+	// bumped by every update, see updateOp
+	Version int `json:"version" xorm:"notnull default 1"`
 }
 
 type HostState struct {
@@ -31,6 +65,20 @@ type HostState struct {
 	HostId      int    `json:"host_id"`
 	Tag         string `json:"tag" binding:"required" xorm:"varchar(64) notnull"`
 	FailedTimes int    `json:"failed_times" xorm:"default 0"`
+	Version     int    `json:"version" xorm:"notnull default 1"`
+}
+
+// HostStatusHistory records one status transition of host.
+type HostStatusHistory struct {
+	Id        int    `json:"id" xorm:"pk autoincr"`
+	HostId    int    `json:"host_id" xorm:"index"`
+	OldStatus string `json:"old_status" xorm:"varchar(64)"`
+	NewStatus string `json:"new_status" xorm:"varchar(64)"`
+	Reason    string `json:"reason" xorm:"text"`
+	// failed times of each tag when the transition happened
+	States     map[string]int `json:"states" xorm:"text"`
+	LeaderName string         `json:"leader_name" xorm:"varchar(64)"`
+	CreatedAt  time.Time      `json:"created_at" xorm:"TIMESTAMP"`
 }
 
 type HostFencer struct {
@@ -41,4 +89,63 @@ type HostFencer struct {
 	Port     int    `json:"port" xorm:"default 623"`
 	Username string `json:"username" binding:"required" xorm:"varchar(64) notnull"`
 	Password string `json:"password" binding:"required" xorm:"varchar(64) notnull"`
+	Version  int    `json:"version" xorm:"notnull default 1"`
+}
+
+type Operation struct {
+	Id         int       `json:"id" xorm:"pk autoincr"`
+	HostId     int       `json:"host_id" xorm:"index"`
+	HostName   string    `json:"host_name" xorm:"varchar(64) notnull"`
+	Group      string    `json:"group" xorm:"'host_group' varchar(64)"`
+	Type       string    `json:"type" xorm:"varchar(32) notnull"`
+	Status     string    `json:"status" xorm:"varchar(32) notnull index"`
+	LeaderName string    `json:"leader_name" xorm:"varchar(64)"`
+	FencerId   int       `json:"fencer_id"`
+	Instances  []string  `json:"instances" xorm:"text"`
+	Message    string    `json:"message" xorm:"text"`
+	CreatedAt  time.Time `json:"created_at" xorm:"TIMESTAMP"`
+	UpdatedAt  time.Time `json:"updated_at" xorm:"TIMESTAMP"`
+
+	Steps []*OperationStep `json:"steps,omitempty" xorm:"-"`
+}
+
+type OperationStep struct {
+	Id          int       `json:"id" xorm:"pk autoincr"`
+	OperationId int       `json:"operation_id" xorm:"index"`
+	Seq         int       `json:"seq"`
+	Name        string    `json:"name" xorm:"varchar(64) notnull"`
+	Type        string    `json:"type" xorm:"varchar(32) notnull"`
+	Status      string    `json:"status" xorm:"varchar(32) notnull"`
+	Message     string    `json:"message" xorm:"text"`
+	StartedAt   time.Time `json:"started_at" xorm:"TIMESTAMP"`
+	FinishedAt  time.Time `json:"finished_at" xorm:"TIMESTAMP"`
+}
+
+// JournalEvent is one event received by the leader.
+type JournalEvent struct {
+	Id       int       `json:"-" xorm:"pk autoincr"`
+	Time     time.Time `json:"time" xorm:"'event_time' TIMESTAMP index"`
+	Hostname string    `json:"hostname" xorm:"varchar(64) notnull"`
+	Tag      string    `json:"tag" xorm:"varchar(64) notnull"`
+	Status   string    `json:"status" xorm:"varchar(32) notnull"`
+}
+
+// RecoveryGroup is recovery policy of a host group imported from inventory,
+// it takes precedence over the one in configurations of monitors.
+type RecoveryGroup struct {
+	Id        int            `json:"id" xorm:"pk autoincr"`
+	Name      string         `json:"name" xorm:"varchar(64) unique notnull"`
+	Steps     []RecoveryStep `json:"steps" xorm:"text"`
+	UpdatedAt time.Time      `json:"updated_at" xorm:"TIMESTAMP"`
+	Version   int            `json:"version" xorm:"notnull default 1"`
+}
+
+// RecoveryStep is one step of recovery policy, same as
+// config.RecoveryStepConfig.
+type RecoveryStep struct {
+	Type    string `json:"type"`
+	Name    string `json:"name,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Command string `json:"command,omitempty"`
+	Timeout int    `json:"timeout,omitempty"`
 }
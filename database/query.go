@@ -0,0 +1,267 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-xorm/xorm"
+)
+
+var ErrMarkerNotFound = registerError(errors.New("marker not found."))
+
+// SortKey orders rows by column.
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+// Page selects rows after marker in order of sort keys, ties are always
+// broken by id.
+type Page struct {
+	Sort []SortKey
+	// 0 means no limit
+	Limit int
+	// id of the last row of previous page, 0 starts from the first row
+	Marker int
+}
+
+// HostQuery selects hosts, zero values match all hosts.
+type HostQuery struct {
+	Status     []string
+	Disabled   *bool
+	NamePrefix string
+	Group      string
+	// hosts which have failures on tag
+	FailedTag string
+	Page
+}
+
+// FencerQuery selects fencers, zero values match all fencers.
+type FencerQuery struct {
+	HostId int
+	Type   string
+	Page
+}
+
+func HostFind(q *HostQuery) ([]*Host, error) {
+	var marker *Host
+	if q.Marker > 0 {
+		var err error
+		if marker, err = HostGetById(q.Marker); err != nil {
+			return nil, err
+		} else if marker == nil {
+			return nil, ErrMarkerNotFound
+		}
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+	if len(q.Status) > 0 {
+		session.In("status", q.Status)
+	}
+	if q.Disabled != nil {
+		session.And("disabled=?", *q.Disabled)
+	}
+	if len(q.NamePrefix) > 0 {
+		session.And("name LIKE ? ESCAPE '!'", likePrefix(q.NamePrefix))
+	}
+	if len(q.Group) > 0 {
+		session.And("host_group=?", q.Group)
+	}
+	if len(q.FailedTag) > 0 {
+		session.And("id IN (SELECT host_id FROM host_state WHERE tag=? AND failed_times>0)", q.FailedTag)
+	}
+	if marker != nil {
+		cond, args := afterMarker(marker, q.Sort)
+		session.And(cond, args...)
+	}
+	pageSession(session, &q.Page)
+
+	hosts := make([]*Host, 0)
+	err := session.Find(&hosts)
+	return hosts, err
+}
+
+func FencerFind(q *FencerQuery) ([]*HostFencer, error) {
+	var marker *HostFencer
+	if q.Marker > 0 {
+		var err error
+		if marker, err = FencerGetById(q.Marker); err != nil {
+			return nil, err
+		} else if marker == nil {
+			return nil, ErrMarkerNotFound
+		}
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+	if q.HostId > 0 {
+		session.And("host_id=?", q.HostId)
+	}
+	if len(q.Type) > 0 {
+		session.And("type=?", q.Type)
+	}
+	if marker != nil {
+		cond, args := afterMarker(marker, q.Sort)
+		session.And(cond, args...)
+	}
+	pageSession(session, &q.Page)
+
+	fencers := make([]*HostFencer, 0)
+	err := session.Find(&fencers)
+	return fencers, err
+}
+
+// likePrefix returns pattern of LIKE matching prefix, with ! as escape.
+func likePrefix(prefix string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(prefix) + "%"
+}
+
+// pageSession orders session by sort keys then id, and limits it.
+func pageSession(session *xorm.Session, p *Page) {
+	orders := make([]string, 0, len(p.Sort)+1)
+	for _, key := range sortKeys(p.Sort) {
+		if key.Desc {
+			orders = append(orders, key.Column+" DESC")
+		} else {
+			orders = append(orders, key.Column+" ASC")
+		}
+	}
+	session.OrderBy(strings.Join(orders, ","))
+	if p.Limit > 0 {
+		session.Limit(p.Limit)
+	}
+}
+
+// afterMarker returns condition of rows after marker in order of sort keys,
+// which is, for keys a, b and id,
+// a>? OR (a=? AND b>?) OR (a=? AND b=? AND id>?).
+func afterMarker(marker interface{}, keys []SortKey) (string, []interface{}) {
+	keys = sortKeys(keys)
+	row := reflect.ValueOf(marker).Elem()
+	ors := make([]string, 0, len(keys))
+	args := make([]interface{}, 0)
+	for i, key := range keys {
+		ands := make([]string, 0, i+1)
+		for _, prev := range keys[:i] {
+			ands = append(ands, prev.Column+"=?")
+			args = append(args, columnArg(row, prev.Column))
+		}
+		if key.Desc {
+			ands = append(ands, key.Column+"<?")
+		} else {
+			ands = append(ands, key.Column+">?")
+		}
+		args = append(args, columnArg(row, key.Column))
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+// columnArg returns value of column in row as it is saved by xorm.
+func columnArg(row reflect.Value, column string) interface{} {
+	value := fieldByColumn(row, column).Interface()
+	if t, ok := value.(time.Time); ok {
+		return t.In(engine.DatabaseTZ).Format("2006-01-02 15:04:05")
+	}
+	return value
+}
+
+// sortKeys appends id to keys unless they are ordered by id already.
+func sortKeys(keys []SortKey) []SortKey {
+	for _, key := range keys {
+		if key.Column == "id" {
+			return keys
+		}
+	}
+	return append(append(make([]SortKey, 0, len(keys)+1), keys...), SortKey{Column: "id"})
+}
+
+// fieldByColumn returns field of row which is saved in column.
+func fieldByColumn(row reflect.Value, column string) reflect.Value {
+	for i := 0; i < row.NumField(); i++ {
+		if columnName(row.Type().Field(i)) == column {
+			return row.Field(i)
+		}
+	}
+	panic(fmt.Sprintf("no column %s in %s", column, row.Type().Name()))
+}
+
+// compareColumn compares column of rows a and b, which are pointers to
+// structs of the same type.
+func compareColumn(a, b interface{}, column string) int {
+	x := fieldByColumn(reflect.ValueOf(a).Elem(), column)
+	y := fieldByColumn(reflect.ValueOf(b).Elem(), column)
+	switch x.Kind() {
+	case reflect.Int, reflect.Int64:
+		return compareInts(x.Int(), y.Int())
+	case reflect.String:
+		return strings.Compare(x.String(), y.String())
+	case reflect.Bool:
+		return compareInts(boolInt(x.Bool()), boolInt(y.Bool()))
+	}
+	if t, ok := x.Interface().(time.Time); ok {
+		u := y.Interface().(time.Time)
+		return compareInts(t.UnixNano(), u.UnixNano())
+	}
+	panic(fmt.Sprintf("can not compare column %s", column))
+}
+
+func compareInts(x, y int64) int {
+	if x < y {
+		return -1
+	} else if x > y {
+		return 1
+	}
+	return 0
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// compareRows compares rows a and b in order of sort keys.
+func compareRows(a, b interface{}, keys []SortKey) int {
+	for _, key := range keys {
+		if c := compareColumn(a, b, key.Column); c != 0 {
+			if key.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+// pageRows sorts rows, a slice of pointers to structs, and returns those
+// after marker in page, just like pageSession and afterMarker do in SQL.
+// Marker is a pointer to struct, which may be nil.
+func pageRows(rows interface{}, marker interface{}, p *Page) interface{} {
+	keys := sortKeys(p.Sort)
+	if reflect.ValueOf(marker).IsNil() {
+		marker = nil
+	}
+	value := reflect.ValueOf(rows)
+	sort.SliceStable(rows, func(i, j int) bool {
+		return compareRows(value.Index(i).Interface(), value.Index(j).Interface(), keys) < 0
+	})
+
+	paged := reflect.MakeSlice(value.Type(), 0, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		if p.Limit > 0 && paged.Len() >= p.Limit {
+			break
+		}
+		row := value.Index(i)
+		if marker == nil || compareRows(row.Interface(), marker, keys) > 0 {
+			paged = reflect.Append(paged, row)
+		}
+	}
+	return paged.Interface()
+}
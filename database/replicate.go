@@ -0,0 +1,410 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/go-xorm/xorm"
+)
+
+const (
+	opCheck  = "check"
+	opInsert = "insert"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+// Replicator replicates a write command to every node, then applies it
+// through ApplyCommand and returns what ApplyCommand returned on this node.
+type Replicator interface {
+	Replicate(data []byte) (interface{}, error)
+}
+
+var replicator Replicator
+
+// SetReplicator routes all writes through r, nil means writing to the
+// database directly.
+func SetReplicator(r Replicator) {
+	replicator = r
+}
+
+// writeOp is one statement of a write command, all ops of a command are
+// applied in one transaction.
+type writeOp struct {
+	Action string          `json:"action"`
+	Table  string          `json:"table"`
+	Id     int             `json:"id,omitempty"`
+	Cols   []string        `json:"cols,omitempty"`
+	Where  string          `json:"where,omitempty"`
+	Args   []interface{}   `json:"args,omitempty"`
+	Bean   json.RawMessage `json:"bean,omitempty"`
+	// error returned if a check finds nothing, or finds any if Absent is set
+	Error  string `json:"error,omitempty"`
+	Absent bool   `json:"absent,omitempty"`
+	// version the row must have, the update bumps it
+	Version int `json:"version,omitempty"`
+	// set field of bean to id inserted by an earlier op
+	LinkOp    int    `json:"link_op,omitempty"`
+	LinkField string `json:"link_field,omitempty"`
+
+	bean interface{}
+}
+
+type writeResult struct {
+	Id       int64
+	Affected int64
+}
+
+// applyResult is returned by ApplyCommand.
+type applyResult struct {
+	results []writeResult
+	err     error
+}
+
+// knownErrors keeps identity of errors raised by check ops.
+var knownErrors = map[string]error{}
+
+func registerError(err error) error {
+	knownErrors[err.Error()] = err
+	return err
+}
+
+func tableName(bean interface{}) string {
+	return engine.TableInfo(bean).Name
+}
+
+func newBean(table string) (interface{}, error) {
+	for _, t := range allTables {
+		if tableName(t) == table {
+			return reflect.New(reflect.TypeOf(t).Elem()).Interface(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown table %s", table)
+}
+
+func checkOp(bean interface{}, err error, where string, args ...interface{}) *writeOp {
+	return &writeOp{Action: opCheck, bean: bean, Where: where, Args: args, Error: err.Error()}
+}
+
+// checkAbsentOp fails with err if any row matches condition.
+func checkAbsentOp(bean interface{}, err error, where string, args ...interface{}) *writeOp {
+	op := checkOp(bean, err, where, args...)
+	op.Absent = true
+	return op
+}
+
+func insertOp(bean interface{}) *writeOp {
+	if version, ok := getVersion(bean); ok && version == 0 {
+		setField(bean, "Version", 1)
+	}
+	return &writeOp{Action: opInsert, bean: bean}
+}
+
+// link sets field of bean to id of bean inserted by op at index before insert.
+func (op *writeOp) link(index int, field string) *writeOp {
+	op.LinkOp = index
+	op.LinkField = field
+	return op
+}
+
+// updateOp updates row by id, rows with a version are only updated if they
+// still have the version of bean, otherwise it fails with ErrConflict.
+func updateOp(id int, bean interface{}, cols ...string) *writeOp {
+	version, _ := getVersion(bean)
+	return &writeOp{Action: opUpdate, Id: id, bean: bean, Cols: cols, Version: version}
+}
+
+func deleteOp(id int, bean interface{}) *writeOp {
+	return &writeOp{Action: opDelete, Id: id, bean: bean}
+}
+
+// deleteWhereOp deletes all rows matching condition.
+func deleteWhereOp(bean interface{}, where string, args ...interface{}) *writeOp {
+	return &writeOp{Action: opDelete, bean: bean, Where: where, Args: args}
+}
+
+// write applies ops in one transaction, through replicator if there is one.
+// Ids of inserted beans are set in place, so are versions of updated beans.
+func write(ops ...*writeOp) ([]writeResult, error) {
+	var results []writeResult
+	var err error
+	if replicator == nil {
+		results, err = applyOps(ops, false)
+	} else {
+		results, err = replicate(ops)
+	}
+
+	// versions are only bumped by updates which changed their rows, not by
+	// rolled back transactions or updates rejected by their conditions
+	for i, op := range ops {
+		if op.Action == opUpdate && op.Version > 0 {
+			version := op.Version
+			if err == nil && results[i].Affected > 0 {
+				version++
+			}
+			setField(op.bean, "Version", int64(version))
+		}
+	}
+	return results, err
+}
+
+// replicate applies ops on every node through replicator.
+func replicate(ops []*writeOp) ([]writeResult, error) {
+	for _, op := range ops {
+		op.Table = tableName(op.bean)
+		if op.Action == opInsert || op.Action == opUpdate {
+			data, err := json.Marshal(op.bean)
+			if err != nil {
+				return nil, err
+			}
+			op.Bean = data
+		}
+	}
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	response, err := replicator.Replicate(data)
+	if err != nil {
+		return nil, err
+	}
+	result, ok := response.(*applyResult)
+	if !ok {
+		return nil, errors.New("unexpected response of replicated write.")
+	} else if result.err != nil {
+		return nil, result.err
+	}
+	for i, op := range ops {
+		if op.Action == opInsert {
+			setField(op.bean, "Id", result.results[i].Id)
+			if len(op.LinkField) > 0 {
+				setField(op.bean, op.LinkField, result.results[op.LinkOp].Id)
+			}
+		}
+	}
+	return result.results, nil
+}
+
+// ApplyCommand applies a replicated write command to local database.
+// It must be deterministic since every node applies the same commands.
+func ApplyCommand(data []byte) interface{} {
+	var ops []*writeOp
+
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return &applyResult{err: err}
+	}
+	for _, op := range ops {
+		bean, err := newBean(op.Table)
+		if err != nil {
+			return &applyResult{err: err}
+		}
+		if len(op.Bean) > 0 {
+			if err := json.Unmarshal(op.Bean, bean); err != nil {
+				return &applyResult{err: err}
+			}
+		}
+		op.bean = bean
+		// numbers are decoded as float64, keep integers as integers
+		for i, arg := range op.Args {
+			if f, ok := arg.(float64); ok && f == float64(int64(f)) {
+				op.Args[i] = int64(f)
+			}
+		}
+	}
+	results, err := applyOps(ops, true)
+	return &applyResult{results: results, err: err}
+}
+
+// applyOps applies ops in one transaction. Ids of inserted rows are assigned
+// by us if assignIds is set, since auto increment counters of replicas
+// may differ.
+func applyOps(ops []*writeOp, assignIds bool) ([]writeResult, error) {
+	session := engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+	results := make([]writeResult, len(ops))
+	for i, op := range ops {
+		var err error
+		switch op.Action {
+		case opCheck:
+			var exist bool
+			exist, err = session.Where(op.Where, op.Args...).Exist(op.bean)
+			if err == nil && exist == op.Absent {
+				err = errors.New(op.Error)
+				if known, ok := knownErrors[op.Error]; ok {
+					err = known
+				}
+			}
+		case opInsert:
+			if len(op.LinkField) > 0 {
+				setField(op.bean, op.LinkField, results[op.LinkOp].Id)
+			}
+			if assignIds {
+				var id int64
+				id, err = nextId(session, op.bean)
+				if err != nil {
+					break
+				}
+				setField(op.bean, "Id", id)
+			}
+			results[i].Affected, err = session.Insert(op.bean)
+			results[i].Id = getId(op.bean)
+		case opUpdate:
+			s := session.ID(op.Id)
+			if len(op.Where) > 0 {
+				s = s.And(op.Where, op.Args...)
+			}
+			cols := op.Cols
+			if op.Version > 0 {
+				setField(op.bean, "Version", int64(op.Version+1))
+				s = s.And("version=?", op.Version)
+				if len(cols) > 0 {
+					cols = append(append([]string{}, cols...), "version")
+				}
+			}
+			if len(cols) > 0 {
+				s = s.Cols(cols...)
+			}
+			results[i].Affected, err = s.Update(op.bean)
+			if err == nil && op.Version > 0 && results[i].Affected == 0 {
+				err = checkConflict(session, op)
+			}
+		case opDelete:
+			if op.Id > 0 {
+				results[i].Affected, err = session.ID(op.Id).Delete(op.bean)
+			} else {
+				results[i].Affected, err = session.Where(op.Where, op.Args...).Delete(op.bean)
+			}
+		default:
+			err = fmt.Errorf("unknown write action %s", op.Action)
+		}
+		if err != nil {
+			session.Rollback()
+			return nil, err
+		}
+	}
+	return results, session.Commit()
+}
+
+// checkConflict returns ErrConflict if the row updated by op has been
+// changed by others, nothing if it has been deleted.
+func checkConflict(session *xorm.Session, op *writeOp) error {
+	bean, err := newBean(tableName(op.bean))
+	if err != nil {
+		return err
+	}
+	changed, err := session.ID(op.Id).And("version<>?", op.Version).Exist(bean)
+	if err != nil {
+		return err
+	} else if changed {
+		return ErrConflict
+	}
+	return nil
+}
+
+func nextId(session *xorm.Session, bean interface{}) (int64, error) {
+	var max int64
+
+	sql := "SELECT COALESCE(MAX(id), 0) FROM " + engine.Quote(tableName(bean))
+	if _, err := session.SQL(sql).Get(&max); err != nil {
+		return 0, err
+	}
+	return max + 1, nil
+}
+
+// getVersion returns version of bean, ok is false if bean has no version.
+func getVersion(bean interface{}) (int, bool) {
+	field := reflect.ValueOf(bean).Elem().FieldByName("Version")
+	if field.Kind() != reflect.Int {
+		return 0, false
+	}
+	return int(field.Int()), true
+}
+
+func getId(bean interface{}) int64 {
+	field := reflect.ValueOf(bean).Elem().FieldByName("Id")
+	switch field.Kind() {
+	case reflect.Int, reflect.Int64:
+		return field.Int()
+	case reflect.Uint32:
+		return int64(field.Uint())
+	}
+	return 0
+}
+
+func setField(bean interface{}, name string, id int64) {
+	field := reflect.ValueOf(bean).Elem().FieldByName(name)
+	switch field.Kind() {
+	case reflect.Int, reflect.Int64:
+		field.SetInt(id)
+	case reflect.Uint32:
+		field.SetUint(uint64(id))
+	}
+}
+
+// Dump returns content of all tables, it is used for snapshots.
+func Dump() ([]byte, error) {
+	tables := map[string][]interface{}{}
+
+	for _, t := range allTables {
+		rows := make([]interface{}, 0)
+		err := engine.Iterate(t, func(i int, bean interface{}) error {
+			rows = append(rows, bean)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		tables[tableName(t)] = rows
+	}
+	return json.Marshal(tables)
+}
+
+// Load replaces content of all tables with data returned by Dump.
+func Load(data []byte) error {
+	var tables map[string][]json.RawMessage
+
+	if err := json.Unmarshal(data, &tables); err != nil {
+		return err
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	// delete rows referencing others first, foreign keys may be enforced
+	for i := len(allTables) - 1; i >= 0; i-- {
+		name := tableName(allTables[i])
+		if _, err := session.Exec("DELETE FROM " + engine.Quote(name)); err != nil {
+			session.Rollback()
+			return err
+		}
+	}
+	for _, t := range allTables {
+		name := tableName(t)
+		for _, row := range tables[name] {
+			bean, _ := newBean(name)
+			if err := json.Unmarshal(row, bean); err != nil {
+				session.Rollback()
+				return err
+			}
+			if _, err := session.Insert(bean); err != nil {
+				session.Rollback()
+				return err
+			}
+		}
+	}
+	return session.Commit()
+}
+
+// Reset deletes content of all tables.
+func Reset() error {
+	return Load([]byte("{}"))
+}
@@ -0,0 +1,150 @@
+package database
+
+import "time"
+
+// Store keeps hosts with their states, fencers and operations, and the
+// election of monitors.
+type Store interface {
+	// HostInsert inserts host and its fencers, all or nothing.
+	HostInsert(host *Host, fencers ...*HostFencer) error
+	HostGetAll() ([]*Host, error)
+	HostFind(q *HostQuery) ([]*Host, error)
+	HostGetById(id int) (*Host, error)
+	HostGetByName(name string) (*Host, error)
+	HostUpdate(id int, host *Host) error
+	HostUpdateFields(host *Host, fields ...string) error
+	HostUpdateStatus(host *Host, history *HostStatusHistory) error
+	HostEnable(host *Host, states []*HostState, history *HostStatusHistory) error
+	HostDelete(id, version int) error
+	HostHistoryGetAll(hostId int) ([]*HostStatusHistory, error)
+
+	StateGetAll(hostId int) ([]*HostState, error)
+	StateGetAllHosts() (map[int][]*HostState, error)
+	StateGetById(id int) (*HostState, error)
+	StateInsert(state *HostState) error
+	StateUpdate(id int, state *HostState) error
+	StateDelete(id, version int) error
+
+	FencerGetAll() ([]*HostFencer, error)
+	FencerFind(q *FencerQuery) ([]*HostFencer, error)
+	FencerGetByHost(hostId int) ([]*HostFencer, error)
+	FencerGetById(id int) (*HostFencer, error)
+	FencerInsert(fencer *HostFencer) error
+	FencerUpdate(id int, fencer *HostFencer) error
+	FencerDelete(id, version int) error
+
+	RecoveryGroupGetAll() ([]*RecoveryGroup, error)
+	// InventorySave saves all changes of an import, all or nothing.
+	InventorySave(c *InventoryChanges) error
+
+	OperationGetAll(hostId int, status string) ([]*Operation, error)
+	OperationGetById(id int) (*Operation, error)
+	OperationGetLatest(hostId int) (*Operation, error)
+	OperationStepGetAll(operationId int) ([]*OperationStep, error)
+
+	ElectionGet(name string) (*ElectionRecord, error)
+	ElectionProclaim(name, leader, address string, term time.Duration) (int64, bool, error)
+	ElectionQuit(name, leader string) error
+	ElectionMemberGetAll(name string) ([]*ElectionMember, error)
+	ElectionMemberSave(member *ElectionMember, newTerm bool) error
+	EpochValid(e *Epoch, term time.Duration) (bool, error)
+
+	// Guard returns writes which fail with ErrStaleEpoch once epoch is not
+	// the current term, writes are not guarded if epoch is nil.
+	Guard(epoch *Epoch) GuardedStore
+}
+
+// GuardedStore holds writes made by the leader.
+type GuardedStore interface {
+	HostUpdateFields(host *Host, fields ...string) error
+	HostUpdateStatus(host *Host, history *HostStatusHistory) error
+	HostsSave(changes []*HostChanges) []error
+	OperationInsert(op *Operation, steps []*OperationStep) error
+	OperationUpdateFields(op *Operation, fields ...string) error
+	OperationStepUpdateFields(step *OperationStep, fields ...string) error
+}
+
+// sqlStore keeps everything in database opened by Engine.
+type sqlStore struct{}
+
+func NewSQLStore() Store {
+	return sqlStore{}
+}
+
+func (sqlStore) HostInsert(host *Host, fencers ...*HostFencer) error {
+	return HostInsert(host, fencers...)
+}
+func (sqlStore) HostGetAll() ([]*Host, error)             { return HostGetAll() }
+func (sqlStore) HostFind(q *HostQuery) ([]*Host, error)   { return HostFind(q) }
+func (sqlStore) HostGetById(id int) (*Host, error)        { return HostGetById(id) }
+func (sqlStore) HostGetByName(name string) (*Host, error) { return HostGetByName(name) }
+func (sqlStore) HostUpdate(id int, host *Host) error      { return HostUpdate(id, host) }
+func (sqlStore) HostDelete(id, version int) error         { return HostDelete(id, version) }
+
+func (sqlStore) HostUpdateFields(host *Host, fields ...string) error {
+	return HostUpdateFields(host, fields...)
+}
+
+func (sqlStore) HostUpdateStatus(host *Host, history *HostStatusHistory) error {
+	return HostUpdateStatus(host, history)
+}
+
+func (sqlStore) HostEnable(host *Host, states []*HostState, history *HostStatusHistory) error {
+	return HostEnable(host, states, history)
+}
+
+func (sqlStore) HostHistoryGetAll(hostId int) ([]*HostStatusHistory, error) {
+	return HostHistoryGetAll(hostId)
+}
+
+func (sqlStore) StateGetAll(hostId int) ([]*HostState, error)      { return StateGetAll(hostId) }
+func (sqlStore) StateGetAllHosts() (map[int][]*HostState, error)   { return StateGetAllHosts() }
+func (sqlStore) StateGetById(id int) (*HostState, error)           { return StateGetById(id) }
+func (sqlStore) StateInsert(state *HostState) error                { return StateInsert(state) }
+func (sqlStore) StateUpdate(id int, state *HostState) error        { return StateUpdate(id, state) }
+func (sqlStore) StateDelete(id, version int) error                 { return StateDelete(id, version) }
+func (sqlStore) FencerGetAll() ([]*HostFencer, error)              { return FencerGetAll() }
+func (sqlStore) FencerFind(q *FencerQuery) ([]*HostFencer, error)  { return FencerFind(q) }
+func (sqlStore) FencerGetByHost(hostId int) ([]*HostFencer, error) { return FencerGetByHost(hostId) }
+func (sqlStore) FencerGetById(id int) (*HostFencer, error)         { return FencerGetById(id) }
+func (sqlStore) FencerInsert(fencer *HostFencer) error             { return FencerInsert(fencer) }
+func (sqlStore) FencerUpdate(id int, fencer *HostFencer) error     { return FencerUpdate(id, fencer) }
+func (sqlStore) FencerDelete(id, version int) error                { return FencerDelete(id, version) }
+
+func (sqlStore) RecoveryGroupGetAll() ([]*RecoveryGroup, error) { return RecoveryGroupGetAll() }
+func (sqlStore) InventorySave(c *InventoryChanges) error        { return InventorySave(c) }
+
+func (sqlStore) OperationGetAll(hostId int, status string) ([]*Operation, error) {
+	return OperationGetAll(hostId, status)
+}
+
+func (sqlStore) OperationGetById(id int) (*Operation, error)       { return OperationGetById(id) }
+func (sqlStore) OperationGetLatest(hostId int) (*Operation, error) { return OperationGetLatest(hostId) }
+
+func (sqlStore) OperationStepGetAll(operationId int) ([]*OperationStep, error) {
+	return OperationStepGetAll(operationId)
+}
+
+func (sqlStore) ElectionGet(name string) (*ElectionRecord, error) { return ElectionGet(name) }
+
+func (sqlStore) ElectionProclaim(name, leader, address string, term time.Duration) (int64, bool, error) {
+	return ElectionProclaim(name, leader, address, term)
+}
+
+func (sqlStore) ElectionQuit(name, leader string) error { return ElectionQuit(name, leader) }
+
+func (sqlStore) ElectionMemberGetAll(name string) ([]*ElectionMember, error) {
+	return ElectionMemberGetAll(name)
+}
+
+func (sqlStore) ElectionMemberSave(member *ElectionMember, newTerm bool) error {
+	return ElectionMemberSave(member, newTerm)
+}
+
+func (sqlStore) EpochValid(e *Epoch, term time.Duration) (bool, error) {
+	return EpochValid(e, term)
+}
+
+func (sqlStore) Guard(epoch *Epoch) GuardedStore {
+	return Guard(epoch)
+}
@@ -0,0 +1,214 @@
+package monitor
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"themis/api"
+	"themis/config"
+)
+
+// NewAuthenticators creates authenticators of static tokens and keystone,
+// none if authentication is not configured.
+func NewAuthenticators(cfg *config.AuthConfig) []api.Authenticator {
+	authenticators := make([]api.Authenticator, 0)
+	if len(cfg.Tokens) > 0 {
+		authenticators = append(authenticators, NewStaticTokens(cfg.Tokens))
+	}
+	if len(cfg.Keystone.AuthURL) > 0 {
+		keystone, err := NewKeystoneAuthenticator(&cfg.Keystone)
+		if err != nil {
+			plog.Fatal("Unable to create keystone authenticator: ", err)
+		}
+		authenticators = append(authenticators, keystone)
+	}
+	return authenticators
+}
+
+// StaticTokens authenticates tokens listed in configurations.
+type StaticTokens struct {
+	tokens []config.TokenConfig
+}
+
+func NewStaticTokens(tokens []config.TokenConfig) *StaticTokens {
+	return &StaticTokens{tokens: tokens}
+}
+
+func (s *StaticTokens) Authenticate(token string) (*api.Identity, error) {
+	var identity *api.Identity
+	// compare with all tokens in constant time, so that timing tells nothing
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			identity = &api.Identity{Name: t.Name, Role: t.Role}
+		}
+	}
+	return identity, nil
+}
+
+type keystoneToken struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		User      struct {
+			Name string `json:"name"`
+		} `json:"user"`
+		// nil if token is not scoped to a project
+		Project *struct {
+			Id     string `json:"id"`
+			Name   string `json:"name"`
+			Domain struct {
+				Name string `json:"name"`
+			} `json:"domain"`
+		} `json:"project"`
+		Roles []struct {
+			Name string `json:"name"`
+		} `json:"roles"`
+	} `json:"token"`
+}
+
+type cachedIdentity struct {
+	identity *api.Identity
+	expires  time.Time
+}
+
+// KeystoneAuthenticator validates tokens with keystone, the token itself is
+// used to validate it so that we need no credentials of keystone. Only
+// tokens scoped to the configured project are accepted, and their roles
+// grant nothing unless they are mapped.
+type KeystoneAuthenticator struct {
+	url    string
+	ttl    time.Duration
+	roles  map[string]string
+	client *http.Client
+	// project tokens must be scoped to
+	projectId     string
+	projectName   string
+	projectDomain string
+
+	mutex sync.Mutex
+	// validated tokens keyed by their hashes
+	cache map[[sha256.Size]byte]*cachedIdentity
+}
+
+func NewKeystoneAuthenticator(cfg *config.KeystoneAuthConfig) (*KeystoneAuthenticator, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+	if !cfg.Insecure && len(cfg.CAFile) > 0 {
+		ca, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		tlsConfig.RootCAs = pool
+	}
+
+	url := strings.TrimSuffix(cfg.AuthURL, "/")
+	if !strings.HasSuffix(url, "/v3") {
+		url += "/v3"
+	}
+	return &KeystoneAuthenticator{
+		url:   url,
+		ttl:   time.Duration(cfg.CacheTTL) * time.Second,
+		roles: cfg.Roles,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		projectId:     cfg.ProjectId,
+		projectName:   cfg.ProjectName,
+		projectDomain: cfg.ProjectDomain,
+		cache:         map[[sha256.Size]byte]*cachedIdentity{},
+	}, nil
+}
+
+func (k *KeystoneAuthenticator) Authenticate(token string) (*api.Identity, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	k.mutex.Lock()
+	cached := k.cache[key]
+	k.mutex.Unlock()
+	if cached != nil && now.Before(cached.expires) {
+		return cached.identity, nil
+	}
+
+	validated, err := k.validate(token)
+	if err != nil || validated == nil || !k.inProject(validated) {
+		return nil, err
+	}
+	identity := &api.Identity{Name: validated.Token.User.Name}
+	for _, role := range validated.Token.Roles {
+		// the highest role wins
+		if r := k.roles[role.Name]; api.RoleLevel(r) > api.RoleLevel(identity.Role) {
+			identity.Role = r
+		}
+	}
+
+	expires := now.Add(k.ttl)
+	if !validated.Token.ExpiresAt.IsZero() && validated.Token.ExpiresAt.Before(expires) {
+		expires = validated.Token.ExpiresAt
+	}
+	k.mutex.Lock()
+	for key, c := range k.cache {
+		if !now.Before(c.expires) {
+			delete(k.cache, key)
+		}
+	}
+	k.cache[key] = &cachedIdentity{identity: identity, expires: expires}
+	k.mutex.Unlock()
+	return identity, nil
+}
+
+// inProject tells if token is scoped to the configured project.
+func (k *KeystoneAuthenticator) inProject(validated *keystoneToken) bool {
+	project := validated.Token.Project
+	if project == nil {
+		return false
+	} else if len(k.projectId) > 0 {
+		return project.Id == k.projectId
+	}
+	return project.Name == k.projectName && project.Domain.Name == k.projectDomain
+}
+
+// validate returns token from keystone, nil if it is invalid.
+func (k *KeystoneAuthenticator) validate(token string) (*keystoneToken, error) {
+	req, err := http.NewRequest("GET", k.url+"/auth/tokens", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Auth-Token", token)
+	req.Header.Set("X-Subject-Token", token)
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("keystone responds %d: %s", resp.StatusCode, data)
+	}
+
+	var validated keystoneToken
+	if err := json.Unmarshal(data, &validated); err != nil {
+		return nil, err
+	}
+	return &validated, nil
+}
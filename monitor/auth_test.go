@@ -0,0 +1,164 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"themis/api"
+	"themis/config"
+)
+
+// keystoneProject is project a fake token is scoped to.
+type keystoneProject struct {
+	id, name, domain string
+}
+
+// fakeKeystone validates tokens it knows, and counts validations.
+type fakeKeystone struct {
+	*httptest.Server
+
+	mutex       sync.Mutex
+	roles       map[string][]string
+	projects    map[string]*keystoneProject
+	validations int
+	fail        bool
+}
+
+func newFakeKeystone(t *testing.T) *fakeKeystone {
+	project := &keystoneProject{id: "p1", name: "themis", domain: "Default"}
+	k := &fakeKeystone{
+		roles: map[string][]string{
+			"admin":    {"admin", "member"},
+			"member":   {"member"},
+			"reader":   {"reader", "member"},
+			"other":    {"admin"},
+			"unscoped": {"admin"},
+		},
+		projects: map[string]*keystoneProject{
+			"admin":  project,
+			"member": project,
+			"reader": project,
+			"other":  {id: "p2", name: "themis", domain: "other"},
+		},
+	}
+	k.Server = httptest.NewServer(http.HandlerFunc(k.serve))
+	t.Cleanup(k.Close)
+	return k
+}
+
+func (k *fakeKeystone) serve(w http.ResponseWriter, r *http.Request) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.validations++
+	token := r.Header.Get("X-Subject-Token")
+	if r.URL.Path != "/v3/auth/tokens" || r.Header.Get("X-Auth-Token") != token {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	} else if k.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	roles, ok := k.roles[token]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body := map[string]interface{}{
+		"expires_at": time.Now().Add(time.Hour),
+		"user":       map[string]string{"name": "user-" + token},
+	}
+	if project := k.projects[token]; project != nil {
+		body["project"] = map[string]interface{}{
+			"id":     project.id,
+			"name":   project.name,
+			"domain": map[string]string{"name": project.domain},
+		}
+	}
+	names := make([]map[string]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, map[string]string{"name": role})
+	}
+	body["roles"] = names
+	json.NewEncoder(w).Encode(map[string]interface{}{"token": body})
+}
+
+func newTestKeystone(t *testing.T, k *fakeKeystone, cfg config.KeystoneAuthConfig) *KeystoneAuthenticator {
+	cfg.AuthURL = k.URL
+	cfg.CacheTTL = 300
+	if cfg.Roles == nil {
+		cfg.Roles = map[string]string{"admin": api.RoleAdmin, "reader": api.RoleReader}
+	}
+	a, err := NewKeystoneAuthenticator(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestKeystoneRoles(t *testing.T) {
+	k := newFakeKeystone(t)
+	a := newTestKeystone(t, k, config.KeystoneAuthConfig{ProjectId: "p1"})
+
+	// members get nothing unless their role is mapped
+	for token, role := range map[string]string{"admin": api.RoleAdmin, "reader": api.RoleReader, "member": ""} {
+		identity, err := a.Authenticate(token)
+		if err != nil || identity == nil {
+			t.Fatalf("token %s is rejected: %v", token, err)
+		}
+		if identity.Name != "user-"+token || identity.Role != role {
+			t.Errorf("token %s gets %+v, not role %q", token, identity, role)
+		}
+	}
+
+	a = newTestKeystone(t, k, config.KeystoneAuthConfig{ProjectId: "p1",
+		Roles: map[string]string{"member": api.RoleOperator}})
+	if identity, _ := a.Authenticate("member"); identity == nil || identity.Role != api.RoleOperator {
+		t.Errorf("mapped member gets %+v", identity)
+	}
+}
+
+func TestKeystoneProjectScope(t *testing.T) {
+	k := newFakeKeystone(t)
+	for _, cfg := range []config.KeystoneAuthConfig{
+		{ProjectId: "p1"},
+		{ProjectName: "themis", ProjectDomain: "Default"},
+	} {
+		a := newTestKeystone(t, k, cfg)
+		if identity, err := a.Authenticate("admin"); err != nil || identity == nil {
+			t.Errorf("token of project is rejected: %v", err)
+		}
+		// admins of other projects, or of no project, are nobody here
+		for _, token := range []string{"other", "unscoped", "unknown"} {
+			if identity, err := a.Authenticate(token); err != nil || identity != nil {
+				t.Errorf("token %s is accepted as %+v: %v", token, identity, err)
+			}
+		}
+	}
+}
+
+func TestKeystoneCache(t *testing.T) {
+	k := newFakeKeystone(t)
+	a := newTestKeystone(t, k, config.KeystoneAuthConfig{ProjectId: "p1"})
+	for i := 0; i < 3; i++ {
+		if identity, err := a.Authenticate("admin"); err != nil || identity == nil {
+			t.Fatalf("token is rejected: %v", err)
+		}
+	}
+	if k.validations != 1 {
+		t.Errorf("token is validated %d times", k.validations)
+	}
+
+	k.fail = true
+	if _, err := a.Authenticate("reader"); err == nil {
+		t.Errorf("keystone failure is not reported")
+	}
+	if identity, err := a.Authenticate("admin"); err != nil || identity == nil {
+		t.Errorf("cached token is rejected: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"themis/api"
+)
+
+// clusterView exposes leadership of monitors through REST API.
+type clusterView struct {
+	m *ThemisMonitor
+}
+
+func (c *clusterView) Members() ([]*api.ClusterMember, error) {
+	members, err := c.m.election.Members()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*api.ClusterMember, 0, len(members))
+	for _, member := range members {
+		result = append(result, &api.ClusterMember{
+			Name:         member.Name,
+			Leader:       member.Leader,
+			Term:         member.Term,
+			TermStart:    member.TermStart,
+			LastProclaim: member.LastProclaim,
+			Address:      member.Address,
+		})
+	}
+	return result, nil
+}
+
+func (c *clusterView) Name() string {
+	return c.m.election.Name()
+}
+
+func (c *clusterView) IsLeader() bool {
+	return c.m.election.Validate() == nil
+}
+
+// LeaderAddress returns URL of REST API of current leader, or empty string
+// if there is no leader.
+func (c *clusterView) LeaderAddress() (string, error) {
+	members, err := c.m.election.Members()
+	if err != nil {
+		return "", err
+	}
+	for _, member := range members {
+		if member.Leader {
+			return member.Address, nil
+		}
+	}
+	return "", nil
+}
+
+// StepDown asks our campaign routine to quit leadership.
+func (c *clusterView) StepDown() error {
+	if !c.IsLeader() {
+		return api.ErrNotLeader
+	}
+
+	select {
+	case c.m.stepDown <- struct{}{}:
+	default:
+		// a step down is already pending
+	}
+	return nil
+}
@@ -2,89 +2,222 @@ package monitor
 
 import (
 	"context"
+	"math/rand"
 	"time"
 
-	"github.com/go-xorm/xorm"
+	"themis/config"
+	"themis/database"
 )
 
 const (
-	defaultElectionName   = "themisLeader"
-	defaultTermOfCampaign = 30 // seconds
+	defaultElectionName = "themisLeader"
+	// interval to check if the leader has quit while waiting to campaign
+	defaultCampaignWatchInterval = 1 * time.Second
 )
 
+// Elector elects one leader among monitors.
+type Elector interface {
+	// Campaign blocks until we are elected or an error occurs, or the context is cancelled.
+	Campaign(ctx context.Context) <-chan error
+	// Proclaim renews our leadership, it fails if leadership has changed hands.
+	Proclaim() (bool, error)
+	// Quit gives up our leadership.
+	Quit() error
+	// Epoch returns fencing token of current leadership, nil if writes need no guard.
+	Epoch() *database.Epoch
+	// Validate fails if we are not the leader anymore.
+	Validate() error
+	Name() string
+	// Members returns all monitors which have campaigned.
+	Members() ([]*database.ElectionMember, error)
+}
+
 type Election struct {
 	LeaderName string
-	Engine     *xorm.Engine
+	// URL of our REST API
+	Address string
+	// Term of our current leadership, used as fencing token.
+	Term int64
+
+	config *config.ElectionConfig
+	store  database.Store
+}
+
+func NewElection(name, address string, config *config.ElectionConfig, store database.Store) *Election {
+	return &Election{LeaderName: name, Address: address, config: config, store: store}
+}
+
+// term returns how long a leadership lasts without being renewed.
+func (e *Election) term() time.Duration {
+	return time.Duration(e.config.Term) * time.Second
 }
 
-func NewElection(name string, engine *xorm.Engine) *Election {
-	return &Election{LeaderName: name, Engine: engine}
+func (e *Election) jitter() time.Duration {
+	if e.config.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(e.config.Jitter) * int64(time.Second)))
 }
 
 // Campaign puts a value as eligible for the election.
-// It blocks until it is elected or an error occurs, or the context is cancelled.
+// It blocks until it is elected or the context is cancelled, errors of store
+// are retried.
 func (e *Election) Campaign(ctx context.Context) <-chan error {
 	quit := make(chan error, 1)
 
+	// start a new term
+	e.Term = 0
+
 	for {
 		succ, err := e.Proclaim()
 		if err != nil {
-			plog.Info("Campaign failed: ", err)
-			quit <- err
-			break
+			// store is unavailable, try again later
+			plog.Warning("Campaign failed: ", err)
 		} else if succ {
 			plog.Infof("%s campaign successed.", e.LeaderName)
 			break
 		}
-		plog.Debugf("%s campaign failed, sleep %d seconds and try again.",
-			e.LeaderName, defaultTermOfCampaign)
+		retry := e.retryInterval()
+		plog.Debugf("%s campaign failed, try again in %s.", e.LeaderName, retry)
 		// wait and campaign again
-		select {
-		case <-ctx.Done():
+		if !e.waitCampaign(ctx, retry) {
 			plog.Info("Quit campaign: ", ctx.Err())
 			return quit
-		case <-time.After(defaultTermOfCampaign * time.Second):
-			continue
 		}
 	}
 
 	return quit
 }
 
-func (e *Election) Proclaim() (bool, error) {
-	sql := `INSERT IGNORE INTO election_record (election_name, leader_name, last_update) VALUES (?, ?, ?)
-			ON DUPLICATE KEY UPDATE
-			leader_name = IF(last_update < DATE_SUB(VALUES(last_update), INTERVAL ? SECOND), VALUES(leader_name), leader_name),
-			last_update = IF(leader_name = VALUES(leader_name), VALUES(last_update), last_update)`
-	res, err := e.Engine.Exec(sql, defaultElectionName, e.LeaderName, time.Now(), defaultTermOfCampaign)
+// retryInterval returns how long to wait before campaigning again, that is
+// until lease of current leader expires, plus a random jitter so that
+// followers do not campaign at the same moment.
+func (e *Election) retryInterval() time.Duration {
+	wait := e.term()
+	record, err := e.store.ElectionGet(defaultElectionName)
+	if err == nil && record != nil {
+		wait = time.Until(record.LastUpdate.Add(e.term()))
+	}
+	wait += e.jitter()
+	if wait < defaultCampaignWatchInterval {
+		wait = defaultCampaignWatchInterval
+	}
+	return wait
+}
 
-	if err != nil {
-		return false, err
+// waitCampaign waits for d or until the leader quits, it returns false if
+// ctx is cancelled.
+func (e *Election) waitCampaign(ctx context.Context, d time.Duration) bool {
+	deadline := time.After(d)
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline:
+			return true
+		case <-time.After(defaultCampaignWatchInterval):
+		}
+
+		record, err := e.store.ElectionGet(defaultElectionName)
+		if err == nil && record != nil && record.Released() {
+			plog.Infof("%s has quit, campaign at once.", record.LeaderName)
+			return true
+		}
 	}
+}
 
-	affected, err := res.RowsAffected()
+// Proclaim acquires or renews our leadership, it fails if leadership has
+// changed hands since last successful proclaim.
+func (e *Election) Proclaim() (bool, error) {
+	term, succ, err := e.store.ElectionProclaim(defaultElectionName, e.LeaderName,
+		e.Address, e.term())
 	if err != nil {
 		return false, err
 	}
-	if affected >= 1 {
-		return true, nil
-	} else {
+	recordMember(e.store, e.LeaderName, e.Address, term, succ && e.Term == 0)
+	if !succ {
 		return false, nil
 	}
+	if e.Term == 0 {
+		e.Term = term
+	} else if e.Term != term {
+		plog.Infof("%s term changed from %d to %d.", e.LeaderName, e.Term, term)
+		return false, nil
+	}
+	return true, nil
 }
 
-// isLeader query engine if we are the Leader.
-func (e *Election) isLeader() (bool, error) {
+// Epoch returns fencing token of current leadership.
+func (e *Election) Epoch() *database.Epoch {
+	return &database.Epoch{
+		Election: defaultElectionName,
+		Leader:   e.LeaderName,
+		Term:     e.Term,
+	}
+}
 
-	sql := `SELECT COUNT(*) FROM election_record where election_name=? and leader_name=?`
+// Validate fails if our term is not current or our lease has expired.
+func (e *Election) Validate() error {
+	valid, err := e.store.EpochValid(e.Epoch(), e.term())
+	if err != nil {
+		return err
+	} else if !valid {
+		return database.ErrStaleEpoch
+	}
+	return nil
+}
 
-	res, err := e.Engine.Query(sql, defaultElectionName, e.LeaderName)
+func (e *Election) Name() string {
+	return e.LeaderName
+}
 
+func (e *Election) Members() ([]*database.ElectionMember, error) {
+	members, err := e.store.ElectionMemberGetAll(defaultElectionName)
+	if err != nil {
+		return nil, err
+	}
+	record, err := e.store.ElectionGet(defaultElectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range members {
+		member.Leader = record != nil && record.LeaderName == member.Name &&
+			time.Since(record.LastUpdate) < e.term()
+		if member.Leader {
+			member.Address = record.Address
+		}
+	}
+	return members, nil
+}
+
+// recordMember saves a proclaim of member, newTerm means member has just
+// become the leader.
+func recordMember(store database.Store, name, address string, term int64, newTerm bool) {
+	now := time.Now()
+	member := &database.ElectionMember{
+		ElectionName: defaultElectionName,
+		Name:         name,
+		Address:      address,
+		LastProclaim: now,
+	}
+	if newTerm {
+		member.Term = term
+		member.TermStart = now
+	}
+	if err := store.ElectionMemberSave(member, newTerm); err != nil {
+		plog.Warning("Save election member failed: ", err)
+	}
+}
+
+// isLeader query engine if we are the Leader.
+func (e *Election) isLeader() (bool, error) {
+	record, err := e.store.ElectionGet(defaultElectionName)
 	if err != nil {
 		return false, err
 	}
 
-	if len(res) > 0 {
+	if record != nil && record.LeaderName == e.LeaderName {
 		return true, nil
 	} else {
 		return false, nil
@@ -95,8 +228,5 @@ func (e *Election) isLeader() (bool, error) {
 func (e *Election) Quit() error {
 	plog.Debug("quit election so that other node can become leader more quickly.")
 
-	sql := `DELETE FROM election_record where election_name=? and leader_name=?`
-	_, err := e.Engine.Exec(sql, defaultElectionName, e.LeaderName)
-
-	return err
+	return e.store.ElectionQuit(defaultElectionName, e.LeaderName)
 }
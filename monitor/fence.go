@@ -1,11 +1,19 @@
 package monitor
 
-import "themis/database"
+import (
+	"themis/config"
+	"themis/database"
+)
 
 type FencerInterface interface {
 	Fence() error
 }
 
-func NewFencer(fencer *database.HostFencer) FencerInterface {
-	return NewIPMIFencer(fencer)
+func NewFencer(fencer *database.HostFencer, cfg *config.FenceConfig) FencerInterface {
+	switch fencer.Type {
+	case "redfish":
+		return NewRedfishFencer(fencer, cfg)
+	default:
+		return NewIPMIFencer(fencer)
+	}
 }
@@ -0,0 +1,150 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"themis/config"
+	"themis/database"
+)
+
+const redfishSystems = "/redfish/v1/Systems"
+
+type redfishCollection struct {
+	Members []struct {
+		Id string `json:"@odata.id"`
+	} `json:"Members"`
+}
+
+type redfishSystem struct {
+	Actions struct {
+		Reset struct {
+			Target string `json:"target"`
+		} `json:"#ComputerSystem.Reset"`
+	} `json:"Actions"`
+}
+
+// RedfishFencer powers off host through Redfish API of its BMC.
+type RedfishFencer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	CAFile   string
+	Insecure bool
+}
+
+func NewRedfishFencer(fencer *database.HostFencer, cfg *config.FenceConfig) *RedfishFencer {
+	return &RedfishFencer{
+		Host:     fencer.Host,
+		Port:     fencer.Port,
+		Username: fencer.Username,
+		Password: fencer.Password,
+		CAFile:   cfg.RedfishCAFile,
+		Insecure: cfg.RedfishInsecure,
+	}
+}
+
+func (f *RedfishFencer) newClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: f.Insecure}
+	if !f.Insecure && len(f.CAFile) > 0 {
+		ca, err := ioutil.ReadFile(f.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		tlsConfig.RootCAs = pool
+	}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+func (f *RedfishFencer) request(client *http.Client, method, path string, body, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	url := "https://" + net.JoinHostPort(f.Host, strconv.Itoa(f.Port)) + path
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(f.Username, f.Password)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s failed with %d: %s", method, path, resp.StatusCode, data)
+	}
+	if result != nil && len(data) > 0 {
+		return json.Unmarshal(data, result)
+	}
+	return nil
+}
+
+// Fence forces off the only computer system managed by BMC.
+func (f *RedfishFencer) Fence() error {
+	client, err := f.newClient()
+	if err != nil {
+		plog.Warning("Redfish fencer failed to create client: ", err)
+		return err
+	}
+
+	var systems redfishCollection
+	if err := f.request(client, "GET", redfishSystems, nil, &systems); err != nil {
+		plog.Warning("Redfish fencer failed to connect BMC server: ", err)
+		return err
+	}
+	if len(systems.Members) != 1 {
+		err := fmt.Errorf("BMC %s manages %d systems, expect 1", f.Host, len(systems.Members))
+		plog.Warning("Redfish fencer failed to find system: ", err)
+		return err
+	}
+
+	var system redfishSystem
+	if err := f.request(client, "GET", systems.Members[0].Id, nil, &system); err != nil {
+		plog.Warning("Redfish fencer failed to get system: ", err)
+		return err
+	}
+	target := system.Actions.Reset.Target
+	if len(target) == 0 {
+		target = systems.Members[0].Id + "/Actions/ComputerSystem.Reset"
+	}
+
+	err = f.request(client, "POST", target, map[string]string{"ResetType": "ForceOff"}, nil)
+	if err != nil {
+		plog.Warning("Redfish fencer failed to set power down: ", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"themis/config"
+	"themis/database"
+)
+
+const (
+	HookPreFence     = "pre-fence"
+	HookPostFence    = "post-fence"
+	HookPreEvacuate  = "pre-evacuate"
+	HookPostEvacuate = "post-evacuate"
+
+	hookMustSucceed = "must-succeed"
+)
+
+// HookFencer describes the fencer used, credentials are never sent.
+type HookFencer struct {
+	Id       int    `json:"id"`
+	Type     string `json:"type"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+}
+
+// HookPayload is sent to hooks in JSON format.
+type HookPayload struct {
+	Phase     string                `json:"phase"`
+	Host      *database.Host        `json:"host"`
+	States    []*database.HostState `json:"states"`
+	Fencer    *HookFencer           `json:"fencer"`
+	Instances []string              `json:"instances"`
+}
+
+type Hook struct {
+	Phase       string
+	Type        string
+	Command     string
+	URL         string
+	Timeout     time.Duration
+	MustSucceed bool
+}
+
+func NewHooks(cfgs []config.HookConfig) map[string][]*Hook {
+	hooks := map[string][]*Hook{}
+	for _, cfg := range cfgs {
+		switch cfg.Phase {
+		case HookPreFence, HookPostFence, HookPreEvacuate, HookPostEvacuate:
+		default:
+			plog.Warningf("unsupported hook phase %s, ignore it.", cfg.Phase)
+			continue
+		}
+		if cfg.Type != "exec" && cfg.Type != "webhook" {
+			plog.Warningf("unsupported hook type %s, ignore it.", cfg.Type)
+			continue
+		}
+
+		timeout := time.Duration(cfg.Timeout) * time.Second
+		if timeout <= 0 {
+			timeout = defaultRecoveryTimeout * time.Second
+		}
+		hooks[cfg.Phase] = append(hooks[cfg.Phase], &Hook{
+			Phase:       cfg.Phase,
+			Type:        cfg.Type,
+			Command:     cfg.Command,
+			URL:         cfg.URL,
+			Timeout:     timeout,
+			MustSucceed: cfg.Policy == hookMustSucceed,
+		})
+	}
+	return hooks
+}
+
+func (h *Hook) Run(payload *HookPayload) error {
+	if h.Type == "webhook" {
+		return postJSON(h.URL, h.Timeout, payload)
+	}
+	return runCommand(h.Command, h.Timeout, payload.Host.Name, payload)
+}
+
+func (h *Hook) String() string {
+	if h.Type == "webhook" {
+		return fmt.Sprintf("%s hook %s", h.Phase, h.URL)
+	}
+	return fmt.Sprintf("%s hook %s", h.Phase, h.Command)
+}
+
+// runHooks executes all hooks of phase, it fails if any must-succeed hook fails.
+func (p *PolicyEngine) runHooks(phase string, payload *HookPayload) error {
+	payload.Phase = phase
+	for _, hook := range p.hooks[phase] {
+		plog.Infof("Execute %s on host %s", hook, payload.Host.Name)
+		if err := hook.Run(payload); err != nil {
+			if hook.MustSucceed {
+				return fmt.Errorf("%s failed: %s", hook, err)
+			}
+			plog.Warningf("%s failed, ignore it: %s", hook, err)
+		}
+	}
+	return nil
+}
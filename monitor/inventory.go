@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"themis/api"
+	"themis/config"
+	"themis/database"
+)
+
+// InventorySync mirrors nova compute nodes onto themis hosts.
+type InventorySync struct {
+	config *config.OpenstackConfig
+	store  database.Store
+	mutex  sync.Mutex
+}
+
+func NewInventorySync(config *config.OpenstackConfig, store database.Store) *InventorySync {
+	return &InventorySync{config: config, store: store}
+}
+
+func (s *InventorySync) SyncHosts(dryRun bool) (*api.HostSyncResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	nova, err := NewNovaClient(s.config)
+	if err != nil {
+		return nil, err
+	}
+	services, err := nova.ListComputeServices()
+	if err != nil {
+		return nil, err
+	}
+	hypervisors, err := nova.ListHypervisors()
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := s.store.HostGetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// only services backed by a hypervisor are real compute nodes
+	computeNodes := map[string]bool{}
+	for _, hypervisor := range hypervisors {
+		computeNodes[hypervisor.Service.Host] = true
+	}
+	existHosts := map[string]*database.Host{}
+	for _, host := range hosts {
+		existHosts[host.Name] = host
+	}
+
+	result := &api.HostSyncResult{DryRun: dryRun}
+	novaHosts := map[string]bool{}
+	for _, service := range services {
+		if service.Binary != "nova-compute" || !computeNodes[service.Host] {
+			continue
+		}
+		novaHosts[service.Host] = true
+		disabled := service.Status == "disabled"
+
+		host := existHosts[service.Host]
+		if host == nil {
+			host = &database.Host{
+				Name:           service.Host,
+				Status:         HostInitialStatus,
+				Disabled:       false,
+				UpdatedAt:      time.Now(),
+				NovaDisabled:   disabled,
+				NovaForcedDown: service.ForcedDown,
+			}
+			result.Changes = append(result.Changes, api.HostSyncChange{
+				Name:   host.Name,
+				Action: api.HostSyncCreate,
+				Detail: "new compute node",
+			})
+			if dryRun {
+				continue
+			}
+			if err := s.store.HostInsert(host); err != nil {
+				plog.Warning("Save host failed: ", err)
+			}
+			continue
+		}
+
+		if host.NovaDisabled == disabled && host.NovaForcedDown == service.ForcedDown && !host.Orphaned {
+			continue
+		}
+		result.Changes = append(result.Changes, api.HostSyncChange{
+			Name:   host.Name,
+			Action: api.HostSyncUpdate,
+			Detail: fmt.Sprintf("nova_disabled=%t nova_forced_down=%t orphaned=false",
+				disabled, service.ForcedDown),
+		})
+		if dryRun {
+			continue
+		}
+		host.NovaDisabled = disabled
+		host.NovaForcedDown = service.ForcedDown
+		host.Orphaned = false
+		err := s.store.HostUpdateFields(host, "nova_disabled", "nova_forced_down", "orphaned")
+		if err != nil {
+			plog.Warning("Update host failed: ", err)
+		}
+	}
+
+	for _, host := range hosts {
+		if novaHosts[host.Name] || host.Orphaned {
+			continue
+		}
+		result.Changes = append(result.Changes, api.HostSyncChange{
+			Name:   host.Name,
+			Action: api.HostSyncOrphan,
+			Detail: "removed from nova",
+		})
+		if dryRun {
+			continue
+		}
+		host.Orphaned = true
+		if err := s.store.HostUpdateFields(host, "orphaned"); err != nil {
+			plog.Warning("Update host failed: ", err)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,164 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"themis/api"
+	"themis/config"
+	"themis/database"
+)
+
+// fakeNova serves a keystone token with a compute endpoint, and nova
+// compute services and hypervisors listed by tests.
+type fakeNova struct {
+	*httptest.Server
+
+	services    []ComputeService
+	hypervisors []string
+}
+
+func newFakeNova(t *testing.T) *fakeNova {
+	n := &fakeNova{}
+	n.Server = httptest.NewServer(http.HandlerFunc(n.serve))
+	t.Cleanup(n.Close)
+	return n
+}
+
+func (n *fakeNova) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/v3/auth/tokens":
+		w.Header().Set("X-Subject-Token", "token")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"token": map[string]interface{}{
+			"catalog": []interface{}{map[string]interface{}{
+				"type": "compute",
+				"name": "nova",
+				"endpoints": []interface{}{map[string]string{
+					"interface": "public",
+					"region":    "RegionOne",
+					"region_id": "RegionOne",
+					"url":       n.URL + "/compute/",
+				}},
+			}},
+		}})
+	case "/compute/os-services":
+		json.NewEncoder(w).Encode(map[string]interface{}{"services": n.services})
+	case "/compute/os-hypervisors/detail":
+		hypervisors := make([]interface{}, 0, len(n.hypervisors))
+		for i, host := range n.hypervisors {
+			hypervisors = append(hypervisors, map[string]interface{}{
+				"id":                 i + 1,
+				"cpu_info":           "",
+				"hypervisor_version": 2012000,
+				"free_disk_gb":       100,
+				"local_gb":           100,
+				"service":            map[string]interface{}{"host": host, "id": i + 1},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"hypervisors": hypervisors})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestInventorySync(n *fakeNova, store database.Store) *InventorySync {
+	return NewInventorySync(&config.OpenstackConfig{
+		AuthURL:     n.URL + "/v3",
+		Username:    "themis",
+		Password:    "secret",
+		ProjectName: "service",
+		DomainName:  "Default",
+		RegionName:  "RegionOne",
+	}, store)
+}
+
+// syncHosts syncs hosts and returns changes as name:action.
+func syncHosts(t *testing.T, s *InventorySync, dryRun bool) string {
+	t.Helper()
+	result, err := s.SyncHosts(dryRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DryRun != dryRun {
+		t.Errorf("dry run is reported as %t", result.DryRun)
+	}
+	changes := make([]string, 0, len(result.Changes))
+	for _, c := range result.Changes {
+		changes = append(changes, c.Name+":"+c.Action)
+	}
+	return strings.Join(changes, ",")
+}
+
+func TestSyncHosts(t *testing.T) {
+	n := newFakeNova(t)
+	n.services = []ComputeService{
+		{Host: "node1", Binary: "nova-compute", Status: "enabled"},
+		{Host: "node2", Binary: "nova-compute", Status: "disabled", ForcedDown: true},
+		// services without a hypervisor are not compute nodes
+		{Host: "node3", Binary: "nova-compute", Status: "enabled"},
+	}
+	n.hypervisors = []string{"node1", "node2"}
+	store := database.NewMemoryStore()
+	s := newTestInventorySync(n, store)
+
+	if changes := syncHosts(t, s, true); changes != "node1:create,node2:create" {
+		t.Fatalf("unexpected dry run %s", changes)
+	}
+	if hosts, _ := store.HostGetAll(); len(hosts) != 0 {
+		t.Fatalf("hosts are created on dry run")
+	}
+
+	if changes := syncHosts(t, s, false); changes != "node1:create,node2:create" {
+		t.Fatalf("unexpected sync %s", changes)
+	}
+	host := checkHost(t, store, "node2", HostInitialStatus)
+	if !host.NovaDisabled || !host.NovaForcedDown || host.Orphaned || host.Disabled {
+		t.Errorf("nova state is not mirrored %+v", host)
+	}
+	if host, _ := store.HostGetByName("node3"); host != nil {
+		t.Errorf("service without hypervisor is synced")
+	}
+	if changes := syncHosts(t, s, false); changes != "" {
+		t.Errorf("sync again changes %s", changes)
+	}
+
+	// hosts missing from nova are flagged, never deleted
+	n.services = []ComputeService{{Host: "node2", Binary: "nova-compute", Status: "enabled"}}
+	n.hypervisors = []string{"node2"}
+	if changes := syncHosts(t, s, false); changes != "node2:"+api.HostSyncUpdate+",node1:"+api.HostSyncOrphan {
+		t.Fatalf("unexpected sync %s", changes)
+	}
+	if host := checkHost(t, store, "node1", HostInitialStatus); !host.Orphaned {
+		t.Errorf("host is not orphaned %+v", host)
+	}
+	if host := checkHost(t, store, "node2", HostInitialStatus); host.NovaDisabled || host.NovaForcedDown {
+		t.Errorf("nova state is not mirrored %+v", host)
+	}
+
+	// hosts back in nova are not orphaned anymore
+	n.services = append(n.services, ComputeService{Host: "node1", Binary: "nova-compute", Status: "enabled"})
+	n.hypervisors = append(n.hypervisors, "node1")
+	if changes := syncHosts(t, s, true); changes != "node1:update" {
+		t.Fatalf("unexpected dry run %s", changes)
+	}
+	if host := checkHost(t, store, "node1", HostInitialStatus); !host.Orphaned {
+		t.Errorf("host is updated on dry run")
+	}
+	syncHosts(t, s, false)
+	if host := checkHost(t, store, "node1", HostInitialStatus); host.Orphaned {
+		t.Errorf("host is still orphaned")
+	}
+}
+
+func TestSyncHostsNovaFailed(t *testing.T) {
+	n := newFakeNova(t)
+	n.Config.Handler = http.NotFoundHandler()
+	if _, err := newTestInventorySync(n, database.NewMemoryStore()).SyncHosts(false); err == nil {
+		t.Errorf("nova failure is not reported")
+	}
+}
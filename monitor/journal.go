@@ -0,0 +1,200 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"themis/config"
+	"themis/database"
+)
+
+const (
+	journalDateLayout           = "2006-01-02"
+	defaultJournalPurgeInterval = time.Hour
+)
+
+// Journal keeps all events received by the leader.
+type Journal interface {
+	// Append saves events received at t.
+	Append(t time.Time, events Events) error
+	// Read returns events received within [from, to] in order.
+	Read(from, to time.Time) ([]*database.JournalEvent, error)
+	// Purge deletes events received before t.
+	Purge(t time.Time) error
+}
+
+// NewJournal returns nil if journal is disabled.
+func NewJournal(cfg *config.JournalConfig) Journal {
+	switch cfg.Backend {
+	case "database":
+		return &dbJournal{}
+	case "file":
+		return &fileJournal{path: cfg.Path}
+	case "", "none":
+		return nil
+	default:
+		plog.Fatalf("unsupported journal backend %s", cfg.Backend)
+	}
+	return nil
+}
+
+func journalEvents(t time.Time, events Events) []*database.JournalEvent {
+	records := make([]*database.JournalEvent, 0, len(events))
+	for _, e := range events {
+		records = append(records, &database.JournalEvent{
+			Time:     t,
+			Hostname: e.Hostname,
+			Tag:      e.NetworkTag,
+			Status:   e.Status,
+		})
+	}
+	return records
+}
+
+type dbJournal struct{}
+
+func (j *dbJournal) Append(t time.Time, events Events) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return database.JournalAppend(journalEvents(t, events))
+}
+
+func (j *dbJournal) Read(from, to time.Time) ([]*database.JournalEvent, error) {
+	return database.JournalGetRange(from, to)
+}
+
+func (j *dbJournal) Purge(t time.Time) error {
+	return database.JournalPurge(t)
+}
+
+// fileJournal appends events as JSON lines to one file per day.
+type fileJournal struct {
+	path string
+}
+
+func (j *fileJournal) fileName(t time.Time) string {
+	return j.path + "." + t.Format(journalDateLayout)
+}
+
+// files returns all journal files and their dates in order.
+func (j *fileJournal) files() ([]string, []time.Time, error) {
+	matches, err := filepath.Glob(j.path + ".*")
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(matches)
+
+	names := make([]string, 0)
+	dates := make([]time.Time, 0)
+	for _, name := range matches {
+		date, err := time.ParseInLocation(journalDateLayout,
+			strings.TrimPrefix(name, j.path+"."), time.Local)
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+		dates = append(dates, date)
+	}
+	return names, dates, nil
+}
+
+func (j *fileJournal) Append(t time.Time, events Events) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(j.fileName(t), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, event := range journalEvents(t, events) {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func (j *fileJournal) Read(from, to time.Time) ([]*database.JournalEvent, error) {
+	names, dates, err := j.files()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*database.JournalEvent, 0)
+	for i, name := range names {
+		// skip files out of range
+		if dates[i].AddDate(0, 0, 1).Before(from) || dates[i].After(to) {
+			continue
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var event database.JournalEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				plog.Warningf("Skip broken journal line in %s: %s", name, err)
+				continue
+			}
+			if event.Time.Before(from) || event.Time.After(to) {
+				continue
+			}
+			events = append(events, &event)
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+func (j *fileJournal) Purge(t time.Time) error {
+	names, dates, err := j.files()
+	if err != nil {
+		return err
+	}
+
+	for i, name := range names {
+		// keep the file if any event in it may be newer than t
+		if !dates[i].AddDate(0, 0, 1).After(t) {
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// journalEvents appends events to journal and purges expired events.
+func (m *ThemisMonitor) journalEvents(events Events) {
+	if m.journal == nil {
+		return
+	}
+
+	now := time.Now()
+	if err := m.journal.Append(now, events); err != nil {
+		plog.Warning("Append events to journal failed: ", err)
+	}
+
+	retention := m.config.Journal.Retention
+	if retention > 0 && now.Sub(m.journalPurgedAt) >= defaultJournalPurgeInterval {
+		m.journalPurgedAt = now
+		if err := m.journal.Purge(now.AddDate(0, 0, -retention)); err != nil {
+			plog.Warning("Purge journal failed: ", err)
+		}
+	}
+}
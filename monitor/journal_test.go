@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"themis/config"
+	"themis/database"
+)
+
+// day returns noon of day in local time, so that events of a day stay in
+// one journal file.
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 12, 0, 0, 0, time.Local)
+}
+
+func journalSummary(events []*database.JournalEvent) string {
+	lines := make([]string, 0, len(events))
+	for _, e := range events {
+		lines = append(lines, e.Time.Format("01-02T15:04")+" "+e.Hostname+"/"+e.Tag+"="+e.Status)
+	}
+	return strings.Join(lines, ",")
+}
+
+func appendJournal(t *testing.T, j Journal, at time.Time, events Events) {
+	t.Helper()
+	if err := j.Append(at, events); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testJournal checks events are read in order within range and purged by day.
+func testJournal(t *testing.T, j Journal) {
+	day1, day2 := day(2024, 3, 1), day(2024, 3, 2)
+	appendJournal(t, j, day1, Events{{Hostname: "node1", NetworkTag: "network", Status: "failed"}})
+	appendJournal(t, j, day1.Add(time.Hour), Events{{Hostname: "node1", NetworkTag: "network", Status: "active"}})
+	appendJournal(t, j, day1.Add(2*time.Hour), Events{})
+	appendJournal(t, j, day2, Events{
+		{Hostname: "node1", NetworkTag: "manage", Status: "active"},
+		{Hostname: "node2", NetworkTag: "manage", Status: "failed"},
+	})
+
+	for _, c := range []struct {
+		from, to time.Time
+		expected string
+	}{
+		{day1.Add(-time.Hour), day2.Add(time.Hour),
+			"03-01T12:00 node1/network=failed,03-01T13:00 node1/network=active," +
+				"03-02T12:00 node1/manage=active,03-02T12:00 node2/manage=failed"},
+		{day1.Add(time.Minute), day2, "03-01T13:00 node1/network=active," +
+			"03-02T12:00 node1/manage=active,03-02T12:00 node2/manage=failed"},
+		{day1, day1.Add(time.Hour), "03-01T12:00 node1/network=failed,03-01T13:00 node1/network=active"},
+		{day2.Add(time.Minute), day2.Add(time.Hour), ""},
+	} {
+		events, err := j.Read(c.from, c.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary := journalSummary(events); summary != c.expected {
+			t.Errorf("events within [%s, %s] are %q", c.from, c.to, summary)
+		}
+	}
+
+	if err := j.Purge(day2.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	events, _ := j.Read(day1.Add(-time.Hour), day2.Add(time.Hour))
+	if summary := journalSummary(events); summary != "03-02T12:00 node1/manage=active,03-02T12:00 node2/manage=failed" {
+		t.Errorf("events after purge are %q", summary)
+	}
+}
+
+func TestFileJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events")
+	j := NewJournal(&config.JournalConfig{Backend: "file", Path: path})
+	testJournal(t, j)
+
+	// files are rotated daily, broken lines are skipped
+	matches, _ := filepath.Glob(path + ".*")
+	if len(matches) != 1 || matches[0] != path+".2024-03-02" {
+		t.Errorf("unexpected journal files %v", matches)
+	}
+	file, err := os.OpenFile(matches[0], os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("{broken\n")
+	file.Close()
+	ioutil.WriteFile(path+".notes", []byte("not a journal"), 0644)
+	appendJournal(t, j, day(2024, 3, 2).Add(time.Hour), Events{{Hostname: "node3", NetworkTag: "storage", Status: "active"}})
+	events, err := j.Read(day(2024, 3, 2), day(2024, 3, 3))
+	if err != nil || len(events) != 3 || events[2].Hostname != "node3" {
+		t.Errorf("unexpected events %q: %v", journalSummary(events), err)
+	}
+}
+
+func TestDatabaseJournal(t *testing.T) {
+	database.Engine(&config.DatabaseConfig{
+		Driver:      "sqlite3",
+		Path:        "file:" + filepath.Join(t.TempDir(), "themis.db") + "?_sync=OFF",
+		AutoMigrate: true,
+	})
+	t.Cleanup(func() { database.Close() })
+	testJournal(t, NewJournal(&config.JournalConfig{Backend: "database"}))
+}
+
+func TestJournalRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events")
+	old := time.Now().AddDate(0, 0, -3)
+	j := NewJournal(&config.JournalConfig{Backend: "file", Path: path})
+	appendJournal(t, j, old, Events{{Hostname: "node1", NetworkTag: "network", Status: "active"}})
+
+	cfg := config.NewDefaultConfig()
+	cfg.Journal = config.JournalConfig{Backend: "file", Path: path, Retention: 1}
+	m := &ThemisMonitor{config: cfg, journal: j}
+	m.journalEvents(Events{{Hostname: "node1", NetworkTag: "network", Status: "failed"}})
+
+	if _, err := os.Stat(j.(*fileJournal).fileName(old)); !os.IsNotExist(err) {
+		t.Errorf("expired journal file is kept: %v", err)
+	}
+	events, _ := j.Read(old.AddDate(0, 0, -1), time.Now())
+	if len(events) != 1 || events[0].Status != "failed" {
+		t.Errorf("unexpected events %q", journalSummary(events))
+	}
+
+	// purge runs at most once per interval
+	appendJournal(t, j, old, Events{{Hostname: "node1", NetworkTag: "network", Status: "active"}})
+	m.journalEvents(Events{})
+	if _, err := os.Stat(j.(*fileJournal).fileName(old)); err != nil {
+		t.Errorf("journal is purged again within interval: %v", err)
+	}
+}
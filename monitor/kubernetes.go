@@ -0,0 +1,212 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"themis/config"
+)
+
+const (
+	outOfServiceTaintKey    = "node.kubernetes.io/out-of-service"
+	outOfServiceTaintValue  = "nodeshutdown"
+	outOfServiceTaintEffect = "NoExecute"
+)
+
+type KubeTaint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
+type KubeNode struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Spec struct {
+		Taints []KubeTaint `json:"taints"`
+	} `json:"spec"`
+}
+
+type KubePod struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+}
+
+type KubeVolumeAttachment struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName string `json:"nodeName"`
+	} `json:"spec"`
+}
+
+// KubeClient talks to Kubernetes API server through plain REST calls.
+type KubeClient struct {
+	server string
+	token  string
+	client *http.Client
+}
+
+func NewKubeClient(cfg *config.KubernetesConfig) (*KubeClient, error) {
+	token := cfg.Token
+	if len(token) == 0 && len(cfg.TokenFile) > 0 {
+		data, err := ioutil.ReadFile(cfg.TokenFile)
+		if err != nil {
+			plog.Warning("Unable to read kubernetes token file", err)
+			return nil, err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+	if !cfg.Insecure && len(cfg.CAFile) > 0 {
+		ca, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			plog.Warning("Unable to read kubernetes CA file", err)
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		tlsConfig.RootCAs = pool
+	}
+
+	return &KubeClient{
+		server: strings.TrimSuffix(cfg.APIServer, "/"),
+		token:  token,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+func (k *KubeClient) request(method, path, contentType string, body, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, k.server+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if len(k.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+k.token)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s failed with %d: %s", method, path, resp.StatusCode, data)
+	}
+	if result != nil {
+		return json.Unmarshal(data, result)
+	}
+	return nil
+}
+
+func (k *KubeClient) GetNode(name string) (*KubeNode, error) {
+	var node KubeNode
+
+	path := "/api/v1/nodes/" + url.PathEscape(name)
+	if err := k.request("GET", path, "", nil, &node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// UpdateTaints replaces taints of node, resourceVersion guards concurrent updates.
+func (k *KubeClient) UpdateTaints(node *KubeNode, taints []KubeTaint) error {
+	if taints == nil {
+		taints = []KubeTaint{}
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": node.Metadata.ResourceVersion,
+		},
+		"spec": map[string]interface{}{
+			"taints": taints,
+		},
+	}
+	path := "/api/v1/nodes/" + url.PathEscape(node.Metadata.Name)
+	return k.request("PATCH", path, "application/merge-patch+json", patch, nil)
+}
+
+func (k *KubeClient) ListPods(nodeName string) ([]KubePod, error) {
+	var result struct {
+		Items []KubePod `json:"items"`
+	}
+
+	query := url.Values{}
+	query.Set("fieldSelector", "spec.nodeName="+nodeName)
+	if err := k.request("GET", "/api/v1/pods?"+query.Encode(), "", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// ForceDeletePod deletes pod immediately, it is safe only after node is fenced.
+func (k *KubeClient) ForceDeletePod(namespace, name string) error {
+	options := map[string]interface{}{
+		"kind":               "DeleteOptions",
+		"apiVersion":         "v1",
+		"gracePeriodSeconds": 0,
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s",
+		url.PathEscape(namespace), url.PathEscape(name))
+	return k.request("DELETE", path, "application/json", options, nil)
+}
+
+func (k *KubeClient) ListVolumeAttachments(nodeName string) ([]KubeVolumeAttachment, error) {
+	var result struct {
+		Items []KubeVolumeAttachment `json:"items"`
+	}
+
+	path := "/apis/storage.k8s.io/v1/volumeattachments"
+	if err := k.request("GET", path, "", nil, &result); err != nil {
+		return nil, err
+	}
+	attachments := make([]KubeVolumeAttachment, 0)
+	for _, attachment := range result.Items {
+		if attachment.Spec.NodeName == nodeName {
+			attachments = append(attachments, attachment)
+		}
+	}
+	return attachments, nil
+}
+
+func (k *KubeClient) DeleteVolumeAttachment(name string) error {
+	path := "/apis/storage.k8s.io/v1/volumeattachments/" + url.PathEscape(name)
+	return k.request("DELETE", path, "", nil, nil)
+}
@@ -19,7 +19,6 @@ import (
 )
 
 const (
-	defaultElectionProclaimInterval      = 6 * time.Second
 	defaultEventCollectionInterval       = 6 * time.Second
 	defaultEventCollectorMonitorInterval = 10 * time.Second
 )
@@ -31,9 +30,15 @@ type ThemisMonitor struct {
 	context         context.Context
 	cancelFunc      context.CancelFunc
 	waitGroup       sync.WaitGroup
-	election        *Election
+	election        Elector
+	raftNode        *RaftNode
 	policyEngine    *PolicyEngine
+	inventorySync   *InventorySync
 	eventCollectors []*EventCollector
+	stepDown        chan struct{}
+	resignedAt      time.Time
+	journal         Journal
+	journalPurgedAt time.Time
 }
 
 func NewThemisMonitor(config *config.ThemisConfig) *ThemisMonitor {
@@ -42,20 +47,74 @@ func NewThemisMonitor(config *config.ThemisConfig) *ThemisMonitor {
 		plog.Fatal(err)
 	}
 
-	engine := database.Engine(&config.Database)
-	election := NewElection(leaderName, engine)
+	store := newStore(config)
 
-	policyEngine := NewPolicyEngine(config)
+	var election Elector
+	var raftNode *RaftNode
+	if config.Raft.Enabled {
+		if len(config.Raft.NodeId) > 0 {
+			leaderName = config.Raft.NodeId
+		}
+		raftNode, err = NewRaftNode(&config.Raft, leaderName)
+		if err != nil {
+			plog.Fatal(err)
+		}
+		database.SetReplicator(raftNode)
+		election = NewRaftElection(raftNode, advertiseURL(config), store)
+	} else {
+		election = NewElection(leaderName, advertiseURL(config), &config.Election, store)
+	}
+
+	policyEngine := NewPolicyEngine(config, leaderName, store)
+
+	inventorySync := NewInventorySync(&config.Openstack, store)
+	api.RegisterHostSyncer(inventorySync)
+	api.RegisterStore(store)
+	api.RegisterGroups(recoveryGroups(config))
+	api.RegisterAuthenticators(NewAuthenticators(&config.Auth))
 
 	context, cancel := context.WithCancel(context.Background())
 
-	return &ThemisMonitor{
-		config:       config,
-		context:      context,
-		cancelFunc:   cancel,
-		election:     election,
-		policyEngine: policyEngine,
+	m := &ThemisMonitor{
+		config:        config,
+		context:       context,
+		cancelFunc:    cancel,
+		election:      election,
+		raftNode:      raftNode,
+		policyEngine:  policyEngine,
+		inventorySync: inventorySync,
+		stepDown:      make(chan struct{}, 1),
+		journal:       NewJournal(&config.Journal),
+	}
+	api.RegisterCluster(&clusterView{m: m})
+
+	return m
+}
+
+// newStore opens database, or keeps everything in memory if driver is
+// memory, which is only meant for labs.
+func newStore(config *config.ThemisConfig) database.Store {
+	if config.Database.Driver != "memory" {
+		database.Engine(&config.Database)
+		return database.NewSQLStore()
+	}
+
+	if config.Raft.Enabled {
+		plog.Fatal("Memory database can not be replicated by raft.")
+	}
+	if config.Journal.Backend == "database" {
+		plog.Fatal("Journal can not be saved to memory database.")
+	}
+	plog.Warning("Memory database is used, everything is lost on exit.")
+	return database.NewMemoryStore()
+}
+
+// advertiseURL returns URL other monitors use to reach our REST API.
+func advertiseURL(config *config.ThemisConfig) string {
+	if len(config.AdvertiseURL) > 0 {
+		return strings.TrimSuffix(config.AdvertiseURL, "/")
 	}
+	return fmt.Sprintf("http://%s:%d", config.BindHost, config.BindPort)
 }
 
 func (m *ThemisMonitor) Start() {
@@ -109,7 +168,7 @@ func startMonitoring(ctx context.Context, m *ThemisMonitor) {
 	m.waitGroup.Add(1)
 	defer m.waitGroup.Done()
 
-	leaderName := m.election.LeaderName
+	leaderName := m.election.Name()
 
 	for {
 	StartMonitoring:
@@ -143,6 +202,9 @@ func startMonitoring(ctx context.Context, m *ThemisMonitor) {
 		policyEngineCtx, _ := context.WithCancel(monitorCtx)
 		policyEngineErr := startPolicyEngine(policyEngineCtx, m)
 
+		// keep hosts in sync with nova compute nodes
+		startInventorySync(monitorCtx, m)
+
 		for {
 			select {
 			case err := <-IPMonitorErr:
@@ -197,7 +259,21 @@ func startIPMonitor(ctx context.Context, m *ThemisMonitor) <-chan error {
 func startCampaign(ctx context.Context, m *ThemisMonitor) <-chan error {
 	quit := make(chan error, 1)
 
-	leaderName := m.election.LeaderName
+	leaderName := m.election.Name()
+	proclaimInterval := time.Duration(m.config.Election.ProclaimInterval) * time.Second
+
+	// a leader who stepped down does not campaign for two terms, so that
+	// others can take over
+	holdOff := 2 * time.Duration(m.config.Election.Term) * time.Second
+	if wait := holdOff - time.Since(m.resignedAt); wait > 0 {
+		plog.Infof("%s stepped down, hold off campaign for %s.", leaderName, wait)
+		select {
+		case <-ctx.Done():
+			return quit
+		case <-time.After(wait):
+		}
+	}
+
 	electionErr := m.election.Campaign(ctx)
 	// wait until we become a leader or a error occour
 	select {
@@ -209,29 +285,51 @@ func startCampaign(ctx context.Context, m *ThemisMonitor) <-chan error {
 		plog.Infof("%s became leader.", leaderName)
 	}
 
+	// drop step down requested before this term
+	select {
+	case <-m.stepDown:
+	default:
+	}
+
 	go func() {
 		m.waitGroup.Add(1)
 		defer m.waitGroup.Done()
 
 		defer m.election.Quit()
+		// our lease in store lasts a term since the last successful proclaim
+		// started, others take over once it expires
+		term := time.Duration(m.config.Election.Term) * time.Second
+		lastProclaim := time.Now()
 		for {
 			select {
 			case <-ctx.Done():
 				plog.Info("Proclaim exiting: ", ctx.Err())
 				return
-			case <-time.After(defaultElectionProclaimInterval):
+			case <-m.stepDown:
+				plog.Infof("%s steps down.", leaderName)
+				m.resignedAt = time.Now()
+				quit <- errors.New("Leader stepped down.")
+				return
+			case <-time.After(proclaimInterval):
 			}
 			plog.Debugf("%s updating term.", leaderName)
+			proclaimAt := time.Now()
 			succ, err := m.election.Proclaim()
-			if err != nil {
-				plog.Info("update term failed: ", err)
-				quit <- err
+			if err != nil && time.Since(lastProclaim) >= term {
+				plog.Warningf("%s update term failed, lease has expired: %s", leaderName, err)
+				quit <- errors.New("Leader lease expired.")
 				return
+			} else if err != nil {
+				// store is unavailable, keep leading until our lease
+				// expires while policy engine suspends fencing
+				plog.Warning("update term failed: ", err)
+				continue
 			} else if !succ {
 				plog.Infof("%s proclaim failed, we are not leader now.", leaderName)
 				quit <- errors.New("Leader changed.")
 				return
 			}
+			lastProclaim = proclaimAt
 		}
 	}()
 
@@ -245,6 +343,11 @@ func startPolicyEngine(ctx context.Context, m *ThemisMonitor) <-chan error {
 		m.waitGroup.Add(1)
 		defer m.waitGroup.Done()
 
+		// guard all writes with epoch of our leadership, then roll
+		// forward operations interrupted by previous leader
+		m.policyEngine.SetElector(m.election)
+		m.policyEngine.ResumeOperations()
+
 		for {
 			// check if we should quit
 			select {
@@ -270,6 +373,7 @@ func startPolicyEngine(ctx context.Context, m *ThemisMonitor) <-chan error {
 					allEvents = append(allEvents, events...)
 				}
 			}
+			m.journalEvents(allEvents)
 			m.policyEngine.HandleEvents(allEvents)
 		}
 	}()
@@ -277,7 +381,45 @@ func startPolicyEngine(ctx context.Context, m *ThemisMonitor) <-chan error {
 	return quit
 }
 
+func startInventorySync(ctx context.Context, m *ThemisMonitor) {
+	interval := time.Duration(m.config.Openstack.SyncInterval) * time.Second
+	if interval <= 0 {
+		plog.Info("inventory sync is disabled.")
+		return
+	}
+
+	m.waitGroup.Add(1)
+	go func() {
+		defer m.waitGroup.Done()
+
+		for {
+			select {
+			case <-ctx.Done():
+				plog.Info("inventory sync exiting: ", ctx.Err())
+				return
+			case <-time.After(interval):
+			}
+
+			result, err := m.inventorySync.SyncHosts(false)
+			if err != nil {
+				plog.Warning("inventory sync failed: ", err)
+				continue
+			}
+			for _, change := range result.Changes {
+				plog.Infof("inventory sync %s host %s: %s",
+					change.Action, change.Name, change.Detail)
+			}
+		}
+	}()
+}
+
 func (m *ThemisMonitor) Stop() {
 	m.cancelFunc()
 	m.waitGroup.Wait()
+
+	if m.raftNode != nil {
+		if err := m.raftNode.Shutdown(); err != nil {
+			plog.Warningf("Shutdown raft failed: %s", err)
+		}
+	}
 }
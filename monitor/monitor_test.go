@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"themis/config"
+	"themis/database"
+)
+
+// fakeElector wins every campaign, its proclaims fail while fail returns true.
+type fakeElector struct {
+	mutex     sync.Mutex
+	fail      func(n int) bool
+	campaigns []time.Time
+	proclaims int
+	quits     int
+}
+
+func (e *fakeElector) Campaign(ctx context.Context) <-chan error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.campaigns = append(e.campaigns, time.Now())
+	return make(chan error, 1)
+}
+
+func (e *fakeElector) Proclaim() (bool, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.proclaims++
+	if e.fail(e.proclaims) {
+		return false, errors.New("store is unavailable")
+	}
+	return true, nil
+}
+
+func (e *fakeElector) Quit() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.quits++
+	return nil
+}
+
+func (e *fakeElector) Epoch() *database.Epoch { return nil }
+func (e *fakeElector) Validate() error        { return nil }
+func (e *fakeElector) Name() string           { return "monitor1" }
+
+func (e *fakeElector) Members() ([]*database.ElectionMember, error) {
+	return nil, nil
+}
+
+func newCampaignMonitor(elector Elector) *ThemisMonitor {
+	cfg := config.NewDefaultConfig()
+	cfg.Election = config.ElectionConfig{Term: 2, ProclaimInterval: 1}
+	return &ThemisMonitor{config: cfg, election: elector, stepDown: make(chan struct{}, 1)}
+}
+
+func TestCampaignLeaseExpired(t *testing.T) {
+	t.Parallel()
+	elector := &fakeElector{fail: func(n int) bool { return true }}
+	m := newCampaignMonitor(elector)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := time.Now()
+	select {
+	case err := <-startCampaign(ctx, m):
+		if elapsed := time.Since(started); elapsed < 2*time.Second {
+			t.Errorf("leader steps down after %s, before lease expires", elapsed)
+		}
+		if err.Error() != "Leader lease expired." {
+			t.Errorf("unexpected error %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("leader keeps leading after %d failed proclaims", elector.proclaims)
+	}
+	m.waitGroup.Wait()
+	if elector.quits != 1 {
+		t.Errorf("leader quits %d times", elector.quits)
+	}
+}
+
+func TestCampaignProclaimRetried(t *testing.T) {
+	t.Parallel()
+	// every other proclaim fails, lease is renewed before it expires
+	elector := &fakeElector{fail: func(n int) bool { return n%2 == 1 }}
+	m := newCampaignMonitor(elector)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	select {
+	case err := <-startCampaign(ctx, m):
+		t.Fatalf("leader steps down: %s", err)
+	case <-time.After(4500 * time.Millisecond):
+	}
+	cancel()
+	m.waitGroup.Wait()
+	if elector.proclaims < 4 {
+		t.Errorf("leader proclaims %d times", elector.proclaims)
+	}
+}
+
+func TestCampaignHoldOff(t *testing.T) {
+	t.Parallel()
+	elector := &fakeElector{fail: func(n int) bool { return false }}
+	m := newCampaignMonitor(elector)
+	m.config.Election.Term = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	quit := startCampaign(ctx, m)
+	if len(elector.campaigns) != 1 {
+		t.Fatalf("monitor campaigns %d times at start", len(elector.campaigns))
+	}
+	m.stepDown <- struct{}{}
+	select {
+	case err := <-quit:
+		if err.Error() != "Leader stepped down." {
+			t.Errorf("unexpected error %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("leader does not step down")
+	}
+	m.waitGroup.Wait()
+
+	// the monitor who stepped down lets others lead for two terms
+	holdOffCtx, holdOffCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	startCampaign(holdOffCtx, m)
+	holdOffCancel()
+	if len(elector.campaigns) != 1 {
+		t.Errorf("monitor campaigns again during hold off")
+	}
+	startCampaign(ctx, m)
+	if wait := elector.campaigns[1].Sub(m.resignedAt); wait < 2*time.Second {
+		t.Errorf("monitor campaigns again %s after it stepped down", wait)
+	}
+	cancel()
+	m.waitGroup.Wait()
+}
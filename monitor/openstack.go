@@ -4,6 +4,7 @@ import (
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/evacuate"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/hypervisors"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/services"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 
@@ -52,6 +53,45 @@ func (nova *NovaClient) ListServices() ([]services.Service, error) {
 	return services.ExtractServices(pages)
 }
 
+// ComputeService is a nova-compute service as returned by microversion 2.11,
+// which is the first one reporting forced_down.
+type ComputeService struct {
+	Host           string `json:"host"`
+	Binary         string `json:"binary"`
+	Status         string `json:"status"`
+	State          string `json:"state"`
+	ForcedDown     bool   `json:"forced_down"`
+	DisabledReason string `json:"disabled_reason"`
+}
+
+func (nova *NovaClient) ListComputeServices() ([]ComputeService, error) {
+	var result struct {
+		Services []ComputeService `json:"services"`
+	}
+
+	url := nova.client.ServiceURL("os-services") + "?binary=nova-compute"
+	requestOpts := &gophercloud.RequestOpts{
+		MoreHeaders: map[string]string{
+			"X-OpenStack-Nova-API-Version": "2.11",
+		},
+	}
+	_, err := nova.client.Get(url, &result, requestOpts)
+	if err != nil {
+		plog.Warning("Can't list compute services", err)
+		return nil, err
+	}
+	return result.Services, nil
+}
+
+func (nova *NovaClient) ListHypervisors() ([]hypervisors.Hypervisor, error) {
+	pages, err := hypervisors.List(nova.client).AllPages()
+	if err != nil {
+		plog.Warning("Can't list hypervisors", err)
+		return nil, err
+	}
+	return hypervisors.ExtractHypervisors(pages)
+}
+
 type ServiceUpdateOpts struct {
 	// The name of the host.
 	Host string `json:"host"`
@@ -0,0 +1,368 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+
+	"themis/database"
+)
+
+const (
+	OperationFence = "fence"
+
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+	OperationAborted   = "aborted"
+
+	StepPending   = "pending"
+	StepRunning   = "running"
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"
+
+	stepTypeHook  = "hook"
+	stepTypeFence = "fence"
+)
+
+var (
+	ErrNoFencerSucceeded = errors.New("no fencer succeeded.")
+)
+
+// operationContext is rebuilt from database when an operation is resumed.
+type operationContext struct {
+	op      *database.Operation
+	host    *database.Host
+	states  []*database.HostState
+	payload *HookPayload
+	rc      *RecoveryContext
+}
+
+type operationStep struct {
+	name string
+	kind string
+	// abort the operation if step fails, otherwise just roll forward.
+	abortOnFailure bool
+	execute        func(oc *operationContext) error
+}
+
+// planFence returns ordered steps of fence operation for host.
+func (p *PolicyEngine) planFence(host *database.Host) []*operationStep {
+	steps := make([]*operationStep, 0)
+
+	// only pre-fence hooks may stop the operation, once host is powered off
+	// it must be recovered whatever later hooks say.
+	hookStep := func(phase string) {
+		if len(p.hooks[phase]) == 0 {
+			return
+		}
+		steps = append(steps, &operationStep{
+			name:           phase,
+			kind:           stepTypeHook,
+			abortOnFailure: phase == HookPreFence,
+			execute: func(oc *operationContext) error {
+				oc.payload.Instances = oc.rc.Instances
+				return p.runHooks(phase, oc.payload)
+			},
+		})
+	}
+
+	hookStep(HookPreFence)
+	// never recover a host which may still be running
+	steps = append(steps, &operationStep{
+		name:           "power-off",
+		kind:           stepTypeFence,
+		abortOnFailure: true,
+		execute:        p.powerOff,
+	})
+	hookStep(HookPostFence)
+	hookStep(HookPreEvacuate)
+	_, actions := p.getPipeline(host)
+	for _, action := range actions {
+		action := action
+		steps = append(steps, &operationStep{
+			name: action.Name(),
+			kind: action.Type(),
+			execute: func(oc *operationContext) error {
+				err := action.Execute(oc.rc)
+				if len(oc.rc.Instances) > 0 {
+					oc.op.Instances = oc.rc.Instances
+					p.db.OperationUpdateFields(oc.op, "instances")
+				}
+				return err
+			},
+		})
+	}
+	hookStep(HookPostEvacuate)
+
+	return steps
+}
+
+// powerOff marks host as fencing and powers it off through its fencers.
+func (p *PolicyEngine) powerOff(oc *operationContext) error {
+	host := oc.host
+	p.transitHost(host, HostFencingStatus,
+		fmt.Sprintf("fence operation %d powers off host", oc.op.Id), oc.states)
+
+	fencers, err := p.store.FencerGetByHost(host.Id)
+	if err != nil || len(fencers) < 1 {
+		plog.Warning("Can't find fencers with given host: ", host.Name)
+		return fmt.Errorf("can't find fencers of host %s", host.Name)
+	}
+
+	plog.Debug("Begin execute fence operation")
+	for _, fencer := range fencers {
+		// never power off a host on behalf of a stale leader
+		if err := p.checkEpoch(); err != nil {
+			return err
+		}
+		if err := NewFencer(fencer, &p.config.Fence).Fence(); err != nil {
+			plog.Warningf("Fence operation failed on host %s", host.Name)
+			continue
+		}
+		plog.Infof("Fence operation successed on host: %s", host.Name)
+		oc.payload.Fencer = newHookFencer(fencer)
+		oc.op.FencerId = fencer.Id
+		p.db.OperationUpdateFields(oc.op, "fencer_id")
+		return nil
+	}
+	return ErrNoFencerSucceeded
+}
+
+func newHookFencer(fencer *database.HostFencer) *HookFencer {
+	return &HookFencer{
+		Id:       fencer.Id,
+		Type:     fencer.Type,
+		Host:     fencer.Host,
+		Port:     fencer.Port,
+		Username: fencer.Username,
+	}
+}
+
+func (p *PolicyEngine) fenceHost(host *database.Host, states []*database.HostState) {
+	defer func() {
+		if err := recover(); err != nil {
+			plog.Warning("unexpected error during HandleEvents: ", err)
+		}
+	}()
+
+	// check if we have disabled fence operation globally
+	if p.config.Fence.DisableFenceOps {
+		plog.Info("fence operation have been disabled.")
+		return
+	}
+
+	if p.dryRun {
+		p.transitHost(host, HostFencingStatus, "dry run: host would be fenced", states)
+		return
+	}
+
+	// back off for a while if last fence operation was aborted by hooks
+	latest, err := p.store.OperationGetLatest(host.Id)
+	if err != nil {
+		plog.Warning("Can't get latest operation: ", err)
+		return
+	} else if latest != nil && latest.Status == OperationAborted &&
+		p.now().Sub(latest.UpdatedAt).Seconds() < stateTransitionInterval {
+		plog.Debugf("last fence operation on host %s was aborted, retry later.", host.Name)
+		return
+	}
+
+	group, _ := p.getPipeline(host)
+	plan := p.planFence(host)
+	now := p.now()
+	op := &database.Operation{
+		HostId:     host.Id,
+		HostName:   host.Name,
+		Group:      group,
+		Type:       OperationFence,
+		Status:     OperationRunning,
+		LeaderName: p.leaderName,
+		Instances:  []string{},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	steps := make([]*database.OperationStep, 0, len(plan))
+	for seq, s := range plan {
+		steps = append(steps, &database.OperationStep{
+			Seq:    seq,
+			Name:   s.name,
+			Type:   s.kind,
+			Status: StepPending,
+		})
+	}
+	if err := p.db.OperationInsert(op, steps); err != nil {
+		plog.Warning("Save fence operation failed: ", err)
+		return
+	}
+
+	plog.Infof("Begin fence host %s", host.Name)
+	oc := &operationContext{
+		op:      op,
+		host:    host,
+		states:  states,
+		payload: &HookPayload{Host: host, States: states},
+		rc:      &RecoveryContext{Host: host, States: states},
+	}
+	p.runOperation(oc, plan, steps)
+}
+
+// runOperation executes all unfinished steps of operation in order. Steps
+// are matched with plan by their sequences, names of steps are not unique.
+func (p *PolicyEngine) runOperation(oc *operationContext, plan []*operationStep, steps []*database.OperationStep) {
+	failed := false
+	poweredOff := false
+	for _, step := range steps {
+		var s *operationStep
+		if step.Seq >= 0 && step.Seq < len(plan) &&
+			plan[step.Seq].name == step.Name && plan[step.Seq].kind == step.Type {
+			s = plan[step.Seq]
+		}
+
+		if step.Status == StepFailed {
+			// previous leader failed it but stopped before aborting
+			if s != nil && s.abortOnFailure {
+				p.abortOperation(oc, step.Message)
+				return
+			}
+			failed = true
+			continue
+		} else if step.Status == StepSucceeded || step.Status == StepSkipped {
+			poweredOff = poweredOff || (step.Type == stepTypeFence && step.Status == StepSucceeded)
+			continue
+		}
+
+		// stop at once if we are not the leader anymore, the new leader
+		// will resume the operation.
+		if err := p.checkEpoch(); err != nil {
+			plog.Warningf("Stop operation %d on host %s: %s", oc.op.Id, oc.host.Name, err)
+			return
+		}
+
+		if s == nil {
+			step.Status = StepSkipped
+			step.Message = "step is not configured anymore."
+			p.db.OperationStepUpdateFields(step, "status", "message")
+			continue
+		}
+
+		plog.Infof("Execute step %s of operation %d on host %s", step.Name, oc.op.Id, oc.host.Name)
+		step.Status = StepRunning
+		step.StartedAt = p.now()
+		p.db.OperationStepUpdateFields(step, "status", "started_at")
+
+		err := s.execute(oc)
+		step.FinishedAt = p.now()
+		if err != nil {
+			plog.Warningf("Step %s failed on host %s: %s", step.Name, oc.host.Name, err)
+			step.Status = StepFailed
+			step.Message = err.Error()
+			failed = true
+		} else {
+			step.Status = StepSucceeded
+			poweredOff = poweredOff || s.kind == stepTypeFence
+		}
+		p.db.OperationStepUpdateFields(step, "status", "message", "finished_at")
+
+		if err != nil && s.abortOnFailure {
+			plog.Warningf("Abort fence host %s: %s", oc.host.Name, err)
+			p.abortOperation(oc, err.Error())
+			return
+		}
+	}
+
+	// host is fenced only if it is powered off
+	if !poweredOff {
+		plog.Warningf("Abort fence host %s: host is not powered off", oc.host.Name)
+		p.abortOperation(oc, "host is not powered off.")
+		return
+	}
+
+	// disable host status
+	oc.host.Disabled = true
+	p.transitHost(oc.host, HostFencedStatus,
+		fmt.Sprintf("fence operation %d finished", oc.op.Id), oc.states)
+
+	if failed {
+		p.finishOperation(oc, OperationFailed, "some steps failed.")
+	} else {
+		p.finishOperation(oc, OperationSucceeded, "")
+	}
+}
+
+// abortOperation aborts operation before host is powered off, host goes
+// back to failed so that it is fenced again once the backoff passes.
+func (p *PolicyEngine) abortOperation(oc *operationContext, message string) {
+	p.finishOperation(oc, OperationAborted, message)
+	if oc.host.Status == HostFencingStatus {
+		p.transitHost(oc.host, HostFailedStatus,
+			fmt.Sprintf("fence operation %d aborted: %s", oc.op.Id, message), oc.states)
+	}
+}
+
+func (p *PolicyEngine) finishOperation(oc *operationContext, status, message string) {
+	oc.op.Status = status
+	oc.op.Message = message
+	oc.op.UpdatedAt = p.now()
+	if err := p.db.OperationUpdateFields(oc.op, "status", "message", "updated_at"); err != nil {
+		plog.Warning("Save operation failed: ", err)
+	}
+}
+
+// ResumeOperations rolls forward operations interrupted by a previous leader.
+func (p *PolicyEngine) ResumeOperations() {
+	ops, err := p.store.OperationGetAll(0, OperationRunning)
+	if err != nil {
+		plog.Warning("Can't get running operations: ", err)
+		return
+	}
+
+	for _, op := range ops {
+		p.resumeOperation(op)
+	}
+}
+
+func (p *PolicyEngine) resumeOperation(op *database.Operation) {
+	defer func() {
+		if err := recover(); err != nil {
+			plog.Warning("unexpected error during resume operation: ", err)
+		}
+	}()
+
+	plog.Infof("Resume operation %d on host %s started by %s", op.Id, op.HostName, op.LeaderName)
+	oc := &operationContext{op: op}
+
+	host, err := p.store.HostGetById(op.HostId)
+	if err != nil {
+		plog.Warning("Can't get host: ", err)
+		return
+	} else if host == nil {
+		p.finishOperation(oc, OperationAborted, "host has been deleted.")
+		return
+	}
+	oc.host = host
+
+	states, err := p.store.StateGetAll(host.Id)
+	if err != nil {
+		plog.Warning("Can't find Host states")
+		return
+	}
+	steps, err := p.store.OperationStepGetAll(op.Id)
+	if err != nil {
+		plog.Warning("Can't get operation steps: ", err)
+		return
+	}
+
+	oc.states = states
+	oc.payload = &HookPayload{Host: host, States: states, Instances: op.Instances}
+	oc.rc = &RecoveryContext{Host: host, States: states, Instances: op.Instances}
+	if op.FencerId > 0 {
+		if fencer, err := p.store.FencerGetById(op.FencerId); err == nil && fencer != nil {
+			oc.payload.Fencer = newHookFencer(fencer)
+		}
+	}
+
+	op.LeaderName = p.leaderName
+	p.db.OperationUpdateFields(op, "leader_name")
+	p.runOperation(oc, p.planFence(host), steps)
+}
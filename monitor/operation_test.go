@@ -0,0 +1,459 @@
+package monitor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"themis/config"
+	"themis/database"
+)
+
+// fakeBMC serves Redfish API of a BMC managing one system.
+type fakeBMC struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	resetErr bool
+	resets   int
+}
+
+func newFakeBMC(t *testing.T) *fakeBMC {
+	b := &fakeBMC{}
+	b.Server = httptest.NewTLSServer(http.HandlerFunc(b.serve))
+	t.Cleanup(b.Close)
+	return b
+}
+
+func (b *fakeBMC) serve(w http.ResponseWriter, r *http.Request) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch {
+	case r.URL.Path == redfishSystems:
+		w.Write([]byte(`{"Members":[{"@odata.id":"/redfish/v1/Systems/1"}]}`))
+	case r.URL.Path == "/redfish/v1/Systems/1":
+		w.Write([]byte(`{}`))
+	case r.Method == "POST" && r.URL.Path == "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset":
+		if b.resetErr {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		b.resets++
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (b *fakeBMC) fencer(hostId int) *database.HostFencer {
+	host, port, _ := net.SplitHostPort(b.Listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	return &database.HostFencer{HostId: hostId, Type: "redfish", Host: host, Port: portNum}
+}
+
+// newScriptPolicyEngine returns policy engine whose recovery steps are
+// unnamed scripts appending their names to a file.
+func newScriptPolicyEngine(t *testing.T, store database.Store, names ...string) (*PolicyEngine, string) {
+	output := filepath.Join(t.TempDir(), "steps")
+	steps := make([]config.RecoveryStepConfig, 0)
+	for _, name := range names {
+		steps = append(steps, config.RecoveryStepConfig{Type: "script", Command: "echo " + name + " >> " + output})
+	}
+
+	cfg := config.NewDefaultConfig()
+	cfg.Fence.RedfishInsecure = true
+	cfg.Recovery = map[string]config.RecoveryConfig{
+		defaultRecoveryGroup: {Steps: steps},
+	}
+	return NewPolicyEngine(cfg, "monitor1", store), output
+}
+
+func readOutput(output string) string {
+	data, _ := ioutil.ReadFile(output)
+	return string(data)
+}
+
+func insertFailedHost(t *testing.T, store database.Store) *database.Host {
+	host := &database.Host{Name: "node1", Status: HostFailedStatus, UpdatedAt: time.Now()}
+	if err := store.HostInsert(host); err != nil {
+		t.Fatal(err)
+	}
+	return host
+}
+
+func latestOperation(t *testing.T, store database.Store, hostId int) (*database.Operation, []*database.OperationStep) {
+	op, err := store.OperationGetLatest(hostId)
+	if err != nil || op == nil {
+		t.Fatalf("no operation is found: %v", err)
+	}
+	steps, err := store.OperationStepGetAll(op.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return op, steps
+}
+
+// checkNotFenced checks that operation is aborted without recovering host,
+// and host is failed again to be fenced later.
+func checkNotFenced(t *testing.T, store database.Store, host *database.Host, output string) {
+	op, steps := latestOperation(t, store, host.Id)
+	if op.Status != OperationAborted {
+		t.Errorf("operation is %s, not aborted", op.Status)
+	}
+	if steps[0].Name != "power-off" || steps[0].Status != StepFailed {
+		t.Errorf("power-off step is %s", steps[0].Status)
+	}
+	for _, step := range steps[1:] {
+		if step.Status != StepPending {
+			t.Errorf("step %d is %s after power-off failed", step.Seq, step.Status)
+		}
+	}
+	if out := readOutput(output); len(out) > 0 {
+		t.Errorf("recovery steps are executed: %q", out)
+	}
+
+	saved, _ := store.HostGetById(host.Id)
+	if saved.Status != HostFailedStatus || saved.Disabled {
+		t.Errorf("host is %s, disabled %v", saved.Status, saved.Disabled)
+	}
+}
+
+func TestFenceHostWithoutFencers(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, output := newScriptPolicyEngine(t, store, "one")
+	host := insertFailedHost(t, store)
+
+	p.fenceHost(host, nil)
+	checkNotFenced(t, store, host, output)
+}
+
+func TestFenceHostFencersFailed(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, output := newScriptPolicyEngine(t, store, "one")
+	host := insertFailedHost(t, store)
+	bmc := newFakeBMC(t)
+	bmc.resetErr = true
+	if err := store.FencerInsert(bmc.fencer(host.Id)); err != nil {
+		t.Fatal(err)
+	}
+
+	p.fenceHost(host, nil)
+	checkNotFenced(t, store, host, output)
+}
+
+func TestFenceHostUnnamedSteps(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, output := newScriptPolicyEngine(t, store, "one", "two")
+	host := insertFailedHost(t, store)
+	bmc := newFakeBMC(t)
+	if err := store.FencerInsert(bmc.fencer(host.Id)); err != nil {
+		t.Fatal(err)
+	}
+
+	p.fenceHost(host, nil)
+	op, steps := latestOperation(t, store, host.Id)
+	if op.Status != OperationSucceeded {
+		t.Errorf("operation is %s: %s", op.Status, op.Message)
+	}
+	for _, step := range steps {
+		if step.Status != StepSucceeded {
+			t.Errorf("step %d %s is %s", step.Seq, step.Name, step.Status)
+		}
+	}
+	if bmc.resets != 1 {
+		t.Errorf("host is reset %d times", bmc.resets)
+	}
+	if out := readOutput(output); out != "one\ntwo\n" {
+		t.Errorf("unexpected steps executed: %q", out)
+	}
+
+	saved, _ := store.HostGetById(host.Id)
+	if saved.Status != HostFencedStatus || !saved.Disabled {
+		t.Errorf("host is %s, disabled %v", saved.Status, saved.Disabled)
+	}
+}
+
+// insertOperation saves a running operation of host, whose steps are
+// planned by p and have statuses.
+func insertOperation(t *testing.T, p *PolicyEngine, host *database.Host, statuses ...string) *database.Operation {
+	op := &database.Operation{
+		HostId:    host.Id,
+		HostName:  host.Name,
+		Type:      OperationFence,
+		Status:    OperationRunning,
+		Instances: []string{},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	steps := make([]*database.OperationStep, 0)
+	for seq, s := range p.planFence(host) {
+		steps = append(steps, &database.OperationStep{Seq: seq, Name: s.name, Type: s.kind, Status: statuses[seq]})
+	}
+	if err := p.store.Guard(nil).OperationInsert(op, steps); err != nil {
+		t.Fatal(err)
+	}
+	return op
+}
+
+func TestResumeOperationUnnamedSteps(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, output := newScriptPolicyEngine(t, store, "one", "two")
+	host := insertFailedHost(t, store)
+	host.Status = HostFencingStatus
+	store.HostUpdateFields(host, "status")
+	insertOperation(t, p, host, StepSucceeded, StepSucceeded, StepPending)
+
+	p.ResumeOperations()
+	op, steps := latestOperation(t, store, host.Id)
+	if op.Status != OperationSucceeded {
+		t.Errorf("operation is %s: %s", op.Status, op.Message)
+	}
+	if steps[2].Status != StepSucceeded {
+		t.Errorf("last step is %s", steps[2].Status)
+	}
+	if out := readOutput(output); out != "two\n" {
+		t.Errorf("unexpected steps executed: %q", out)
+	}
+	saved, _ := store.HostGetById(host.Id)
+	if saved.Status != HostFencedStatus || !saved.Disabled {
+		t.Errorf("host is %s, disabled %v", saved.Status, saved.Disabled)
+	}
+}
+
+func TestResumeOperationPowerOffFailed(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, output := newScriptPolicyEngine(t, store, "one")
+	host := insertFailedHost(t, store)
+	insertOperation(t, p, host, StepFailed, StepPending)
+
+	p.ResumeOperations()
+	checkNotFenced(t, store, host, output)
+}
+
+func TestFenceHostRetried(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, output := newScriptPolicyEngine(t, store, "one")
+	clock := &policyClock{now: time.Now()}
+	p.clock = func() time.Time { return clock.now }
+	host := activateHost(t, p, clock, "node1")
+	bmc := newFakeBMC(t)
+	bmc.resetErr = true
+	if err := store.FencerInsert(bmc.fencer(host.Id)); err != nil {
+		t.Fatal(err)
+	}
+
+	failHost(p, clock, "node1")
+	checkNotFenced(t, store, host, output)
+	aborted, _ := latestOperation(t, store, host.Id)
+
+	// fencing backs off for a while after it is aborted
+	clock.advance(stateTransitionInterval - 1)
+	p.HandleEvents(tagEvents("node1", "network"))
+	if op, _ := latestOperation(t, store, host.Id); op.Id != aborted.Id {
+		t.Fatalf("host is fenced again by operation %d before backoff passes", op.Id)
+	}
+	checkHost(t, store, "node1", HostFailedStatus)
+
+	bmc.mutex.Lock()
+	bmc.resetErr = false
+	bmc.mutex.Unlock()
+	clock.advance(1)
+	p.HandleEvents(tagEvents("node1", "network"))
+	op, _ := latestOperation(t, store, host.Id)
+	if op.Id == aborted.Id || op.Status != OperationSucceeded {
+		t.Errorf("operation %d is %s: %s", op.Id, op.Status, op.Message)
+	}
+	if saved := checkHost(t, store, "node1", HostFencedStatus); !saved.Disabled {
+		t.Errorf("fenced host is not disabled")
+	}
+	if bmc.resets != 1 || readOutput(output) != "one\n" {
+		t.Errorf("host is reset %d times, steps executed: %q", bmc.resets, readOutput(output))
+	}
+
+	histories, _ := store.HostHistoryGetAll(host.Id)
+	var statuses []string
+	for i := len(histories) - 1; i >= 0; i-- {
+		statuses = append(statuses, histories[i].NewStatus)
+	}
+	if strings.Join(statuses, ",") != "active,checking,failed,fencing,failed,fencing,fenced" {
+		t.Errorf("unexpected transitions %v", statuses)
+	}
+}
+
+func testPayload() *HookPayload {
+	return &HookPayload{Host: &database.Host{Name: "node1"}, Instances: []string{"vm1"}}
+}
+
+func TestHookExec(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "payload")
+	hooks := NewHooks([]config.HookConfig{
+		{Phase: HookPostFence, Type: "exec", Command: "cat > " + output + "; echo $THEMIS_HOST > " + output + ".host"},
+		{Phase: "post-recover", Type: "exec", Command: "true"},
+		{Phase: HookPostFence, Type: "ssh", Command: "true"},
+	})
+	if len(hooks) != 1 || len(hooks[HookPostFence]) != 1 {
+		t.Fatalf("unexpected hooks %v", hooks)
+	}
+	hook := hooks[HookPostFence][0]
+	if hook.Timeout != defaultRecoveryTimeout*time.Second || hook.MustSucceed {
+		t.Errorf("unexpected hook %+v", hook)
+	}
+
+	payload := testPayload()
+	payload.Phase = HookPostFence
+	if err := hook.Run(payload); err != nil {
+		t.Fatal(err)
+	}
+	var got HookPayload
+	if err := json.Unmarshal([]byte(readOutput(output)), &got); err != nil {
+		t.Fatalf("unexpected payload %q: %s", readOutput(output), err)
+	}
+	if got.Phase != HookPostFence || got.Host.Name != "node1" || len(got.Instances) != 1 {
+		t.Errorf("unexpected payload %+v", got)
+	}
+	if host := readOutput(output + ".host"); host != "node1\n" {
+		t.Errorf("THEMIS_HOST is %q", host)
+	}
+}
+
+func TestHookWebhook(t *testing.T) {
+	var mutex sync.Mutex
+	phases := []string{}
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		var payload HookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		phases = append(phases, payload.Phase)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	hook := NewHooks([]config.HookConfig{{Phase: HookPreFence, Type: "webhook", URL: server.URL}})[HookPreFence][0]
+	payload := testPayload()
+	payload.Phase = HookPreFence
+	if err := hook.Run(payload); err != nil {
+		t.Fatal(err)
+	}
+	mutex.Lock()
+	status = http.StatusInternalServerError
+	mutex.Unlock()
+	if err := hook.Run(payload); err == nil {
+		t.Errorf("failed webhook is not reported")
+	}
+	if strings.Join(phases, ",") != "pre-fence,pre-fence" {
+		t.Errorf("unexpected payloads %v", phases)
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	hook := &Hook{Phase: HookPreFence, Type: "exec", Command: "sleep 5", Timeout: 100 * time.Millisecond}
+	started := time.Now()
+	err := hook.Run(testPayload())
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("hook runs %s after timeout", elapsed)
+	}
+}
+
+func TestRunHooksPolicy(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "hooks")
+	p := NewPolicyEngine(config.NewDefaultConfig(), "monitor1", database.NewMemoryStore())
+	p.hooks = NewHooks([]config.HookConfig{
+		{Phase: HookPreFence, Type: "exec", Command: "echo one >> " + output + "; false"},
+		{Phase: HookPreFence, Type: "exec", Command: "echo two >> " + output + "; false", Policy: hookMustSucceed},
+		{Phase: HookPreFence, Type: "exec", Command: "echo three >> " + output},
+	})
+
+	// best-effort hooks fail quietly, must-succeed ones stop the phase
+	if err := p.runHooks(HookPreFence, testPayload()); err == nil {
+		t.Errorf("must-succeed hook failure is not reported")
+	}
+	if out := readOutput(output); out != "one\ntwo\n" {
+		t.Errorf("unexpected hooks executed: %q", out)
+	}
+	if err := p.runHooks(HookPostFence, testPayload()); err != nil {
+		t.Errorf("phase without hooks fails: %s", err)
+	}
+}
+
+// newHookPolicyEngine returns script policy engine with a must-succeed
+// hook of phase which always fails.
+func newHookPolicyEngine(t *testing.T, store database.Store, phase string) (*PolicyEngine, string) {
+	p, output := newScriptPolicyEngine(t, store, "one")
+	p.hooks = NewHooks([]config.HookConfig{
+		{Phase: phase, Type: "exec", Command: "echo " + phase + " >> " + output + "; false", Policy: hookMustSucceed},
+	})
+	return p, output
+}
+
+func TestFenceHostPreFenceHookFailed(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, output := newHookPolicyEngine(t, store, HookPreFence)
+	host := insertFailedHost(t, store)
+	bmc := newFakeBMC(t)
+	if err := store.FencerInsert(bmc.fencer(host.Id)); err != nil {
+		t.Fatal(err)
+	}
+
+	p.fenceHost(host, nil)
+	op, steps := latestOperation(t, store, host.Id)
+	if op.Status != OperationAborted || steps[0].Status != StepFailed {
+		t.Errorf("operation is %s, pre-fence hook is %s", op.Status, steps[0].Status)
+	}
+	for _, step := range steps[1:] {
+		if step.Status != StepPending {
+			t.Errorf("step %s is %s after pre-fence hook failed", step.Name, step.Status)
+		}
+	}
+	if bmc.resets != 0 || readOutput(output) != "pre-fence\n" {
+		t.Errorf("host is reset %d times, steps executed: %q", bmc.resets, readOutput(output))
+	}
+	checkHost(t, store, "node1", HostFailedStatus)
+}
+
+func TestFenceHostLaterHooksFailed(t *testing.T) {
+	for _, phase := range []string{HookPostFence, HookPreEvacuate, HookPostEvacuate} {
+		store := database.NewMemoryStore()
+		p, output := newHookPolicyEngine(t, store, phase)
+		host := insertFailedHost(t, store)
+		bmc := newFakeBMC(t)
+		if err := store.FencerInsert(bmc.fencer(host.Id)); err != nil {
+			t.Fatal(err)
+		}
+
+		// host is powered off, so it is recovered whatever hooks say
+		p.fenceHost(host, nil)
+		op, steps := latestOperation(t, store, host.Id)
+		if op.Status != OperationFailed {
+			t.Errorf("%s: operation is %s: %s", phase, op.Status, op.Message)
+		}
+		for _, step := range steps {
+			expected := StepSucceeded
+			if step.Name == phase {
+				expected = StepFailed
+			}
+			if step.Status != expected {
+				t.Errorf("%s: step %s is %s", phase, step.Name, step.Status)
+			}
+		}
+		if out := readOutput(output); !strings.Contains(out, phase+"\n") || !strings.Contains(out, "one\n") {
+			t.Errorf("%s: unexpected steps executed: %q", phase, out)
+		}
+		if saved, _ := store.HostGetById(host.Id); saved.Status != HostFencedStatus || !saved.Disabled {
+			t.Errorf("%s: host is %s, disabled %v", phase, saved.Status, saved.Disabled)
+		}
+	}
+}
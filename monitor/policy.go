@@ -1,6 +1,8 @@
 package monitor
 
 import (
+	"sort"
+	"strings"
 	"time"
 
 	"themis/config"
@@ -45,18 +47,120 @@ var (
 type PolicyEngine struct {
 	config         *config.ThemisConfig
 	decisionMatrix []bool
+	pipelines      map[string][]RecoveryAction
+	hooks          map[string][]*Hook
+	leaderName     string
+	store          database.Store
+	// writes of policy engine are guarded by epoch of our leadership
+	elector Elector
+	db      database.GuardedStore
+	// clock is replaced when replaying events
+	clock func() time.Time
+	// only record decisions without fencing or restoring hosts
+	dryRun bool
+	// hosts and states evaluated last cycle, they are evaluated in memory
+	// with fencing suspended while store is unavailable
+	hosts     []*database.Host
+	allStates map[int][]*database.HostState
+	outage    bool
 }
 
-func NewPolicyEngine(config *config.ThemisConfig) *PolicyEngine {
+func NewPolicyEngine(config *config.ThemisConfig, leaderName string, store database.Store) *PolicyEngine {
 	return &PolicyEngine{
 		config:         config,
+		leaderName:     leaderName,
 		decisionMatrix: openstackDecisionMatrix,
+		pipelines:      NewRecoveryPipelines(config),
+		hooks:          NewHooks(config.Hooks),
+		store:          store,
+		db:             store.Guard(nil),
+		clock:          time.Now,
 	}
 }
 
-func saveHost(host *database.Host) {
-	host.UpdatedAt = time.Now()
-	database.HostUpdateFields(host, "status", "disabled", "updated_at")
+func (p *PolicyEngine) now() time.Time {
+	return p.clock()
+}
+
+// SetElector binds policy engine to current term of leadership of elector.
+func (p *PolicyEngine) SetElector(elector Elector) {
+	p.elector = elector
+	p.db = p.store.Guard(elector.Epoch())
+}
+
+// checkEpoch fails if we are not the leader anymore or our lease has expired.
+func (p *PolicyEngine) checkEpoch() error {
+	if p.elector == nil {
+		return nil
+	}
+	return p.elector.Validate()
+}
+
+// transitHost moves host to status and records the transition.
+func (p *PolicyEngine) transitHost(host *database.Host, status, reason string, states []*database.HostState) {
+	var history *database.HostStatusHistory
+
+	if host.Status == status {
+		host.UpdatedAt = p.now()
+	} else {
+		history = p.moveHost(host, status, reason, states)
+	}
+	save := func() error {
+		if history == nil {
+			return p.db.HostUpdateFields(host, "status", "disabled", "updated_at")
+		}
+		history.Id = 0
+		return p.db.HostUpdateStatus(host, history)
+	}
+
+	err := save()
+	if err == database.ErrConflict {
+		// host has been changed by others since we loaded it, keep their
+		// changes except the transition made by us.
+		var latest *database.Host
+		latest, err = p.store.HostGetById(host.Id)
+		if err == nil && latest != nil {
+			latest.Status, latest.UpdatedAt = host.Status, host.UpdatedAt
+			latest.Disabled = latest.Disabled || host.Disabled
+			*host = *latest
+			err = save()
+		}
+	}
+	if err != nil {
+		plog.Warningf("Save host %s failed: %s", host.Name, err)
+	}
+}
+
+// moveHost moves host to status in memory and returns history of the transition.
+func (p *PolicyEngine) moveHost(host *database.Host, status, reason string, states []*database.HostState) *database.HostStatusHistory {
+	history := &database.HostStatusHistory{
+		HostId:     host.Id,
+		OldStatus:  host.Status,
+		NewStatus:  status,
+		Reason:     reason,
+		States:     map[string]int{},
+		LeaderName: p.leaderName,
+		CreatedAt:  p.now(),
+	}
+	for _, state := range states {
+		history.States[state.Tag] = state.FailedTimes
+	}
+
+	host.Status = status
+	host.UpdatedAt = history.CreatedAt
+	return history
+}
+
+// failedTags returns tags which have failures.
+func failedTags(states []*database.HostState) string {
+	tags := make([]string, 0)
+	for _, state := range states {
+		if state.FailedTimes > 0 {
+			tags = append(tags, state.Tag)
+		}
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, ",")
 }
 
 func isAllActive(states []*database.HostState) bool {
@@ -99,35 +203,38 @@ func hasFatalFailure(states []*database.HostState) bool {
 	return hasFailure
 }
 
-func updateHostFSM(host *database.Host, states []*database.HostState) {
+// updateHostFSM moves host in memory, it returns history of the transition
+// or nil if host stays where it is.
+func (p *PolicyEngine) updateHostFSM(host *database.Host, states []*database.HostState) *database.HostStatusHistory {
 
-	duration := time.Since(host.UpdatedAt).Seconds()
+	duration := p.now().Sub(host.UpdatedAt).Seconds()
 	switch host.Status {
 	case HostActiveStatus:
 		if hasAnyFailure(states) {
-			host.Status = HostCheckingStatus
-			saveHost(host)
+			return p.moveHost(host, HostCheckingStatus,
+				"failures found on "+failedTags(states), states)
 		}
 	case HostInitialStatus:
 		if duration >= stateTransitionInterval {
 			if isAllActive(states) {
-				host.Status = HostActiveStatus
-				saveHost(host)
+				return p.moveHost(host, HostActiveStatus, "all tags are active", states)
 			}
 		}
 	case HostCheckingStatus:
 		if duration >= stateTransitionInterval {
 			if isAllActive(states) {
-				host.Status = HostActiveStatus
-				saveHost(host)
+				return p.moveHost(host, HostActiveStatus, "all tags recovered", states)
 			} else if hasFatalFailure(states) {
-				host.Status = HostFailedStatus
-				saveHost(host)
+				return p.moveHost(host, HostFailedStatus,
+					"fatal failures found on "+failedTags(states), states)
 			}
 		}
 	}
+	return nil
 }
 
+// HandleEvents evaluates all hosts reported by events in memory, saves all
+// changes in one transaction, then fences or restores hosts as decided.
 func (p *PolicyEngine) HandleEvents(events Events) {
 
 	// group by hostname
@@ -143,34 +250,45 @@ func (p *PolicyEngine) HandleEvents(events Events) {
 		}
 		hostTags[e.Hostname] = tags
 	}
+	if len(hostTags) == 0 {
+		return
+	}
+
+	hosts, allStates, err := p.loadHosts()
+	if err != nil {
+		plog.Warning("Can't get hosts: ", err)
+		return
+	}
+	hostsByName := map[string]*database.Host{}
+	for _, host := range hosts {
+		hostsByName[host.Name] = host
+	}
 
+	changes := make([]*database.HostChanges, 0, len(hostTags))
+	oldStatus := make([]string, 0, len(hostTags))
+	hostStates := make([][]*database.HostState, 0, len(hostTags))
 	for hostname, tags := range hostTags {
 		plog.Debugf("Handle %s's events.", hostname)
 
-		var host *database.Host
-		host, err := database.HostGetByName(hostname)
-		if err != nil {
-			plog.Warningf("Can't find Host %s.", hostname)
-			return
-		} else if host == nil {
-			// save to database
-			host = &database.Host{
-				Name:     hostname,
-				Status:   HostInitialStatus,
-				Disabled: false,
-			}
-			if err := database.HostInsert(host); err != nil {
-				plog.Warning("Save host failed", err)
-				continue
+		change := &database.HostChanges{Host: hostsByName[hostname]}
+		if change.Host == nil && p.outage {
+			plog.Debugf("Skip events of new host %s while store is unavailable.", hostname)
+			continue
+		} else if change.Host == nil {
+			change.New = true
+			change.Host = &database.Host{
+				Name:      hostname,
+				Status:    HostInitialStatus,
+				Disabled:  false,
+				UpdatedAt: p.now(),
 			}
 		}
+		host := change.Host
 
 		// update host states
-		var states []*database.HostState
-		states, err = database.StateGetAll(host.Id)
-		if err != nil {
-			plog.Warning("Can't find Host states")
-			continue
+		states := allStates[host.Id]
+		if change.New {
+			states = nil
 		}
 		for tag, status := range tags {
 			var state *database.HostState
@@ -186,42 +304,105 @@ func (p *PolicyEngine) HandleEvents(events Events) {
 					Tag:         tag,
 					FailedTimes: 0,
 				}
-				if err := database.StateInsert(state); err != nil {
-					plog.Warning("Save host state failed", err)
-					continue
-				}
+				states = append(states, state)
+				change.NewStates = append(change.NewStates, state)
 			}
-			if !host.Disabled {
-				if status == "active" && state.FailedTimes > 0 {
-					state.FailedTimes -= 1
-				} else if status == "failed" {
-					state.FailedTimes += 1
-				}
+			if host.Disabled {
+				continue
+			}
+			failedTimes := state.FailedTimes
+			if status == "active" && state.FailedTimes > 0 {
+				state.FailedTimes -= 1
+			} else if status == "failed" {
+				state.FailedTimes += 1
+			}
+			if state.Id > 0 && state.FailedTimes != failedTimes {
+				change.States = append(change.States, state)
 			}
-			database.StateUpdateFields(state, "failed_times")
 		}
 
-		states, err = database.StateGetAll(host.Id)
-		if err != nil {
-			plog.Warning("Can't find Host states")
-			return
-		}
 		// update host status
 		plog.Debugf("update %s's FSM.", hostname)
-		updateHostFSM(host, states)
+		oldStatus = append(oldStatus, host.Status)
+		change.History = p.updateHostFSM(host, states)
+		changes = append(changes, change)
+		hostStates = append(hostStates, states)
+		if !change.New {
+			allStates[host.Id] = states
+		}
+	}
+
+	if p.outage {
+		for i, change := range changes {
+			if p.getDecision(change.Host, hostStates[i]) {
+				plog.Warningf("Host %s should be fenced, but fencing is suspended while store is unavailable.",
+					change.Host.Name)
+			}
+		}
+		return
+	}
+
+	errs := p.db.HostsSave(changes)
+	for i, change := range changes {
+		host := change.Host
+		if errs[i] != nil {
+			plog.Warningf("Save host %s failed: %s", host.Name, errs[i])
+			continue
+		}
+		if change.New {
+			p.hosts = append(p.hosts, host)
+			p.allStates[host.Id] = hostStates[i]
+		}
+		if oldStatus[i] == HostInitialStatus && host.Status == HostActiveStatus && p.wasFenced(host) {
+			p.restoreHost(host)
+		}
 
 		// judge if a host is down
-		if p.getDecision(host, states) {
-			p.fenceHost(host, states)
+		if p.getDecision(host, hostStates[i]) {
+			p.fenceHost(host, hostStates[i])
 		}
 	}
 }
 
+// loadHosts returns hosts and their states from store. If store is
+// unavailable, hosts evaluated last cycle are returned instead, and fencing
+// is suspended until store is back.
+func (p *PolicyEngine) loadHosts() ([]*database.Host, map[int][]*database.HostState, error) {
+	hosts, err := p.store.HostGetAll()
+	var allStates map[int][]*database.HostState
+	if err == nil {
+		allStates, err = p.store.StateGetAllHosts()
+	}
+
+	if err == nil {
+		if p.outage {
+			plog.Info("Store is available again, reload hosts and resume fencing.")
+			p.outage = false
+		}
+		p.hosts, p.allStates = hosts, allStates
+		return hosts, allStates, nil
+	} else if p.hosts == nil {
+		return nil, nil, err
+	}
+	if !p.outage {
+		plog.Warningf("Store is unavailable, evaluate hosts in memory and suspend fencing: %s", err)
+		p.outage = true
+	}
+	return p.hosts, p.allStates, nil
+}
+
 func (p *PolicyEngine) getDecision(host *database.Host, states []*database.HostState) bool {
 
 	if host.Disabled {
 		return false
 	}
+	// hosts removed from nova or disabled in nova are out of service, there
+	// is nothing to evacuate from them, so they are watched but never fenced.
+	if host.Orphaned || host.NovaDisabled {
+		plog.Debugf("Skip fencing host %s, orphaned %t, disabled in nova %t.",
+			host.Name, host.Orphaned, host.NovaDisabled)
+		return false
+	}
 
 	statusDecision := false
 	for _, status := range doFenceStatus {
@@ -240,79 +421,3 @@ func (p *PolicyEngine) getDecision(host *database.Host, states []*database.HostS
 
 	return statusDecision && p.decisionMatrix[decision]
 }
-
-func (p *PolicyEngine) fenceHost(host *database.Host, states []*database.HostState) {
-	defer func() {
-		if err := recover(); err != nil {
-			plog.Warning("unexpected error during HandleEvents: ", err)
-		}
-	}()
-
-	// check if we have disabled fence operation globally
-	if p.config.Fence.DisableFenceOps {
-		plog.Info("fence operation have been disabled.")
-		return
-	}
-
-	plog.Infof("Begin fence host %s", host.Name)
-	// update host status
-	host.Status = HostFencingStatus
-	saveHost(host)
-
-	// execute power off through IPMI
-	fencers, err := database.FencerGetByHost(host.Id)
-	if err != nil || len(fencers) < 1 {
-		plog.Warning("Can't find fencers with given host: ", host.Name)
-		return
-	}
-
-	var IPMIFencers []FencerInterface
-	for _, fencer := range fencers {
-		IPMIFencers = append(IPMIFencers, NewFencer(fencer))
-	}
-
-	plog.Debug("Begin execute fence operation")
-	for _, fencer := range IPMIFencers {
-		if err := fencer.Fence(); err != nil {
-			plog.Warningf("Fence operation failed on host %s", host.Name)
-			continue
-		}
-		plog.Infof("Fence operation successed on host: %s", host.Name)
-		break
-	}
-
-	// evacuate all virtual machine on that host
-	nova, err := NewNovaClient(&p.config.Openstack)
-	if err != nil {
-		plog.Warning("Can't create nova client: ", err)
-		return
-	}
-
-	services, err := nova.ListServices()
-	if err != nil {
-		plog.Warning("Can't get service list", err)
-		return
-	}
-	for _, service := range services {
-		if host.Name == service.Host && service.Binary == "nova-compute" {
-			nova.ForceDownService(service)
-			nova.DisableService(service, "disabled by themis monitor")
-		}
-	}
-
-	servers, err := nova.ListServers(host.Name)
-	if err != nil {
-		plog.Warning("Can't get service list: ", err)
-		return
-	}
-	for _, server := range servers {
-		id := server.ID
-		plog.Infof("Try to evacuate instance: %s", id)
-		nova.Evacuate(id)
-	}
-
-	// disable host status
-	host.Status = HostFencedStatus
-	host.Disabled = true
-	saveHost(host)
-}
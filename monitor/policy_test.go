@@ -0,0 +1,224 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"themis/config"
+	"themis/database"
+)
+
+// policyClock is a clock of policy engine moved by tests.
+type policyClock struct {
+	now time.Time
+}
+
+func (c *policyClock) advance(seconds int) {
+	c.now = c.now.Add(time.Duration(seconds) * time.Second)
+}
+
+func newTestPolicyEngine(store database.Store) (*PolicyEngine, *policyClock) {
+	clock := &policyClock{now: time.Now()}
+	p := NewPolicyEngine(config.NewDefaultConfig(), "monitor1", store)
+	p.clock = func() time.Time { return clock.now }
+	return p, clock
+}
+
+// tagEvents reports tags of hostname failed, and other tags active.
+func tagEvents(hostname string, failed ...string) Events {
+	events := activeEvents(hostname)
+	for _, e := range events {
+		for _, tag := range failed {
+			if e.NetworkTag == tag {
+				e.Status = "failed"
+			}
+		}
+	}
+	return events
+}
+
+func checkHost(t *testing.T, store database.Store, name, status string) *database.Host {
+	t.Helper()
+	host, err := store.HostGetByName(name)
+	if err != nil || host == nil {
+		t.Fatalf("host %s is not found: %v", name, err)
+	}
+	if host.Status != status {
+		t.Fatalf("host %s is %s, not %s", name, host.Status, status)
+	}
+	return host
+}
+
+func failedTimes(t *testing.T, store database.Store, host *database.Host) map[string]int {
+	states, err := store.StateGetAll(host.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := map[string]int{}
+	for _, state := range states {
+		times[state.Tag] = state.FailedTimes
+	}
+	return times
+}
+
+// activateHost adds host through events and waits until it becomes active.
+func activateHost(t *testing.T, p *PolicyEngine, clock *policyClock, name string) *database.Host {
+	p.HandleEvents(activeEvents(name))
+	checkHost(t, p.store, name, HostInitialStatus)
+	clock.advance(stateTransitionInterval)
+	p.HandleEvents(activeEvents(name))
+	return checkHost(t, p.store, name, HostActiveStatus)
+}
+
+func TestHandleEventsNewHost(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, clock := newTestPolicyEngine(store)
+
+	p.HandleEvents(activeEvents("node1"))
+	host := checkHost(t, store, "node1", HostInitialStatus)
+	if times := failedTimes(t, store, host); len(times) != len(flagTagMap) {
+		t.Errorf("unexpected states %v", times)
+	}
+
+	// host stays initializing until interval passes
+	clock.advance(stateTransitionInterval - 1)
+	p.HandleEvents(activeEvents("node1"))
+	checkHost(t, store, "node1", HostInitialStatus)
+	clock.advance(1)
+	p.HandleEvents(activeEvents("node1"))
+	checkHost(t, store, "node1", HostActiveStatus)
+
+	histories, err := store.HostHistoryGetAll(host.Id)
+	if err != nil || len(histories) != 1 {
+		t.Fatalf("unexpected histories %v: %v", histories, err)
+	}
+	if histories[0].OldStatus != HostInitialStatus || histories[0].NewStatus != HostActiveStatus ||
+		histories[0].LeaderName != "monitor1" {
+		t.Errorf("unexpected history %+v", histories[0])
+	}
+}
+
+func TestHandleEventsRecovered(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, clock := newTestPolicyEngine(store)
+	host := activateHost(t, p, clock, "node1")
+
+	p.HandleEvents(tagEvents("node1", "network"))
+	checkHost(t, store, "node1", HostCheckingStatus)
+	if times := failedTimes(t, store, host); times["network"] != 1 || times["storage"] != 0 {
+		t.Errorf("unexpected failed times %v", times)
+	}
+
+	// failures are counted down by active events
+	clock.advance(stateTransitionInterval)
+	p.HandleEvents(activeEvents("node1"))
+	checkHost(t, store, "node1", HostActiveStatus)
+	if times := failedTimes(t, store, host); times["network"] != 0 {
+		t.Errorf("unexpected failed times %v", times)
+	}
+}
+
+func TestHandleEventsManageFailure(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, clock := newTestPolicyEngine(store)
+	host := activateHost(t, p, clock, "node1")
+
+	// failures of manage network alone are not fatal
+	for i := 0; i < 10; i++ {
+		p.HandleEvents(tagEvents("node1", "manage"))
+		clock.advance(stateTransitionInterval)
+	}
+	checkHost(t, store, "node1", HostCheckingStatus)
+	if op, _ := store.OperationGetLatest(host.Id); op != nil {
+		t.Errorf("host is fenced by operation %d", op.Id)
+	}
+}
+
+// failHost reports network of host failed until host should be fenced.
+func failHost(p *PolicyEngine, clock *policyClock, name string) {
+	for i := 0; i < 6; i++ {
+		p.HandleEvents(tagEvents(name, "network"))
+	}
+	clock.advance(stateTransitionInterval)
+	p.HandleEvents(tagEvents(name, "network"))
+}
+
+func TestHandleEventsFence(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, clock := newTestPolicyEngine(store)
+	p.dryRun = true
+	host := activateHost(t, p, clock, "node1")
+	activateHost(t, p, clock, "node2")
+
+	failHost(p, clock, "node1")
+	checkHost(t, store, "node1", HostFencingStatus)
+	if times := failedTimes(t, store, host); times["network"] != 7 {
+		t.Errorf("unexpected failed times %v", times)
+	}
+	checkHost(t, store, "node2", HostActiveStatus)
+
+	histories, _ := store.HostHistoryGetAll(host.Id)
+	var statuses []string
+	for i := len(histories) - 1; i >= 0; i-- {
+		statuses = append(statuses, histories[i].NewStatus)
+	}
+	expected := []string{HostActiveStatus, HostCheckingStatus, HostFailedStatus, HostFencingStatus}
+	if len(statuses) != len(expected) {
+		t.Fatalf("unexpected transitions %v", statuses)
+	}
+	for i := range expected {
+		if statuses[i] != expected[i] {
+			t.Fatalf("unexpected transitions %v", statuses)
+		}
+	}
+}
+
+func TestHandleEventsFenceDisabled(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, clock := newTestPolicyEngine(store)
+	p.config.Fence.DisableFenceOps = true
+	host := activateHost(t, p, clock, "node1")
+
+	failHost(p, clock, "node1")
+	checkHost(t, store, "node1", HostFailedStatus)
+	if op, _ := store.OperationGetLatest(host.Id); op != nil {
+		t.Errorf("host is fenced by operation %d", op.Id)
+	}
+}
+
+func TestHandleEventsDisabledHost(t *testing.T) {
+	store := database.NewMemoryStore()
+	p, clock := newTestPolicyEngine(store)
+	host := activateHost(t, p, clock, "node1")
+	host.Disabled = true
+	if err := store.HostUpdateFields(host, "disabled"); err != nil {
+		t.Fatal(err)
+	}
+
+	// failures of disabled hosts are ignored
+	failHost(p, clock, "node1")
+	checkHost(t, store, "node1", HostActiveStatus)
+	if times := failedTimes(t, store, host); times["network"] != 0 {
+		t.Errorf("unexpected failed times %v", times)
+	}
+}
+
+func TestHandleEventsOutOfServiceHost(t *testing.T) {
+	for _, field := range []string{"orphaned", "nova_disabled"} {
+		store := database.NewMemoryStore()
+		p, clock := newTestPolicyEngine(store)
+		p.dryRun = true
+		host := activateHost(t, p, clock, "node1")
+		host.Orphaned = field == "orphaned"
+		host.NovaDisabled = field == "nova_disabled"
+		if err := store.HostUpdateFields(host, field); err != nil {
+			t.Fatal(err)
+		}
+
+		// failures are still tracked, but host is never fenced
+		failHost(p, clock, "node1")
+		clock.advance(stateTransitionInterval)
+		p.HandleEvents(tagEvents("node1", "network"))
+		checkHost(t, store, "node1", HostFailedStatus)
+	}
+}
@@ -0,0 +1,321 @@
+package monitor
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+
+	"themis/config"
+	"themis/database"
+)
+
+const (
+	raftApplyTimeout     = 10 * time.Second
+	raftTransportTimeout = 10 * time.Second
+	raftCampaignInterval = 1 * time.Second
+	raftSnapshotsRetain  = 2
+	raftMaxPool          = 3
+)
+
+// RaftNode replicates all writes of database among monitors.
+type RaftNode struct {
+	Id    string
+	raft  *raft.Raft
+	store *raftboltdb.BoltStore
+}
+
+// raftLogWriter forwards logs of raft to our logger.
+type raftLogWriter struct{}
+
+func (w raftLogWriter) Write(p []byte) (int, error) {
+	plog.Info(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+// raftState is the state machine replicated by raft.
+type raftState interface {
+	Apply(data []byte) interface{}
+	Dump() ([]byte, error)
+	Load(data []byte) error
+	Reset() error
+}
+
+// databaseState replicates writes of local database.
+type databaseState struct{}
+
+func (databaseState) Apply(data []byte) interface{} { return database.ApplyCommand(data) }
+func (databaseState) Dump() ([]byte, error)         { return database.Dump() }
+func (databaseState) Load(data []byte) error        { return database.Load(data) }
+func (databaseState) Reset() error                  { return database.Reset() }
+
+func NewRaftNode(cfg *config.RaftConfig, nodeId string) (*RaftNode, error) {
+	return newRaftNode(cfg, nodeId, databaseState{})
+}
+
+func newRaftNode(cfg *config.RaftConfig, nodeId string, state raftState) (*RaftNode, error) {
+	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
+		return nil, err
+	}
+
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:   "raft",
+		Level:  hclog.Info,
+		Output: raftLogWriter{},
+	})
+	raftConfig := raft.DefaultConfig()
+	raftConfig.LocalID = raft.ServerID(nodeId)
+	raftConfig.Logger = logger
+
+	store, err := raftboltdb.NewBoltStore(filepath.Join(cfg.DataDir, "raft.db"))
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := raft.NewFileSnapshotStoreWithLogger(cfg.DataDir, raftSnapshotsRetain, logger)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransportWithLogger(cfg.BindAddr, nil,
+		raftMaxPool, raftTransportTimeout, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	exist, err := raft.HasExistingState(store, store, snapshots)
+	if err != nil {
+		return nil, err
+	}
+	// raft applies logs again since the latest snapshot, which is restored
+	// into local database first. Without snapshots, all logs are applied
+	// again, so local database has to be emptied before.
+	if exist {
+		metas, err := snapshots.List()
+		if err != nil {
+			return nil, err
+		}
+		if len(metas) == 0 {
+			plog.Info("No raft snapshot, local database is rebuilt from raft logs.")
+			if err := state.Reset(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	r, err := raft.NewRaft(raftConfig, &raftFSM{state: state}, store, store, snapshots, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	// bootstrap the cluster the first time we start
+	if !exist {
+		servers := make([]raft.Server, 0)
+		for id, address := range cfg.Peers {
+			servers = append(servers, raft.Server{
+				ID:      raft.ServerID(id),
+				Address: raft.ServerAddress(address),
+			})
+		}
+		if len(servers) == 0 {
+			servers = append(servers, raft.Server{
+				ID:      raftConfig.LocalID,
+				Address: transport.LocalAddr(),
+			})
+		}
+		plog.Infof("Bootstrap raft cluster with %d nodes.", len(servers))
+		err := r.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+		if err != nil && err != raft.ErrCantBootstrap {
+			return nil, err
+		}
+	}
+
+	return &RaftNode{Id: nodeId, raft: r, store: store}, nil
+}
+
+// Replicate commits data to raft log, it fails if we are not the leader.
+func (n *RaftNode) Replicate(data []byte) (interface{}, error) {
+	future := n.raft.Apply(data, raftApplyTimeout)
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+	return future.Response(), nil
+}
+
+func (n *RaftNode) isLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+func (n *RaftNode) term() uint64 {
+	term, _ := strconv.ParseUint(n.raft.Stats()["term"], 10, 64)
+	return term
+}
+
+func (n *RaftNode) Shutdown() error {
+	if err := n.raft.Shutdown().Error(); err != nil {
+		return err
+	}
+	return n.store.Close()
+}
+
+// raftFSM applies replicated writes to state.
+type raftFSM struct {
+	state raftState
+}
+
+func (f *raftFSM) Apply(log *raft.Log) interface{} {
+	return f.state.Apply(log.Data)
+}
+
+func (f *raftFSM) Snapshot() (raft.FSMSnapshot, error) {
+	data, err := f.state.Dump()
+	if err != nil {
+		return nil, err
+	}
+	return &raftSnapshot{data: data}, nil
+}
+
+func (f *raftFSM) Restore(snapshot io.ReadCloser) error {
+	defer snapshot.Close()
+
+	data, err := ioutil.ReadAll(snapshot)
+	if err != nil {
+		return err
+	}
+	// snapshot replaces whatever local database holds
+	if err := f.state.Reset(); err != nil {
+		return err
+	}
+	return f.state.Load(data)
+}
+
+type raftSnapshot struct {
+	data []byte
+}
+
+func (s *raftSnapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := sink.Write(s.data); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *raftSnapshot) Release() {}
+
+// RaftElection follows leadership of raft, raft already rejects writes of
+// a stale leader, so no epoch is needed.
+type RaftElection struct {
+	node *RaftNode
+	// URL of our REST API
+	address string
+	// raft term of our current leadership
+	term  uint64
+	store database.Store
+}
+
+func NewRaftElection(node *RaftNode, address string, store database.Store) *RaftElection {
+	return &RaftElection{node: node, address: address, store: store}
+}
+
+func (e *RaftElection) Campaign(ctx context.Context) <-chan error {
+	quit := make(chan error, 1)
+
+	e.term = 0
+	for !e.node.isLeader() {
+		select {
+		case <-ctx.Done():
+			plog.Info("Quit campaign: ", ctx.Err())
+			return quit
+		case <-time.After(raftCampaignInterval):
+		}
+	}
+
+	// make sure all committed writes are applied to local database
+	if err := e.node.raft.Barrier(raftApplyTimeout).Error(); err != nil {
+		plog.Info("Campaign failed: ", err)
+		quit <- err
+		return quit
+	}
+	e.term = e.node.term()
+	plog.Infof("%s campaign successed in term %d.", e.node.Id, e.term)
+	recordMember(e.store, e.node.Id, e.address, int64(e.term), true)
+	return quit
+}
+
+func (e *RaftElection) Proclaim() (bool, error) {
+	if !e.node.isLeader() {
+		return false, nil
+	}
+	if term := e.node.term(); term != e.term {
+		plog.Infof("%s term changed from %d to %d.", e.node.Id, e.term, term)
+		return false, nil
+	}
+	recordMember(e.store, e.node.Id, e.address, int64(e.term), false)
+	return true, nil
+}
+
+// Quit hands leadership over to another node.
+func (e *RaftElection) Quit() error {
+	if !e.node.isLeader() {
+		return nil
+	}
+	plog.Debug("transfer leadership so that other node can become leader more quickly.")
+	return e.node.raft.LeadershipTransfer().Error()
+}
+
+func (e *RaftElection) Epoch() *database.Epoch {
+	return nil
+}
+
+// Validate confirms with a quorum that we are still the leader.
+func (e *RaftElection) Validate() error {
+	if !e.node.isLeader() || e.node.term() != e.term {
+		return raft.ErrNotLeader
+	}
+	return e.node.raft.VerifyLeader().Error()
+}
+
+func (e *RaftElection) Name() string {
+	return e.node.Id
+}
+
+// Members returns all nodes of raft cluster, only leaders have campaigned.
+func (e *RaftElection) Members() ([]*database.ElectionMember, error) {
+	future := e.node.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+	campaigned, err := e.store.ElectionMemberGetAll(defaultElectionName)
+	if err != nil {
+		return nil, err
+	}
+	records := map[string]*database.ElectionMember{}
+	for _, member := range campaigned {
+		records[member.Name] = member
+	}
+
+	_, leaderId := e.node.raft.LeaderWithID()
+	members := make([]*database.ElectionMember, 0)
+	for _, server := range future.Configuration().Servers {
+		member := records[string(server.ID)]
+		if member == nil {
+			member = &database.ElectionMember{
+				ElectionName: defaultElectionName,
+				Name:         string(server.ID),
+			}
+		}
+		member.Leader = server.ID == leaderId
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+	return members, nil
+}
@@ -0,0 +1,306 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"themis/config"
+	"themis/database"
+)
+
+// recordState records commands applied by raft in order.
+type recordState struct {
+	mutex    sync.Mutex
+	commands []string
+	resets   int
+}
+
+func (s *recordState) Apply(data []byte) interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.commands = append(s.commands, string(data))
+	return len(s.commands)
+}
+
+func (s *recordState) Dump() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return json.Marshal(s.commands)
+}
+
+func (s *recordState) Load(data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return json.Unmarshal(data, &s.commands)
+}
+
+func (s *recordState) Reset() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.commands = nil
+	s.resets++
+	return nil
+}
+
+func (s *recordState) String() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return strings.Join(s.commands, ",")
+}
+
+type testRaftNode struct {
+	*RaftNode
+	state    *recordState
+	election *RaftElection
+	stopped  bool
+}
+
+// freeAddrs returns addresses of local ports nobody listens on.
+func freeAddrs(t *testing.T, n int) []string {
+	addrs := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, l.Addr().String())
+		defer l.Close()
+	}
+	return addrs
+}
+
+// startRaftCluster starts a raft cluster of n nodes in this process.
+func startRaftCluster(t *testing.T, n int) []*testRaftNode {
+	addrs := freeAddrs(t, n)
+	peers := map[string]string{}
+	for i, addr := range addrs {
+		peers[fmt.Sprintf("node%d", i+1)] = addr
+	}
+
+	store := database.NewMemoryStore()
+	nodes := make([]*testRaftNode, 0, n)
+	for i, addr := range addrs {
+		cfg := &config.RaftConfig{Enabled: true, BindAddr: addr, DataDir: t.TempDir(), Peers: peers}
+		state := &recordState{}
+		node, err := newRaftNode(cfg, fmt.Sprintf("node%d", i+1), state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, &testRaftNode{
+			RaftNode: node,
+			state:    state,
+			election: NewRaftElection(node, "http://"+addr, store),
+		})
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			if !node.stopped {
+				node.Shutdown()
+			}
+		}
+	})
+	return nodes
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(20 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// waitLeader returns the only leader of running nodes.
+func waitLeader(t *testing.T, nodes []*testRaftNode) *testRaftNode {
+	t.Helper()
+	var leader *testRaftNode
+	waitFor(t, "leader", func() bool {
+		leader = nil
+		for _, node := range nodes {
+			if node.stopped || !node.isLeader() {
+				continue
+			} else if leader != nil {
+				return false
+			}
+			leader = node
+		}
+		return leader != nil
+	})
+	return leader
+}
+
+func waitApplied(t *testing.T, nodes []*testRaftNode, commands string) {
+	t.Helper()
+	for _, node := range nodes {
+		if node.stopped {
+			continue
+		}
+		waitFor(t, node.Id+" applies "+commands, func() bool {
+			return node.state.String() == commands
+		})
+	}
+}
+
+func campaign(t *testing.T, node *testRaftNode) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	select {
+	case err := <-node.election.Campaign(ctx):
+		t.Fatalf("%s quits campaign: %v", node.Id, err)
+	default:
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("%s does not win campaign", node.Id)
+	}
+}
+
+func TestRaftReplication(t *testing.T) {
+	nodes := startRaftCluster(t, 3)
+	leader := waitLeader(t, nodes)
+
+	if response, err := leader.Replicate([]byte("a")); err != nil || response != 1 {
+		t.Fatalf("leader replicates: %v %v", response, err)
+	}
+	for _, node := range nodes {
+		if node != leader {
+			if _, err := node.Replicate([]byte("x")); err == nil {
+				t.Errorf("follower %s replicates", node.Id)
+			}
+		}
+	}
+	waitApplied(t, nodes, "a")
+
+	// leader fails, others elect a new one which has all writes
+	leader.Shutdown()
+	leader.stopped = true
+	if _, err := leader.Replicate([]byte("x")); err == nil {
+		t.Errorf("stopped leader replicates")
+	}
+	newLeader := waitLeader(t, nodes)
+	if response, err := newLeader.Replicate([]byte("b")); err != nil || response != 2 {
+		t.Fatalf("new leader replicates: %v %v", response, err)
+	}
+	waitApplied(t, nodes, "a,b")
+}
+
+func TestRaftElection(t *testing.T) {
+	nodes := startRaftCluster(t, 3)
+	leader := waitLeader(t, nodes)
+
+	campaign(t, leader)
+	if ok, err := leader.election.Proclaim(); !ok || err != nil {
+		t.Fatalf("leader proclaims: %v %v", ok, err)
+	}
+	if err := leader.election.Validate(); err != nil {
+		t.Fatalf("leader is not valid: %s", err)
+	}
+
+	for _, node := range nodes {
+		if node == leader {
+			continue
+		}
+		// followers never win the campaign
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		node.election.Campaign(ctx)
+		cancel()
+		if ok, _ := node.election.Proclaim(); ok {
+			t.Errorf("follower %s proclaims", node.Id)
+		}
+		if err := node.election.Validate(); err == nil {
+			t.Errorf("follower %s is valid", node.Id)
+		}
+	}
+
+	members, err := leader.election.Members()
+	if err != nil || len(members) != 3 {
+		t.Fatalf("unexpected members %v: %v", members, err)
+	}
+	for _, member := range members {
+		if member.Leader != (member.Name == leader.Id) {
+			t.Errorf("member %s is leader %v", member.Name, member.Leader)
+		}
+		if member.Name == leader.Id && member.Address != leader.election.address {
+			t.Errorf("leader is at %s", member.Address)
+		}
+	}
+
+	// leader hands over leadership, it is not valid anymore
+	if err := leader.election.Quit(); err != nil {
+		t.Fatalf("leader quits: %s", err)
+	}
+	waitFor(t, leader.Id+" steps down", func() bool { return !leader.isLeader() })
+	newLeader := waitLeader(t, nodes)
+	if err := leader.election.Validate(); err == nil {
+		t.Errorf("old leader is still valid")
+	}
+	if ok, _ := leader.election.Proclaim(); ok {
+		t.Errorf("old leader proclaims")
+	}
+	campaign(t, newLeader)
+	if err := newLeader.election.Validate(); err != nil {
+		t.Errorf("new leader is not valid: %s", err)
+	}
+	if newLeader.election.term <= leader.election.term {
+		t.Errorf("term of new leader %d is not after %d", newLeader.election.term, leader.election.term)
+	}
+}
+
+// restartRaftNode starts node again on its raft data and local state.
+func restartRaftNode(t *testing.T, node *testRaftNode, cfg *config.RaftConfig) *testRaftNode {
+	t.Helper()
+	if err := node.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := newRaftNode(cfg, node.Id, node.state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { restarted.Shutdown() })
+	return &testRaftNode{RaftNode: restarted, state: node.state}
+}
+
+func TestRaftRestart(t *testing.T) {
+	cfg := &config.RaftConfig{Enabled: true, BindAddr: freeAddrs(t, 1)[0], DataDir: t.TempDir()}
+	state := &recordState{}
+	raftNode, err := newRaftNode(cfg, "node1", state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &testRaftNode{RaftNode: raftNode, state: state}
+	if state.resets != 0 {
+		t.Errorf("local state is reset on first start")
+	}
+	waitLeader(t, []*testRaftNode{node})
+	node.Replicate([]byte("a"))
+
+	// without snapshots all logs are applied again onto empty state
+	node = restartRaftNode(t, node, cfg)
+	waitLeader(t, []*testRaftNode{node})
+	waitApplied(t, []*testRaftNode{node}, "a")
+	if state.resets != 1 {
+		t.Errorf("local state is reset %d times", state.resets)
+	}
+
+	// state is reset only to restore the snapshot, then later logs apply
+	node.Replicate([]byte("b"))
+	if err := node.raft.Snapshot().Error(); err != nil {
+		t.Fatal(err)
+	}
+	node.Replicate([]byte("c"))
+	node = restartRaftNode(t, node, cfg)
+	waitLeader(t, []*testRaftNode{node})
+	waitApplied(t, []*testRaftNode{node}, "a,b,c")
+	if state.resets != 2 {
+		t.Errorf("local state is reset %d times", state.resets)
+	}
+}
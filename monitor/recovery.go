@@ -0,0 +1,184 @@
+package monitor
+
+import (
+	"sort"
+	"time"
+
+	"themis/api"
+	"themis/config"
+	"themis/database"
+)
+
+const (
+	defaultRecoveryGroup   = "default"
+	defaultRecoveryTimeout = 30 // seconds
+)
+
+// RecoveryContext carries information shared by all steps of one recovery pipeline.
+type RecoveryContext struct {
+	Host   *database.Host
+	States []*database.HostState
+	// instances found on host, filled by evacuate step.
+	Instances []string
+}
+
+// RecoveryAction is one step of recovery pipeline executed after a host is fenced.
+type RecoveryAction interface {
+	Name() string
+	Type() string
+	Execute(rc *RecoveryContext) error
+}
+
+// RecoveryRestorer is implemented by actions which should be undone once a
+// fenced host becomes active again.
+type RecoveryRestorer interface {
+	Restore(rc *RecoveryContext) error
+}
+
+func NewRecoveryAction(cfg *config.RecoveryStepConfig, themisCfg *config.ThemisConfig) RecoveryAction {
+	name := cfg.Name
+	if len(name) == 0 {
+		name = cfg.Type
+	}
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultRecoveryTimeout * time.Second
+	}
+
+	switch cfg.Type {
+	case "disable-service":
+		return NewDisableServiceAction(name, &themisCfg.Openstack)
+	case "evacuate":
+		return NewEvacuateAction(name, &themisCfg.Openstack)
+	case "kubernetes":
+		return NewKubernetesAction(name, &themisCfg.Kubernetes)
+	case "webhook":
+		return NewWebhookAction(name, cfg.URL, timeout)
+	case "script":
+		return NewScriptAction(name, cfg.Command, timeout)
+	default:
+		plog.Warningf("unsupported recovery step %s, ignore it.", cfg.Type)
+		return nil
+	}
+}
+
+// NewRecoveryPipelines creates recovery actions for every host group.
+func NewRecoveryPipelines(cfg *config.ThemisConfig) map[string][]RecoveryAction {
+	pipelines := map[string][]RecoveryAction{}
+	for group, recovery := range cfg.Recovery {
+		actions := make([]RecoveryAction, 0)
+		for i := range recovery.Steps {
+			if action := NewRecoveryAction(&recovery.Steps[i], cfg); action != nil {
+				actions = append(actions, action)
+			}
+		}
+		pipelines[group] = actions
+	}
+	return pipelines
+}
+
+// recoveryGroups returns recovery policies of host groups, sorted by name.
+func recoveryGroups(cfg *config.ThemisConfig) []api.InventoryGroup {
+	groups := make([]api.InventoryGroup, 0, len(cfg.Recovery))
+	for name, recovery := range cfg.Recovery {
+		group := api.InventoryGroup{Name: name, Policy: make([]api.InventoryPolicyStep, 0)}
+		for _, step := range recovery.Steps {
+			group.Policy = append(group.Policy, api.InventoryPolicyStep{
+				Type:    step.Type,
+				Name:    step.Name,
+				URL:     step.URL,
+				Command: step.Command,
+				Timeout: step.Timeout,
+			})
+		}
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// getPipeline returns recovery group of host and its actions, groups
+// imported from inventory take precedence over configured ones.
+func (p *PolicyEngine) getPipeline(host *database.Host) (string, []RecoveryAction) {
+	pipelines := p.pipelines
+	if groups, err := p.store.RecoveryGroupGetAll(); err != nil {
+		plog.Warningf("Can't get recovery groups, use configured ones: %s", err)
+	} else if len(groups) > 0 {
+		pipelines = map[string][]RecoveryAction{}
+		for group, actions := range p.pipelines {
+			pipelines[group] = actions
+		}
+		for _, group := range groups {
+			pipelines[group.Name] = p.newPipeline(group.Steps)
+		}
+	}
+
+	if actions, ok := pipelines[host.Group]; ok && len(host.Group) > 0 {
+		return host.Group, actions
+	}
+	return defaultRecoveryGroup, pipelines[defaultRecoveryGroup]
+}
+
+// newPipeline creates recovery actions of steps imported from inventory,
+// webhooks and scripts are skipped unless they are configured here.
+func (p *PolicyEngine) newPipeline(steps []database.RecoveryStep) []RecoveryAction {
+	actions := make([]RecoveryAction, 0)
+	for _, step := range steps {
+		cfg := config.RecoveryStepConfig(step)
+		if (cfg.Type == "webhook" || cfg.Type == "script") && !p.configuredStep(&cfg) {
+			plog.Warningf("Skip imported %s step %q which is not configured.", cfg.Type, cfg.Name)
+			continue
+		}
+		if action := NewRecoveryAction(&cfg, p.config); action != nil {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// configuredStep tells if a step running the same webhook or script is
+// configured in recovery groups.
+func (p *PolicyEngine) configuredStep(step *config.RecoveryStepConfig) bool {
+	for _, recovery := range p.config.Recovery {
+		for _, s := range recovery.Steps {
+			if s.Type == step.Type && s.URL == step.URL && s.Command == step.Command {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wasFenced tells if host was fenced before it was enabled last time, new
+// hosts are never fenced and have nothing to restore.
+func (p *PolicyEngine) wasFenced(host *database.Host) bool {
+	histories, err := p.store.HostHistoryGetAll(host.Id)
+	if err != nil {
+		plog.Warningf("Can't get history of host %s, skip restoring it: %s", host.Name, err)
+		return false
+	}
+	// histories are sorted from the latest one
+	for _, history := range histories {
+		if history.NewStatus == HostInitialStatus {
+			return history.OldStatus == HostFencedStatus
+		}
+	}
+	return false
+}
+
+// restoreHost undoes recovery steps once a fenced host becomes active again.
+func (p *PolicyEngine) restoreHost(host *database.Host) {
+	if p.dryRun {
+		return
+	}
+	_, actions := p.getPipeline(host)
+
+	rc := &RecoveryContext{Host: host}
+	for _, action := range actions {
+		if restorer, ok := action.(RecoveryRestorer); ok {
+			if err := restorer.Restore(rc); err != nil {
+				plog.Warningf("Restore step %s failed on host %s: %s", action.Name(), host.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"themis/database"
+)
+
+// RecoveryPayload is sent to webhooks and scripts in JSON format.
+type RecoveryPayload struct {
+	Step      string                `json:"step"`
+	Host      *database.Host        `json:"host"`
+	States    []*database.HostState `json:"states"`
+	Instances []string              `json:"instances"`
+}
+
+func postJSON(url string, timeout time.Duration, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook %s returned %d: %s", url, resp.StatusCode, data)
+	}
+	return nil
+}
+
+func runCommand(command string, timeout time.Duration, hostname string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), "THEMIS_HOST="+hostname)
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("command %s timed out after %s", command, timeout)
+	} else if err != nil {
+		return fmt.Errorf("command %s failed: %s: %s", command, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+type WebhookAction struct {
+	name    string
+	url     string
+	timeout time.Duration
+}
+
+func NewWebhookAction(name, url string, timeout time.Duration) *WebhookAction {
+	return &WebhookAction{name: name, url: url, timeout: timeout}
+}
+
+func (a *WebhookAction) Name() string {
+	return a.name
+}
+
+func (a *WebhookAction) Type() string {
+	return "webhook"
+}
+
+func (a *WebhookAction) Execute(rc *RecoveryContext) error {
+	return postJSON(a.url, a.timeout, &RecoveryPayload{
+		Step:      a.name,
+		Host:      rc.Host,
+		States:    rc.States,
+		Instances: rc.Instances,
+	})
+}
+
+type ScriptAction struct {
+	name    string
+	command string
+	timeout time.Duration
+}
+
+func NewScriptAction(name, command string, timeout time.Duration) *ScriptAction {
+	return &ScriptAction{name: name, command: command, timeout: timeout}
+}
+
+func (a *ScriptAction) Name() string {
+	return a.name
+}
+
+func (a *ScriptAction) Type() string {
+	return "script"
+}
+
+func (a *ScriptAction) Execute(rc *RecoveryContext) error {
+	return runCommand(a.command, a.timeout, rc.Host.Name, &RecoveryPayload{
+		Step:      a.name,
+		Host:      rc.Host,
+		States:    rc.States,
+		Instances: rc.Instances,
+	})
+}
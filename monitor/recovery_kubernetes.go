@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"themis/config"
+)
+
+type KubernetesAction struct {
+	name   string
+	config *config.KubernetesConfig
+}
+
+func NewKubernetesAction(name string, cfg *config.KubernetesConfig) *KubernetesAction {
+	return &KubernetesAction{name: name, config: cfg}
+}
+
+func (a *KubernetesAction) Name() string {
+	return a.name
+}
+
+func (a *KubernetesAction) Type() string {
+	return "kubernetes"
+}
+
+// Execute taints node out-of-service, then deletes pods and volume attachments stuck on it.
+func (a *KubernetesAction) Execute(rc *RecoveryContext) error {
+	host := rc.Host
+	kube, err := NewKubeClient(a.config)
+	if err != nil {
+		return err
+	}
+
+	node, err := kube.GetNode(host.Name)
+	if err != nil {
+		plog.Warning("Can't get kubernetes node: ", err)
+		return err
+	}
+	if !hasOutOfServiceTaint(node) {
+		taints := append(node.Spec.Taints, KubeTaint{
+			Key:    outOfServiceTaintKey,
+			Value:  outOfServiceTaintValue,
+			Effect: outOfServiceTaintEffect,
+		})
+		if err := kube.UpdateTaints(node, taints); err != nil {
+			plog.Warning("Can't taint kubernetes node: ", err)
+			return err
+		}
+		plog.Infof("tainted node %s out-of-service.", host.Name)
+	}
+
+	pods, err := kube.ListPods(host.Name)
+	if err != nil {
+		plog.Warning("Can't list pods: ", err)
+		return err
+	}
+	for _, pod := range pods {
+		rc.Instances = append(rc.Instances, pod.Metadata.Namespace+"/"+pod.Metadata.Name)
+		plog.Infof("Try to delete pod: %s/%s", pod.Metadata.Namespace, pod.Metadata.Name)
+		if err := kube.ForceDeletePod(pod.Metadata.Namespace, pod.Metadata.Name); err != nil {
+			plog.Warning("Delete pod failed: ", err)
+		}
+	}
+
+	attachments, err := kube.ListVolumeAttachments(host.Name)
+	if err != nil {
+		plog.Warning("Can't list volume attachments: ", err)
+		return err
+	}
+	for _, attachment := range attachments {
+		plog.Infof("Try to delete volume attachment: %s", attachment.Metadata.Name)
+		if err := kube.DeleteVolumeAttachment(attachment.Metadata.Name); err != nil {
+			plog.Warning("Delete volume attachment failed: ", err)
+		}
+	}
+	return nil
+}
+
+// Restore removes out-of-service taint so that pods can be scheduled again.
+func (a *KubernetesAction) Restore(rc *RecoveryContext) error {
+	host := rc.Host
+	kube, err := NewKubeClient(a.config)
+	if err != nil {
+		return err
+	}
+
+	node, err := kube.GetNode(host.Name)
+	if err != nil {
+		plog.Warning("Can't get kubernetes node: ", err)
+		return err
+	}
+	if !hasOutOfServiceTaint(node) {
+		return nil
+	}
+
+	taints := make([]KubeTaint, 0)
+	for _, taint := range node.Spec.Taints {
+		if taint.Key != outOfServiceTaintKey {
+			taints = append(taints, taint)
+		}
+	}
+	if err := kube.UpdateTaints(node, taints); err != nil {
+		plog.Warning("Can't remove taint from kubernetes node: ", err)
+		return err
+	}
+	plog.Infof("removed out-of-service taint from node %s.", host.Name)
+	return nil
+}
+
+func hasOutOfServiceTaint(node *KubeNode) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == outOfServiceTaintKey {
+			return true
+		}
+	}
+	return false
+}
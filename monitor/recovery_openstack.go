@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"themis/config"
+)
+
+type DisableServiceAction struct {
+	name   string
+	config *config.OpenstackConfig
+}
+
+func NewDisableServiceAction(name string, cfg *config.OpenstackConfig) *DisableServiceAction {
+	return &DisableServiceAction{name: name, config: cfg}
+}
+
+func (a *DisableServiceAction) Name() string {
+	return a.name
+}
+
+func (a *DisableServiceAction) Type() string {
+	return "disable-service"
+}
+
+// Execute forces down and disables nova-compute service on host.
+func (a *DisableServiceAction) Execute(rc *RecoveryContext) error {
+	nova, err := NewNovaClient(a.config)
+	if err != nil {
+		plog.Warning("Can't create nova client: ", err)
+		return err
+	}
+
+	services, err := nova.ListServices()
+	if err != nil {
+		plog.Warning("Can't get service list", err)
+		return err
+	}
+	for _, service := range services {
+		if rc.Host.Name == service.Host && service.Binary == "nova-compute" {
+			if r := nova.ForceDownService(service); r.Err != nil {
+				plog.Warning("Force down service failed: ", r.Err)
+			}
+			if r := nova.DisableService(service, "disabled by themis monitor"); r.Err != nil {
+				return r.Err
+			}
+		}
+	}
+	return nil
+}
+
+type EvacuateAction struct {
+	name   string
+	config *config.OpenstackConfig
+}
+
+func NewEvacuateAction(name string, cfg *config.OpenstackConfig) *EvacuateAction {
+	return &EvacuateAction{name: name, config: cfg}
+}
+
+func (a *EvacuateAction) Name() string {
+	return a.name
+}
+
+func (a *EvacuateAction) Type() string {
+	return "evacuate"
+}
+
+// Execute evacuates all virtual machines on host.
+func (a *EvacuateAction) Execute(rc *RecoveryContext) error {
+	nova, err := NewNovaClient(a.config)
+	if err != nil {
+		plog.Warning("Can't create nova client: ", err)
+		return err
+	}
+
+	servers, err := nova.ListServers(rc.Host.Name)
+	if err != nil {
+		plog.Warning("Can't get server list: ", err)
+		return err
+	}
+	for _, server := range servers {
+		id := server.ID
+		rc.Instances = append(rc.Instances, id)
+		plog.Infof("Try to evacuate instance: %s", id)
+		nova.Evacuate(id)
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package monitor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"themis/config"
+	"themis/database"
+)
+
+// fakeKube serves nodes, pods and volume attachments of a Kubernetes API
+// server, and records the requests which change them.
+type fakeKube struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	taints   map[string][]KubeTaint
+	pods     []string
+	writes   []string
+	patchErr int
+}
+
+func newFakeKube(t *testing.T) *fakeKube {
+	k := &fakeKube{
+		taints: map[string][]KubeTaint{"node1": {{Key: "other", Effect: "NoSchedule"}}},
+		pods:   []string{"default/web-0", "kube-system/dns-1"},
+	}
+	k.Server = httptest.NewServer(http.HandlerFunc(k.serve))
+	t.Cleanup(k.Close)
+	return k
+}
+
+func (k *fakeKube) serve(w http.ResponseWriter, r *http.Request) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method != "GET" {
+		k.writes = append(k.writes, r.Method+" "+r.URL.Path)
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/v1/nodes/"):
+		name := strings.TrimPrefix(r.URL.Path, "/api/v1/nodes/")
+		taints, ok := k.taints[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == "PATCH" {
+			if k.patchErr > 0 {
+				w.WriteHeader(k.patchErr)
+				return
+			}
+			var patch struct {
+				Spec struct {
+					Taints []KubeTaint `json:"taints"`
+				} `json:"spec"`
+			}
+			data, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(data, &patch)
+			k.taints[name] = patch.Spec.Taints
+			return
+		}
+		node := KubeNode{}
+		node.Metadata.Name = name
+		node.Metadata.ResourceVersion = "1"
+		node.Spec.Taints = taints
+		json.NewEncoder(w).Encode(node)
+	case r.URL.Path == "/api/v1/pods":
+		if r.URL.Query().Get("fieldSelector") != "spec.nodeName=node1" {
+			w.Write([]byte(`{"items":[]}`))
+			return
+		}
+		items := make([]KubePod, 0)
+		for _, pod := range k.pods {
+			parts := strings.SplitN(pod, "/", 2)
+			item := KubePod{}
+			item.Metadata.Namespace, item.Metadata.Name = parts[0], parts[1]
+			items = append(items, item)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	case strings.HasPrefix(r.URL.Path, "/api/v1/namespaces/"):
+	case r.URL.Path == "/apis/storage.k8s.io/v1/volumeattachments":
+		w.Write([]byte(`{"items":[
+			{"metadata":{"name":"csi-1"},"spec":{"nodeName":"node1"}},
+			{"metadata":{"name":"csi-2"},"spec":{"nodeName":"node2"}}]}`))
+	case strings.HasPrefix(r.URL.Path, "/apis/storage.k8s.io/v1/volumeattachments/"):
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (k *fakeKube) taintsOf(name string) []KubeTaint {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.taints[name]
+}
+
+func (k *fakeKube) hasOutOfServiceTaint(name string) bool {
+	node := &KubeNode{}
+	node.Spec.Taints = k.taintsOf(name)
+	return hasOutOfServiceTaint(node)
+}
+
+func (k *fakeKube) takeWrites() []string {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	writes := k.writes
+	k.writes = nil
+	return writes
+}
+
+func (k *fakeKube) config() *config.KubernetesConfig {
+	return &config.KubernetesConfig{APIServer: k.URL, Token: "secret"}
+}
+
+func TestKubernetesActionExecute(t *testing.T) {
+	kube := newFakeKube(t)
+	action := NewKubernetesAction("kube", kube.config())
+
+	rc := &RecoveryContext{Host: &database.Host{Name: "node1"}}
+	if err := action.Execute(rc); err != nil {
+		t.Fatalf("execute failed: %s", err)
+	}
+	if !kube.hasOutOfServiceTaint("node1") {
+		t.Errorf("node is not tainted out-of-service")
+	}
+	if taints := kube.taintsOf("node1"); len(taints) != 2 || taints[0].Key != "other" {
+		t.Errorf("other taints are not kept: %v", taints)
+	}
+	if strings.Join(rc.Instances, ",") != "default/web-0,kube-system/dns-1" {
+		t.Errorf("unexpected instances %v", rc.Instances)
+	}
+	expected := []string{
+		"PATCH /api/v1/nodes/node1",
+		"DELETE /api/v1/namespaces/default/pods/web-0",
+		"DELETE /api/v1/namespaces/kube-system/pods/dns-1",
+		"DELETE /apis/storage.k8s.io/v1/volumeattachments/csi-1",
+	}
+	if writes := kube.takeWrites(); strings.Join(writes, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected writes %v", writes)
+	}
+
+	// node is tainted already, only pods are deleted again
+	if err := action.Execute(&RecoveryContext{Host: &database.Host{Name: "node1"}}); err != nil {
+		t.Fatalf("execute again failed: %s", err)
+	}
+	for _, write := range kube.takeWrites() {
+		if strings.HasPrefix(write, "PATCH") {
+			t.Errorf("tainted node is patched again")
+		}
+	}
+}
+
+func TestKubernetesActionErrors(t *testing.T) {
+	kube := newFakeKube(t)
+
+	action := NewKubernetesAction("kube", kube.config())
+	if err := action.Execute(&RecoveryContext{Host: &database.Host{Name: "missing"}}); err == nil {
+		t.Errorf("missing node is not reported")
+	}
+
+	kube.patchErr = http.StatusConflict
+	if err := action.Execute(&RecoveryContext{Host: &database.Host{Name: "node1"}}); err == nil {
+		t.Errorf("failed taint is not reported")
+	}
+	for _, write := range kube.takeWrites() {
+		if strings.HasPrefix(write, "DELETE") {
+			t.Errorf("pods are deleted although node is not tainted: %s", write)
+		}
+	}
+
+	cfg := kube.config()
+	cfg.Token = "wrong"
+	if err := NewKubernetesAction("kube", cfg).Execute(&RecoveryContext{Host: &database.Host{Name: "node1"}}); err == nil {
+		t.Errorf("unauthorized request is not reported")
+	}
+}
+
+func TestKubernetesActionRestore(t *testing.T) {
+	kube := newFakeKube(t)
+	action := NewKubernetesAction("kube", kube.config())
+
+	rc := &RecoveryContext{Host: &database.Host{Name: "node1"}}
+	if err := action.Execute(rc); err != nil {
+		t.Fatalf("execute failed: %s", err)
+	}
+	kube.takeWrites()
+
+	if err := action.Restore(rc); err != nil {
+		t.Fatalf("restore failed: %s", err)
+	}
+	if kube.hasOutOfServiceTaint("node1") {
+		t.Errorf("out-of-service taint is not removed")
+	}
+	if taints := kube.taintsOf("node1"); len(taints) != 1 || taints[0].Key != "other" {
+		t.Errorf("other taints are not kept: %v", taints)
+	}
+
+	// nothing to do once taint is removed
+	kube.takeWrites()
+	if err := action.Restore(rc); err != nil {
+		t.Fatalf("restore again failed: %s", err)
+	}
+	if writes := kube.takeWrites(); len(writes) > 0 {
+		t.Errorf("untainted node is patched: %v", writes)
+	}
+}
+
+// newKubePolicyEngine returns policy engine which recovers hosts through kube.
+func newKubePolicyEngine(kube *fakeKube, store database.Store) *PolicyEngine {
+	cfg := config.NewDefaultConfig()
+	cfg.Kubernetes = *kube.config()
+	cfg.Recovery = map[string]config.RecoveryConfig{
+		defaultRecoveryGroup: {Steps: []config.RecoveryStepConfig{{Type: "kubernetes"}}},
+	}
+	return NewPolicyEngine(cfg, "monitor1", store)
+}
+
+// activeEvents reports all tags of hosts active.
+func activeEvents(hostnames ...string) Events {
+	events := Events{}
+	for _, hostname := range hostnames {
+		for tag := range flagTagMap {
+			events = append(events, &Event{Hostname: hostname, NetworkTag: tag, Status: "active"})
+		}
+	}
+	return events
+}
+
+func TestRestoreOnlyFencedHosts(t *testing.T) {
+	kube := newFakeKube(t)
+	kube.taints["node1"] = append(kube.taints["node1"], KubeTaint{Key: outOfServiceTaintKey, Effect: outOfServiceTaintEffect})
+	kube.taints["node2"] = []KubeTaint{{Key: outOfServiceTaintKey, Effect: outOfServiceTaintEffect}}
+
+	store := database.NewMemoryStore()
+	p := newKubePolicyEngine(kube, store)
+	started := time.Now()
+	p.clock = func() time.Time { return started }
+
+	// node1 was fenced then enabled by operator
+	fenced := &database.Host{Name: "node1", Status: HostFencedStatus, Disabled: true, UpdatedAt: started}
+	if err := store.HostInsert(fenced); err != nil {
+		t.Fatal(err)
+	}
+	history := p.moveHost(fenced, HostInitialStatus, "enabled by operator", nil)
+	fenced.Disabled = false
+	if err := store.HostEnable(fenced, nil, history); err != nil {
+		t.Fatal(err)
+	}
+
+	// node2 is new, it is added then becomes active
+	p.HandleEvents(activeEvents("node1", "node2"))
+	if writes := kube.takeWrites(); len(writes) > 0 {
+		t.Fatalf("hosts are restored before they become active: %v", writes)
+	}
+
+	p.clock = func() time.Time { return started.Add(2 * stateTransitionInterval * time.Second) }
+	p.HandleEvents(activeEvents("node1", "node2"))
+	for _, name := range []string{"node1", "node2"} {
+		host, _ := store.HostGetByName(name)
+		if host.Status != HostActiveStatus {
+			t.Fatalf("host %s is %s, not active", name, host.Status)
+		}
+	}
+	if kube.hasOutOfServiceTaint("node1") {
+		t.Errorf("fenced host is not restored")
+	}
+	if !kube.hasOutOfServiceTaint("node2") {
+		t.Errorf("new host is restored")
+	}
+}
+
+func TestImportedRecoveryGroups(t *testing.T) {
+	store := database.NewMemoryStore()
+	p := newKubePolicyEngine(newFakeKube(t), store)
+	p.config.Recovery["scripts"] = config.RecoveryConfig{
+		Steps: []config.RecoveryStepConfig{{Type: "script", Command: "true"}},
+	}
+	host := &database.Host{Name: "node1", Group: "g1"}
+	if group, actions := p.getPipeline(host); group != defaultRecoveryGroup || len(actions) != 1 {
+		t.Fatalf("unexpected pipeline %s with %d actions", group, len(actions))
+	}
+
+	// imported groups take precedence over configured ones
+	err := store.InventorySave(&database.InventoryChanges{Groups: []*database.RecoveryGroup{
+		{Name: defaultRecoveryGroup},
+		// scripts not configured here are never executed
+		{Name: "g1", Steps: []database.RecoveryStep{{Type: "kubernetes"}, {Type: "script", Command: "true"},
+			{Type: "script", Command: "rm -rf /"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group, actions := p.getPipeline(host); group != "g1" || len(actions) != 2 {
+		t.Errorf("unexpected pipeline %s with %d actions", group, len(actions))
+	}
+	if _, actions := p.getPipeline(&database.Host{Name: "node2"}); len(actions) != 0 {
+		t.Errorf("configured default group is used")
+	}
+}
@@ -0,0 +1,33 @@
+package monitor
+
+import (
+	"time"
+
+	"themis/config"
+	"themis/database"
+)
+
+// Replay feeds events of journal through a fresh policy engine, cycle by
+// cycle, with the clock set to when each cycle was received. Store must be
+// a scratch store. No host is fenced or restored, fence decisions are
+// recorded in host history instead.
+func Replay(cfg *config.ThemisConfig, store database.Store, events []*database.JournalEvent) {
+	var now time.Time
+
+	p := NewPolicyEngine(cfg, "replay", store)
+	p.clock = func() time.Time { return now }
+	p.dryRun = true
+
+	for i := 0; i < len(events); {
+		now = events[i].Time
+		cycle := make(Events, 0)
+		for ; i < len(events) && events[i].Time.Equal(now); i++ {
+			cycle = append(cycle, &Event{
+				Hostname:   events[i].Hostname,
+				NetworkTag: events[i].Tag,
+				Status:     events[i].Status,
+			})
+		}
+		p.HandleEvents(cycle)
+	}
+}
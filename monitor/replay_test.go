@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"themis/config"
+	"themis/database"
+)
+
+// recordJournal records a day of events in a file journal: node1 and node2
+// become active, then network of node1 keeps failing.
+func recordJournal(t *testing.T, started time.Time) Journal {
+	j := NewJournal(&config.JournalConfig{Backend: "file", Path: filepath.Join(t.TempDir(), "events")})
+	appendJournal(t, j, started, append(activeEvents("node1"), activeEvents("node2")...))
+	appendJournal(t, j, started.Add(stateTransitionInterval*time.Second),
+		append(activeEvents("node1"), activeEvents("node2")...))
+	for i := 1; i <= 7; i++ {
+		at := started.Add(time.Duration(stateTransitionInterval+10*i) * time.Second)
+		appendJournal(t, j, at, append(tagEvents("node1", "network"), activeEvents("node2")...))
+	}
+	return j
+}
+
+func replayTransitions(t *testing.T, store database.Store, name string) string {
+	host, _ := store.HostGetByName(name)
+	if host == nil {
+		t.Fatalf("host %s is not replayed", name)
+	}
+	histories, _ := store.HostHistoryGetAll(host.Id)
+	transitions := make([]string, 0, len(histories))
+	for i := len(histories) - 1; i >= 0; i-- {
+		transitions = append(transitions, histories[i].OldStatus+">"+histories[i].NewStatus)
+	}
+	return strings.Join(transitions, ",")
+}
+
+func TestReplay(t *testing.T) {
+	started := day(2024, 3, 1)
+	events, err := recordJournal(t, started).Read(started, started.Add(time.Hour))
+	if err != nil || len(events) == 0 {
+		t.Fatalf("no event is recorded: %v", err)
+	}
+
+	cfg := config.NewDefaultConfig()
+	store := database.NewMemoryStore()
+	Replay(cfg, store, events)
+
+	// node1 would be fenced once it fails, nothing is fenced for real
+	expected := "initializing>active,active>checking,checking>failed,failed>fencing"
+	if transitions := replayTransitions(t, store, "node1"); transitions != expected {
+		t.Errorf("node1 transitions are %s", transitions)
+	}
+	if transitions := replayTransitions(t, store, "node2"); transitions != "initializing>active" {
+		t.Errorf("node2 transitions are %s", transitions)
+	}
+
+	host, _ := store.HostGetByName("node1")
+	histories, _ := store.HostHistoryGetAll(host.Id)
+	fenced := histories[0]
+	if fenced.Reason != "dry run: host would be fenced" || fenced.LeaderName != "replay" ||
+		!fenced.CreatedAt.Equal(started.Add((stateTransitionInterval+70)*time.Second)) {
+		t.Errorf("unexpected fence decision %+v", fenced)
+	}
+	if op, _ := store.OperationGetLatest(host.Id); op != nil {
+		t.Errorf("host is fenced by operation %d", op.Id)
+	}
+	if host.Disabled {
+		t.Errorf("host is disabled by replay")
+	}
+}
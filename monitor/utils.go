@@ -76,7 +76,7 @@ func getPidByAddress(address string) int {
 	result := strings.Split(stdout, "/")[0]
 	pid, err := strconv.Atoi(result)
 	if err != nil {
-		plog.Fatal("Get pid failed: %s", err.Error())
+		plog.Fatalf("Get pid failed: %s", err.Error())
 		return 0
 	} else {
 		return pid